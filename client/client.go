@@ -0,0 +1,341 @@
+// Package client calls the API with typed methods bound to the routes registered
+// by the server, e.g. client.Items.Get(ctx, item.GetRequest{ItemID: "1"}).
+//
+// Error responses are decoded back into gota33/errors values, so errors.Code and
+// errors.Details work as on the server side.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gota33/errors"
+	"server/internal/route"
+)
+
+//go:generate go run ./internal/routegen -d .
+
+const (
+	defaultRetries    = 3
+	defaultBackoff    = 100 * time.Millisecond
+	defaultMaxBackoff = 5 * time.Second
+)
+
+type ctxKey int
+
+const idempotencyKeyCtx ctxKey = iota
+
+const headerIdempotencyKey = "Idempotency-Key"
+
+// WithIdempotencyKey sends key with POST calls made by ctx, e.g. to retry a checkout
+// across restarts of the caller. Keys are rejected for other requests than their first,
+// so ctx is meant for one call. POST calls without a key are never retried.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx, key)
+}
+
+func idempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyCtx).(string)
+	return key
+}
+
+// TokenSource returns the bearer token sent with each request, empty for anonymous.
+type TokenSource func(ctx context.Context) (string, error)
+
+// StaticToken always sends token.
+func StaticToken(token string) TokenSource {
+	return func(context.Context) (string, error) { return token, nil }
+}
+
+type Config struct {
+	// BaseURL is where routes are served, e.g. "https://api.example.com/".
+	BaseURL    string
+	HTTPClient *http.Client
+	Token      TokenSource
+
+	// GET requests, and POST requests sent with an idempotency key, failed with
+	// UNAVAILABLE are retried up to MaxRetries times,
+	// waiting from Backoff doubled each time up to MaxBackoff, or the delay
+	// suggested by the server. Negative MaxRetries disables retries.
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+type Client struct {
+	config Config
+	base   *url.URL
+
+	Items      Items
+	Customers  Customers
+	Carts      Carts
+	Webhooks   Webhooks
+	Operations Operations
+	Demo       Demo
+}
+
+func New(c Config) (client *Client, err error) {
+	if c.HTTPClient == nil {
+		c.HTTPClient = http.DefaultClient
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = defaultRetries
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = defaultBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultMaxBackoff
+	}
+
+	client = &Client{config: c}
+	if client.base, err = url.Parse(strings.TrimSuffix(c.BaseURL, "/") + "/"); err != nil {
+		return
+	}
+	client.bind()
+	return
+}
+
+// bind looks up the route of an operation, e.g. "item.Service.Get", and calls it by fn.
+// Types of fn are generated from the route by routegen, so they match the server.
+func bind[Request, Response any](c *Client, fn *func(context.Context, Request) (Response, error), operation string) {
+	r, ok := routes[operation]
+	if !ok {
+		panic(fmt.Sprintf("client: no route of %s", operation))
+	}
+
+	*fn = func(ctx context.Context, req Request) (res Response, err error) {
+		err = c.call(ctx, r, req, &res)
+		return
+	}
+}
+
+func (c *Client) call(ctx context.Context, r route.Route, req any, res any) (err error) {
+	var (
+		target *url.URL
+		header http.Header
+		body   []byte
+	)
+	if target, header, err = c.target(r, req); err != nil {
+		return
+	}
+	if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+		if body, err = encodeBody(req); err != nil {
+			return
+		}
+	}
+	// Retries of the call share the key, so the server runs it once
+	if key := idempotencyKey(ctx); r.Method == http.MethodPost && key != "" && header.Get(headerIdempotencyKey) == "" {
+		header.Set(headerIdempotencyKey, key)
+	}
+
+	// Other requests may have been applied before the server failed
+	retries := c.config.MaxRetries
+	if r.Method != http.MethodGet && (r.Method != http.MethodPost || header.Get(headerIdempotencyKey) == "") {
+		retries = 0
+	}
+
+	delay := c.config.Backoff
+	for attempt := 0; ; attempt++ {
+		if err = c.do(ctx, r.Method, target, header, body, res); err == nil ||
+			errors.Code(err) != errors.Unavailable || attempt >= retries {
+			return
+		}
+
+		wait := delay
+		for _, d := range errors.Details(err) {
+			if info, ok := d.(*errors.RetryInfo); ok && time.Duration(info.RetryDelay) > wait {
+				wait = time.Duration(info.RetryDelay)
+			}
+		}
+		if wait > c.config.MaxBackoff {
+			wait = c.config.MaxBackoff
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if delay *= 2; delay > c.config.MaxBackoff {
+			delay = c.config.MaxBackoff
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, method string, target *url.URL, header http.Header, body []byte, res any) (err error) {
+	var (
+		req   *http.Request
+		resp  *http.Response
+		token string
+	)
+	if req, err = http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body)); err != nil {
+		return
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.config.Token != nil {
+		if token, err = c.config.Token(ctx); err != nil {
+			return errors.Annotate(err, errors.Unauthenticated)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	if resp, err = c.config.HTTPClient.Do(req); err != nil {
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeError(resp)
+	}
+
+	// Status only responses, e.g. 204 of deletes
+	if code, ok := res.(*int); ok {
+		*code = resp.StatusCode
+		return
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// target fills path variables of the route with param fields of req, and
+// query, header and cookie fields with a value into the query string and headers.
+func (c *Client) target(r route.Route, req any) (target *url.URL, header http.Header, err error) {
+	params := map[string]string{}
+	query := url.Values{}
+	header = http.Header{}
+	rv := reflect.Indirect(reflect.ValueOf(req))
+	route.EachField(rv.Type(), func(f reflect.StructField) {
+		v := rv.FieldByIndex(f.Index)
+		if name := f.Tag.Get("param"); name != "" {
+			params[name] = fmt.Sprint(v.Interface())
+		}
+		if v.IsZero() {
+			return
+		}
+		if name := f.Tag.Get("query"); name != "" {
+			query.Set(name, formatValue(v))
+		}
+		if name := f.Tag.Get("header"); name != "" {
+			header.Set(name, formatValue(v))
+		}
+		if name := f.Tag.Get("cookie"); name != "" {
+			cookie := (&http.Cookie{Name: name, Value: formatValue(v)}).String()
+			if prev := header.Get("Cookie"); prev != "" {
+				cookie = prev + "; " + cookie
+			}
+			header.Set("Cookie", cookie)
+		}
+	})
+
+	segments := strings.Split(strings.TrimPrefix(r.Path, "/"), "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, ":") {
+			continue
+		}
+		name, verb, _ := strings.Cut(segment[1:], ":")
+		value := params[name]
+		if value == "" {
+			return nil, nil, errors.WithBadRequest(fmt.Errorf("missing path variable %q", name), errors.BadRequest{
+				FieldViolations: []errors.FieldViolation{{Field: name, Description: "required"}},
+			})
+		}
+		segments[i] = url.PathEscape(value)
+		if verb != "" {
+			segments[i] += ":" + verb
+		}
+	}
+
+	if target, err = c.base.Parse(strings.Join(segments, "/")); err != nil {
+		return
+	}
+	target.RawQuery = query.Encode()
+	return
+}
+
+// formatValue formats values like the server binds them, slices are comma separated.
+func formatValue(v reflect.Value) string {
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		if text, err := m.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		values := make([]string, v.Len())
+		for i := range values {
+			values[i] = formatValue(v.Index(i))
+		}
+		return strings.Join(values, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// encodeBody marshals req without fields sent in the path, query string or headers.
+func encodeBody(req any) (body []byte, err error) {
+	if body, err = json.Marshal(req); err != nil {
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return
+	}
+	route.EachField(reflect.TypeOf(req), func(f reflect.StructField) {
+		if f.Tag.Get("json") == "" && route.IsBound(f) {
+			delete(fields, f.Name)
+		}
+	})
+	return json.Marshal(fields)
+}
+
+// decodeError decodes errors encoded by the server, others are coded by HTTP status.
+func decodeError(resp *http.Response) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var msg struct {
+		Error struct {
+			Message string            `json:"message"`
+			Status  errors.StatusName `json:"status"`
+			Details json.RawMessage   `json:"details"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &msg) == nil && msg.Error.Status != "" {
+		if len(msg.Error.Details) > 0 {
+			return errors.NewDecoder(json.NewDecoder(bytes.NewReader(data))).Decode()
+		}
+		return errors.Annotate(fmt.Errorf("%s", msg.Error.Message), msg.Error.Status.StatusCode())
+	}
+
+	code := errors.Unknown
+	for c := errors.OK; c <= errors.Unauthenticated; c++ {
+		if c.Http() == resp.StatusCode {
+			code = c
+			break
+		}
+	}
+	return errors.Annotate(fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(data)), code)
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gota33/errors"
+	"server/client/customer"
+	"server/client/item"
+	"server/client/operation"
+	"server/internal/server"
+)
+
+func TestRoutesGenerated(t *testing.T) {
+	registered := server.Routes()
+	if len(routes) != len(registered) {
+		t.Errorf("got %d routes, server registers %d, run go generate", len(routes), len(registered))
+	}
+	for _, want := range registered {
+		got := routes[want.Operation]
+		if got.Method != want.Method || got.Path != want.Path || got.Stream != want.Stream {
+			t.Errorf("route of %s = %+v, want %+v, run go generate", want.Operation, got, want)
+		}
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c, err := New(Config{BaseURL: srv.URL, MaxRetries: 2, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		call  func() error
+		calls int32
+	}{
+		{"GET", func() error {
+			_, callErr := c.Items.Get(ctx, item.GetRequest{ItemID: "1"})
+			return callErr
+		}, 3},
+		{"POST", func() error {
+			_, callErr := c.Customers.Create(ctx, customer.Entity{})
+			return callErr
+		}, 1},
+		{"POST with key", func() error {
+			_, callErr := c.Customers.Create(WithIdempotencyKey(ctx, "k1"), customer.Entity{})
+			return callErr
+		}, 3},
+		{"custom method", func() error {
+			_, callErr := c.Operations.Cancel(ctx, operation.CancelRequest{OperationID: "1"})
+			return callErr
+		}, 1},
+		{"PATCH", func() error {
+			_, callErr := c.Items.Update(ctx, item.UpdateRequest{ItemID: "1"})
+			return callErr
+		}, 1},
+		{"DELETE", func() error {
+			_, callErr := c.Items.Delete(ctx, item.DeleteRequest{ItemID: "1"})
+			return callErr
+		}, 1},
+	}
+	for _, tt := range tests {
+		atomic.StoreInt32(&calls, 0)
+		if err = tt.call(); errors.Code(err) != errors.Unavailable {
+			t.Errorf("%s: got %v, want UNAVAILABLE", tt.name, err)
+		}
+		if got := atomic.LoadInt32(&calls); got != tt.calls {
+			t.Errorf("%s: sent %d times, want %d", tt.name, got, tt.calls)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+// Code generated by routegen from server.Routes. DO NOT EDIT.
+
+// Package demo has the types of server/internal/service/demo sent by clients.
+package demo
+
+type HelloRequest struct {
+	Name string `query:"name"`
+}
+
+type HelloResponse struct {
+	Hello string `json:"hello"`
+}
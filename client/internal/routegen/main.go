@@ -0,0 +1,293 @@
+// Command routegen writes the routes registered by the server as a static table,
+// and the types of their requests and responses as packages of plain structs,
+// so package client binds them without linking the server.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"server/internal/route"
+	"server/internal/server"
+)
+
+const (
+	header      = "// Code generated by routegen from server.Routes. DO NOT EDIT.\n\n"
+	servicePath = "server/internal/service/"
+	clientPath  = "server/client/"
+)
+
+var (
+	typeTime       = reflect.TypeOf(time.Time{})
+	typeRawMessage = reflect.TypeOf(json.RawMessage{})
+)
+
+func main() {
+	dir := flag.String("d", ".", "directory of package client")
+	flag.Parse()
+
+	files, err := generate(server.Routes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for name, src := range files {
+		name = filepath.Join(*dir, name)
+		if err = os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			log.Fatal(err)
+		}
+		if err = os.WriteFile(name, src, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// generate returns sources by path relative to package client: routes.go, and
+// a package of types for each service, e.g. item/item.go.
+func generate(routes []route.Route) (files map[string][]byte, err error) {
+	files = map[string][]byte{}
+	if files["routes.go"], err = generateRoutes(routes); err != nil {
+		return
+	}
+
+	g := generator{packages: map[string]*typesPackage{}}
+	for _, r := range routes {
+		if bindable(r) {
+			g.collect(r.Request)
+			g.collect(r.Response)
+		}
+	}
+	for name, p := range g.packages {
+		if files[name+"/"+name+".go"], err = g.source(name, p); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func generateRoutes(routes []route.Route) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	buf.WriteString("package client\n\nimport \"server/internal/route\"\n\n")
+	buf.WriteString("// routes of the server by operation.\nvar routes = map[string]route.Route{\n")
+	for _, r := range routes {
+		fmt.Fprintf(&buf, "%q: {Method: %q, Path: %q, Operation: %q", r.Operation, r.Method, r.Path, r.Operation)
+		if r.Stream {
+			buf.WriteString(", Stream: true")
+		}
+		buf.WriteString("},\n")
+	}
+	buf.WriteString("}\n")
+	return format.Source(buf.Bytes())
+}
+
+// bindable reports routes clients call with JSON, streams and uploads aren't supported.
+func bindable(r route.Route) bool {
+	if r.Stream || r.Request == nil || r.Response == nil {
+		return false
+	}
+	return isService(r.Request) && (isService(r.Response) || r.Response.Kind() == reflect.Int) && !hasFiles(r.Request)
+}
+
+func isService(t reflect.Type) bool {
+	return strings.HasPrefix(t.PkgPath(), servicePath)
+}
+
+func hasFiles(t reflect.Type) (files bool) {
+	route.EachField(t, func(f reflect.StructField) {
+		files = files || f.Tag.Get("form") != ""
+	})
+	return
+}
+
+// typesPackage lists types of a service package in the order they are found.
+type typesPackage struct {
+	types []reflect.Type
+	seen  map[reflect.Type]bool
+}
+
+type generator struct {
+	packages map[string]*typesPackage
+}
+
+// collect adds t and the service types of its fields, once each.
+func (g generator) collect(t reflect.Type) {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if !isService(t) {
+		return
+	}
+
+	name := packageName(t)
+	p, ok := g.packages[name]
+	if !ok {
+		p = &typesPackage{seen: map[reflect.Type]bool{}}
+		g.packages[name] = p
+	}
+	if p.seen[t] {
+		return
+	}
+	p.seen[t] = true
+	p.types = append(p.types, t)
+
+	if t.Kind() == reflect.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.IsExported() {
+				g.collect(f.Type)
+			}
+		}
+	}
+}
+
+func (g generator) source(name string, p *typesPackage) (src []byte, err error) {
+	var (
+		body    bytes.Buffer
+		imports = map[string]bool{}
+	)
+	for _, t := range p.types {
+		var decl string
+		if decl, err = typeDecl(t, name, imports); err != nil {
+			return
+		}
+		fmt.Fprintf(&body, "\ntype %s %s\n", t.Name(), decl)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	fmt.Fprintf(&buf, "// Package %s has the types of %s%s sent by clients.\npackage %s\n", name, servicePath, name, name)
+	if len(imports) > 0 {
+		// Standard packages first, then other client packages
+		paths := make([]string, 0, len(imports))
+		for path := range imports {
+			paths = append(paths, path)
+		}
+		sort.Slice(paths, func(i, j int) bool {
+			if ci, cj := strings.HasPrefix(paths[i], clientPath), strings.HasPrefix(paths[j], clientPath); ci != cj {
+				return cj
+			}
+			return paths[i] < paths[j]
+		})
+		buf.WriteString("\nimport (\n")
+		for i, path := range paths {
+			if i > 0 && strings.HasPrefix(path, clientPath) && !strings.HasPrefix(paths[i-1], clientPath) {
+				buf.WriteString("\n")
+			}
+			fmt.Fprintf(&buf, "%q\n", path)
+		}
+		buf.WriteString(")\n")
+	}
+	buf.Write(body.Bytes())
+	return format.Source(buf.Bytes())
+}
+
+// typeDecl declares t like the server does, without unexported fields and server-only tags.
+func typeDecl(t reflect.Type, pkg string, imports map[string]bool) (decl string, err error) {
+	if t.Kind() != reflect.Struct {
+		return kindExpr(t, pkg, imports)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("struct {\n")
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		// Fields neither encoded nor bound only matter to the server
+		if !f.IsExported() || (f.Tag.Get("json") == "-" && !route.IsBound(f)) {
+			continue
+		}
+		var expr string
+		if expr, err = typeExpr(f.Type, pkg, imports); err != nil {
+			return "", fmt.Errorf("%s.%s: %w", t, f.Name, err)
+		}
+		if f.Anonymous {
+			sb.WriteString(expr)
+		} else {
+			sb.WriteString(f.Name + " " + expr)
+		}
+		if tag := clientTag(f.Tag); tag != "" {
+			sb.WriteString(" `" + tag + "`")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("}")
+	return sb.String(), nil
+}
+
+// typeExpr spells t in package pkg of the client, service types refer to their client packages.
+func typeExpr(t reflect.Type, pkg string, imports map[string]bool) (expr string, err error) {
+	switch {
+	case t == typeTime:
+		imports["time"] = true
+		return "time.Time", nil
+	case t == typeRawMessage:
+		imports["encoding/json"] = true
+		return "json.RawMessage", nil
+	case isService(t):
+		name := packageName(t)
+		if name == pkg {
+			return t.Name(), nil
+		}
+		imports[clientPath+name] = true
+		return name + "." + t.Name(), nil
+	case t.PkgPath() != "":
+		return "", fmt.Errorf("unsupported type %s", t)
+	}
+	return kindExpr(t, pkg, imports)
+}
+
+// kindExpr spells the underlying type of t.
+func kindExpr(t reflect.Type, pkg string, imports map[string]bool) (expr string, err error) {
+	var elem string
+	switch t.Kind() {
+	case reflect.Pointer:
+		elem, err = typeExpr(t.Elem(), pkg, imports)
+		return "*" + elem, err
+	case reflect.Slice:
+		elem, err = typeExpr(t.Elem(), pkg, imports)
+		return "[]" + elem, err
+	case reflect.Array:
+		elem, err = typeExpr(t.Elem(), pkg, imports)
+		return fmt.Sprintf("[%d]%s", t.Len(), elem), err
+	case reflect.Map:
+		var key string
+		if key, err = typeExpr(t.Key(), pkg, imports); err != nil {
+			return
+		}
+		elem, err = typeExpr(t.Elem(), pkg, imports)
+		return "map[" + key + "]" + elem, err
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return "any", nil
+		}
+	case reflect.Struct, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+	default:
+		return t.Kind().String(), nil
+	}
+	return "", fmt.Errorf("unsupported type %s", t)
+}
+
+// clientTag keeps tags of the JSON encoding and of binding sources.
+func clientTag(tag reflect.StructTag) string {
+	var parts []string
+	for _, key := range append([]string{"json"}, route.BindingTags...) {
+		if value, ok := tag.Lookup(key); ok {
+			parts = append(parts, fmt.Sprintf("%s:%q", key, value))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// packageName names the client package of a service type, e.g. "item".
+func packageName(t reflect.Type) string {
+	path := t.PkgPath()
+	return path[strings.LastIndexByte(path, '/')+1:]
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"server/internal/server"
+)
+
+func TestGenerated(t *testing.T) {
+	files, err := generate(server.Routes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range files {
+		got, readErr := os.ReadFile(filepath.Join("..", "..", name))
+		if readErr != nil || !bytes.Equal(got, want) {
+			t.Errorf("client/%s is out of date, run go generate", name)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Code generated by routegen from server.Routes. DO NOT EDIT.
+
+package client
+
+import "server/internal/route"
+
+// routes of the server by operation.
+var routes = map[string]route.Route{
+	"demo.Service.Hello":             {Method: "GET", Path: "demo/hello", Operation: "demo.Service.Hello"},
+	"item.Service.Create":            {Method: "POST", Path: "items", Operation: "item.Service.Create"},
+	"item.Service.List":              {Method: "GET", Path: "items", Operation: "item.Service.List"},
+	"item.Watch":                     {Method: "GET", Path: "items\\:watch", Operation: "item.Watch", Stream: true},
+	"item.Service.Export":            {Method: "GET", Path: "items\\:export", Operation: "item.Service.Export", Stream: true},
+	"item.Service.Import":            {Method: "POST", Path: "items\\:import", Operation: "item.Service.Import"},
+	"item.Service.Get":               {Method: "GET", Path: "items/:itemID", Operation: "item.Service.Get"},
+	"item.Service.Update":            {Method: "PATCH", Path: "items/:itemID", Operation: "item.Service.Update"},
+	"item.Service.Delete":            {Method: "DELETE", Path: "items/:itemID", Operation: "item.Service.Delete"},
+	"item.Service.Restore":           {Method: "POST", Path: "items/:itemID:restore", Operation: "item.Service.Restore"},
+	"item.Service.ListRevisions":     {Method: "GET", Path: "items/:itemID/revisions", Operation: "item.Service.ListRevisions"},
+	"customer.Service.Create":        {Method: "POST", Path: "customers", Operation: "customer.Service.Create"},
+	"customer.Service.List":          {Method: "GET", Path: "customers", Operation: "customer.Service.List"},
+	"customer.Service.Get":           {Method: "GET", Path: "customers/:customerID", Operation: "customer.Service.Get"},
+	"customer.Service.Update":        {Method: "PATCH", Path: "customers/:customerID", Operation: "customer.Service.Update"},
+	"customer.Service.Delete":        {Method: "DELETE", Path: "customers/:customerID", Operation: "customer.Service.Delete"},
+	"cart.Service.Create":            {Method: "POST", Path: "customers/:customerID/carts", Operation: "cart.Service.Create"},
+	"cart.Service.List":              {Method: "GET", Path: "customers/:customerID/carts", Operation: "cart.Service.List"},
+	"cart.Service.Get":               {Method: "GET", Path: "customers/:customerID/carts/:cartID", Operation: "cart.Service.Get"},
+	"cart.Service.Update":            {Method: "PATCH", Path: "customers/:customerID/carts/:cartID", Operation: "cart.Service.Update"},
+	"cart.Service.Delete":            {Method: "DELETE", Path: "customers/:customerID/carts/:cartID", Operation: "cart.Service.Delete"},
+	"webhook.Service.Create":         {Method: "POST", Path: "webhooks", Operation: "webhook.Service.Create"},
+	"webhook.Service.List":           {Method: "GET", Path: "webhooks", Operation: "webhook.Service.List"},
+	"webhook.Service.Get":            {Method: "GET", Path: "webhooks/:webhookID", Operation: "webhook.Service.Get"},
+	"webhook.Service.Update":         {Method: "PATCH", Path: "webhooks/:webhookID", Operation: "webhook.Service.Update"},
+	"webhook.Service.Delete":         {Method: "DELETE", Path: "webhooks/:webhookID", Operation: "webhook.Service.Delete"},
+	"webhook.Service.ListDeliveries": {Method: "GET", Path: "webhooks/:webhookID/deliveries", Operation: "webhook.Service.ListDeliveries"},
+	"webhook.Service.GetDelivery":    {Method: "GET", Path: "webhooks/:webhookID/deliveries/:deliveryID", Operation: "webhook.Service.GetDelivery"},
+	"webhook.Service.Redeliver":      {Method: "POST", Path: "webhooks/:webhookID/deliveries/:deliveryID:redeliver", Operation: "webhook.Service.Redeliver"},
+	"operation.Service.List":         {Method: "GET", Path: "operations", Operation: "operation.Service.List"},
+	"operation.Service.Get":          {Method: "GET", Path: "operations/:operationID", Operation: "operation.Service.Get"},
+	"operation.Service.Cancel":       {Method: "POST", Path: "operations/:operationID:cancel", Operation: "operation.Service.Cancel"},
+}
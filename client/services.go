@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+
+	"server/client/cart"
+	"server/client/customer"
+	"server/client/demo"
+	"server/client/item"
+	"server/client/operation"
+	"server/client/webhook"
+)
+
+// Items calls routes of items, types are exported by package client/item.
+type Items struct {
+	Create        func(context.Context, item.Entity) (item.Entity, error)
+	List          func(context.Context, item.ListRequest) (item.ListResponse, error)
+	Get           func(context.Context, item.GetRequest) (item.Entity, error)
+	Update        func(context.Context, item.UpdateRequest) (item.Entity, error)
+	Delete        func(context.Context, item.DeleteRequest) (int, error)
+	Restore       func(context.Context, item.RestoreRequest) (item.Entity, error)
+	ListRevisions func(context.Context, item.ListRevisionsRequest) (item.ListRevisionsResponse, error)
+}
+
+// Customers calls routes of customers, types are exported by package client/customer.
+type Customers struct {
+	Create func(context.Context, customer.Entity) (customer.Entity, error)
+	List   func(context.Context, customer.ListRequest) (customer.ListResponse, error)
+	Get    func(context.Context, customer.GetRequest) (customer.Entity, error)
+	Update func(context.Context, customer.UpdateRequest) (customer.Entity, error)
+	Delete func(context.Context, customer.DeleteRequest) (int, error)
+}
+
+// Carts calls routes of carts of a customer, types are exported by package client/cart.
+type Carts struct {
+	Create func(context.Context, cart.CreateRequest) (cart.Entity, error)
+	List   func(context.Context, cart.ListRequest) (cart.ListResponse, error)
+	Get    func(context.Context, cart.GetRequest) (cart.Entity, error)
+	Update func(context.Context, cart.UpdateRequest) (cart.Entity, error)
+	Delete func(context.Context, cart.DeleteRequest) (int, error)
+}
+
+// Webhooks calls routes of webhooks and their deliveries, types are exported by package client/webhook.
+type Webhooks struct {
+	Create         func(context.Context, webhook.CreateRequest) (webhook.CreateResponse, error)
+	List           func(context.Context, webhook.ListRequest) (webhook.ListResponse, error)
+	Get            func(context.Context, webhook.GetRequest) (webhook.Entity, error)
+	Update         func(context.Context, webhook.UpdateRequest) (webhook.Entity, error)
+	Delete         func(context.Context, webhook.DeleteRequest) (int, error)
+	ListDeliveries func(context.Context, webhook.ListDeliveriesRequest) (webhook.ListDeliveriesResponse, error)
+	GetDelivery    func(context.Context, webhook.GetDeliveryRequest) (webhook.Delivery, error)
+	Redeliver      func(context.Context, webhook.RedeliverRequest) (webhook.Delivery, error)
+}
+
+// Operations calls routes of long-running operations, types are exported by package client/operation.
+type Operations struct {
+	List   func(context.Context, operation.ListRequest) (operation.ListResponse, error)
+	Get    func(context.Context, operation.GetRequest) (operation.Entity, error)
+	Cancel func(context.Context, operation.CancelRequest) (operation.Entity, error)
+}
+
+// Demo calls demo routes, types are exported by package client/demo.
+type Demo struct {
+	Hello func(context.Context, demo.HelloRequest) (demo.HelloResponse, error)
+}
+
+func (c *Client) bind() {
+	bind(c, &c.Items.Create, "item.Service.Create")
+	bind(c, &c.Items.List, "item.Service.List")
+	bind(c, &c.Items.Get, "item.Service.Get")
+	bind(c, &c.Items.Update, "item.Service.Update")
+	bind(c, &c.Items.Delete, "item.Service.Delete")
+	bind(c, &c.Items.Restore, "item.Service.Restore")
+	bind(c, &c.Items.ListRevisions, "item.Service.ListRevisions")
+
+	bind(c, &c.Customers.Create, "customer.Service.Create")
+	bind(c, &c.Customers.List, "customer.Service.List")
+	bind(c, &c.Customers.Get, "customer.Service.Get")
+	bind(c, &c.Customers.Update, "customer.Service.Update")
+	bind(c, &c.Customers.Delete, "customer.Service.Delete")
+
+	bind(c, &c.Carts.Create, "cart.Service.Create")
+	bind(c, &c.Carts.List, "cart.Service.List")
+	bind(c, &c.Carts.Get, "cart.Service.Get")
+	bind(c, &c.Carts.Update, "cart.Service.Update")
+	bind(c, &c.Carts.Delete, "cart.Service.Delete")
+
+	bind(c, &c.Webhooks.Create, "webhook.Service.Create")
+	bind(c, &c.Webhooks.List, "webhook.Service.List")
+	bind(c, &c.Webhooks.Get, "webhook.Service.Get")
+	bind(c, &c.Webhooks.Update, "webhook.Service.Update")
+	bind(c, &c.Webhooks.Delete, "webhook.Service.Delete")
+	bind(c, &c.Webhooks.ListDeliveries, "webhook.Service.ListDeliveries")
+	bind(c, &c.Webhooks.GetDelivery, "webhook.Service.GetDelivery")
+	bind(c, &c.Webhooks.Redeliver, "webhook.Service.Redeliver")
+
+	bind(c, &c.Operations.List, "operation.Service.List")
+	bind(c, &c.Operations.Get, "operation.Service.Get")
+	bind(c, &c.Operations.Cancel, "operation.Service.Cancel")
+
+	bind(c, &c.Demo.Hello, "demo.Service.Hello")
+}
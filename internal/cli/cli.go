@@ -3,15 +3,30 @@ package cli
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"unicode"
 
 	"github.com/gota33/initializr"
 	"github.com/sirupsen/logrus"
 	. "github.com/urfave/cli/v2"
+	initaccesslog "server/internal/cli/config/accesslog/v1"
+	initidempotency "server/internal/cli/config/idempotency/v1"
+	initoperation "server/internal/cli/config/operation/v1"
+	initoutbox "server/internal/cli/config/outbox/v1"
+	initscheduler "server/internal/cli/config/scheduler/v1"
+	initserver "server/internal/cli/config/server/v1"
 	initsqlite "server/internal/cli/config/sqlite/v1"
+	inittracing "server/internal/cli/config/tracing/v1"
 	"server/internal/server"
+	"server/internal/service/entity"
+	"server/internal/service/event"
+	"server/internal/service/item"
+	"server/internal/service/webhook"
 )
 
 const EnvPrefix = "APP_"
@@ -29,8 +44,17 @@ var (
 	Version = "dev"
 
 	flagLevel     = flagName[string]("level")
+	flagLogFormat = flagName[string]("log-format")
 	flagHttp      = flagName[string]("http")
+	flagAdminHttp = flagName[string]("admin-http")
+	flagGRPC      = flagName[string]("grpc")
 	flagConfigUrl = flagName[string]("config-url")
+	flagDebug     = flagName[bool]("debug")
+	flagTLSCert   = flagName[string]("tls-cert")
+	flagTLSKey    = flagName[string]("tls-key")
+	flagOutput    = flagName[string]("output")
+	flagFormat    = flagName[string]("format")
+	flagDryRun    = flagName[bool]("dry-run")
 
 	cli = &App{
 		Name:    AppName,
@@ -41,6 +65,11 @@ var (
 				EnvVars: flagLevel.Envs(),
 				Value:   "info",
 			},
+			&StringFlag{
+				Name:    string(flagLogFormat),
+				EnvVars: flagLogFormat.Envs(),
+				Value:   "text",
+			},
 		},
 		Before: func(c *Context) (err error) {
 			var lvl logrus.Level
@@ -48,6 +77,15 @@ var (
 				return
 			}
 			logrus.SetLevel(lvl)
+
+			switch format := flagLogFormat.Get(c); format {
+			case "text":
+				logrus.SetFormatter(&logrus.TextFormatter{})
+			case "json":
+				logrus.SetFormatter(&logrus.JSONFormatter{})
+			default:
+				return fmt.Errorf("unknown log format: %q", format)
+			}
 			return
 		},
 		Commands: []*Command{
@@ -59,14 +97,75 @@ var (
 						EnvVars: flagHttp.Envs(),
 						Value:   ":8080",
 					},
+					&StringFlag{
+						Name:    string(flagAdminHttp),
+						EnvVars: flagAdminHttp.Envs(),
+						Value:   "",
+					},
+					&StringFlag{
+						Name:    string(flagGRPC),
+						EnvVars: flagGRPC.Envs(),
+						Value:   "",
+					},
 					&StringFlag{
 						Name:    string(flagConfigUrl),
 						EnvVars: flagConfigUrl.Envs(),
 						Value:   "",
 					},
+					&BoolFlag{
+						Name:    string(flagDebug),
+						EnvVars: flagDebug.Envs(),
+					},
+					&StringFlag{
+						Name:    string(flagTLSCert),
+						EnvVars: flagTLSCert.Envs(),
+						Value:   "",
+					},
+					&StringFlag{
+						Name:    string(flagTLSKey),
+						EnvVars: flagTLSKey.Envs(),
+						Value:   "",
+					},
 				},
 				Action: runServer,
 			},
+			{
+				Name:  "openapi",
+				Usage: "Write the OpenAPI spec, to stdout by default",
+				Flags: []Flag{
+					&StringFlag{
+						Name:    string(flagOutput),
+						Aliases: []string{"o"},
+						EnvVars: flagOutput.Envs(),
+						Value:   "-",
+					},
+				},
+				Action: runOpenAPI,
+			},
+			{
+				Name:      "import",
+				Usage:     "Import items from a CSV or NDJSON file, or stdin by \"-\", and write the report to stdout",
+				ArgsUsage: "FILE",
+				Flags: []Flag{
+					&StringFlag{
+						Name:    string(flagConfigUrl),
+						EnvVars: flagConfigUrl.Envs(),
+						Value:   "",
+					},
+					&StringFlag{
+						Name:    string(flagFormat),
+						Usage:   "csv or ndjson, detected from the file extension by default",
+						EnvVars: flagFormat.Envs(),
+						Value:   "",
+					},
+					&BoolFlag{
+						Name:    string(flagDryRun),
+						Usage:   "validate and write every row, then roll back",
+						EnvVars: flagDryRun.Envs(),
+					},
+				},
+				Action: runImport,
+			},
 		},
 	}
 )
@@ -91,32 +190,151 @@ func (name flagName[T]) Envs() []string {
 
 func runServer(c *Context) (err error) {
 	var (
-		config   server.Config
-		res      initializr.Resource
-		closeRDS func()
+		config       server.Config
+		res          initializr.Resource
+		closeRDS     func()
+		closeTracing func()
 	)
-	if configUrl := flagConfigUrl.Get(c); configUrl != "" {
-		res, err = initializr.FromJsonRemote(configUrl)
-	} else {
-		res, err = initializr.FromJson(bytes.NewReader(defaultConfig))
+	if res, err = loadConfig(c); err != nil {
+		return
+	}
+	if config, err = initserver.New(res, "server"); err != nil {
+		return
 	}
-	if err != nil {
+	if closeTracing, err = inittracing.New(res, "tracing"); err != nil {
 		return
 	}
-	if config.RDS, closeRDS, err = initsqlite.New(res, "sqlite"); err != nil {
+
+	defer closeTracing()
+
+	if config.RDS, closeRDS, err = openRDS(c.Context, res); err != nil {
 		return
 	}
 
 	defer closeRDS()
 
-	if _, err = config.RDS.ExecContext(c.Context, initSql); err != nil {
+	if config.AccessLog, err = initaccesslog.New(res, "accessLog"); err != nil {
+		return
+	}
+
+	if config.Operations, err = initoperation.New(res, "operations", config.RDS); err != nil {
+		return
+	}
+	if config.Scheduler, err = initscheduler.New(res, "scheduler", config.RDS); err != nil {
+		return
+	}
+	if config.Idempotency, err = initidempotency.New(res, "idempotency", config.RDS); err != nil {
+		return
+	}
+	config.Events = event.NewBus()
+	if config.Dispatcher, err = initoutbox.New(res, "outbox", config.RDS,
+		config.Events, webhook.NewSink(config.RDS)); err != nil {
 		return
 	}
 
 	config.Addr = flagHttp.Get(c)
+	config.AdminAddr = flagAdminHttp.Get(c)
+	config.GRPCAddr = flagGRPC.Get(c)
+	config.Name, config.Version = AppName, Version
+	config.Debug = flagDebug.Get(c)
+	if certFile := flagTLSCert.Get(c); certFile != "" {
+		config.TLS.CertFile = certFile
+	}
+	if keyFile := flagTLSKey.Get(c); keyFile != "" {
+		config.TLS.KeyFile = keyFile
+	}
 	return server.Run(c.Context, config)
 }
 
+// loadConfig reads the config at --config-url, or the default one.
+func loadConfig(c *Context) (res initializr.Resource, err error) {
+	if configUrl := flagConfigUrl.Get(c); configUrl != "" {
+		return initializr.FromJsonRemote(configUrl)
+	}
+	return initializr.FromJson(bytes.NewReader(defaultConfig))
+}
+
+// openRDS opens the database of the config and creates missing tables.
+func openRDS(ctx context.Context, res initializr.Resource) (db *sql.DB, closeRDS func(), err error) {
+	if db, closeRDS, err = initsqlite.New(res, "sqlite"); err != nil {
+		return
+	}
+	if _, err = db.ExecContext(ctx, initSql); err != nil {
+		closeRDS()
+	}
+	return
+}
+
+func runImport(c *Context) (err error) {
+	var (
+		path   = c.Args().First()
+		format = flagFormat.Get(c)
+		r      io.Reader
+		res    initializr.Resource
+		db     *sql.DB
+		report entity.ImportReport
+	)
+	if path == "" {
+		return fmt.Errorf("missing file to import")
+	}
+	if format == "" {
+		if format, err = entity.ImportFormat(path, ""); err != nil {
+			return
+		}
+	}
+
+	if path == "-" {
+		r = c.App.Reader
+	} else {
+		var f *os.File
+		if f, err = os.Open(path); err != nil {
+			return
+		}
+
+		defer func() { _ = f.Close() }()
+
+		r = f
+	}
+
+	if res, err = loadConfig(c); err != nil {
+		return
+	}
+
+	var closeRDS func()
+	if db, closeRDS, err = openRDS(c.Context, res); err != nil {
+		return
+	}
+
+	defer closeRDS()
+
+	if report, err = item.New(db, nil).ImportFrom(c.Context, r, format, flagDryRun.Get(c)); err != nil {
+		return
+	}
+
+	enc := json.NewEncoder(c.App.Writer)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(report); err != nil {
+		return
+	}
+	if report.Failed > 0 {
+		return Exit(fmt.Sprintf("%d of %d rows failed", report.Failed, report.Total), 1)
+	}
+	return
+}
+
+func runOpenAPI(c *Context) (err error) {
+	var spec []byte
+	if spec, err = server.OpenAPI(server.Config{Name: AppName, Version: Version}); err != nil {
+		return
+	}
+
+	if output := flagOutput.Get(c); output != "-" {
+		return os.WriteFile(output, spec, 0o644)
+	}
+	_, err = c.App.Writer.Write(append(spec, '\n'))
+	return
+}
+
 func Run(ctx context.Context) (err error) {
 	return cli.RunContext(ctx, os.Args)
 }
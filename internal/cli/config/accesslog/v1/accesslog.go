@@ -0,0 +1,33 @@
+package v1
+
+import (
+	"fmt"
+
+	"github.com/gota33/initializr"
+	"server/internal/cli/config"
+	"server/internal/server"
+)
+
+type Options struct {
+	SampleRate float64  `json:"sampleRate"`
+	Exclude    []string `json:"exclude"`
+}
+
+func New(res initializr.Resource, key string) (a server.AccessLog, err error) {
+	opts := Options{
+		SampleRate: 1,
+		Exclude:    []string{"/healthz", "/livez", "/readyz", "/metrics"},
+	}
+	if err = config.Scan(res, key, &opts); err != nil {
+		return
+	}
+	if opts.SampleRate < 0 || opts.SampleRate > 1 {
+		return a, fmt.Errorf("%s.sampleRate must be between 0 and 1, got %v", key, opts.SampleRate)
+	}
+
+	a = server.AccessLog{
+		SampleRate: opts.SampleRate,
+		Exclude:    opts.Exclude,
+	}
+	return
+}
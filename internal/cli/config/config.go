@@ -0,0 +1,33 @@
+// Package config holds helpers shared by the versioned config packages.
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gota33/initializr"
+)
+
+// errNotFound prefixes the error initializr returns for a missing key, it has no sentinel error.
+const errNotFound = "cofig key not found"
+
+// Scan reads the section at key into opts, a missing section keeps the defaults of opts,
+// so configs written before a section was added still load.
+func Scan(res initializr.Resource, key string, opts any) (err error) {
+	if err = res.Scan(key, opts); err != nil && strings.HasPrefix(err.Error(), errNotFound) {
+		return nil
+	}
+	return
+}
+
+// Positive parses a duration of field, e.g. an interval of a ticker, which must be above zero.
+func Positive(field, value string) (d time.Duration, err error) {
+	if d, err = time.ParseDuration(value); err != nil {
+		return
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s must be positive, got %q", field, value)
+	}
+	return
+}
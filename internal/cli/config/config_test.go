@@ -0,0 +1,49 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gota33/initializr"
+)
+
+type options struct {
+	Interval string `json:"interval"`
+	Size     int    `json:"size"`
+}
+
+func TestScan(t *testing.T) {
+	res, err := initializr.FromJson(strings.NewReader(`{"present": {"size": 2}, "invalid": {"size": "x"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key     string
+		want    options
+		wantErr bool
+	}{
+		{key: "missing", want: options{Interval: "1s", Size: 1}},
+		{key: "present", want: options{Interval: "1s", Size: 2}},
+		{key: "invalid", wantErr: true},
+	}
+	for _, tt := range tests {
+		opts := options{Interval: "1s", Size: 1}
+		err = Scan(res, tt.key, &opts)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Scan(%q) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && opts != tt.want {
+			t.Errorf("Scan(%q) = %+v, want %+v", tt.key, opts, tt.want)
+		}
+	}
+}
+
+func TestPositive(t *testing.T) {
+	for value, wantErr := range map[string]bool{"1s": false, "0s": true, "-1m": true, "x": true} {
+		if _, err := Positive("interval", value); (err != nil) != wantErr {
+			t.Errorf("Positive(%q) error = %v, wantErr %v", value, err, wantErr)
+		}
+	}
+}
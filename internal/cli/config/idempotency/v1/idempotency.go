@@ -0,0 +1,33 @@
+package v1
+
+import (
+	"database/sql"
+
+	"github.com/gota33/initializr"
+	"server/internal/cli/config"
+	"server/internal/service/idempotency"
+)
+
+type Options struct {
+	TTL     string `json:"ttl"`
+	LockTTL string `json:"lockTTL"`
+}
+
+func New(res initializr.Resource, key string, db *sql.DB) (s *idempotency.Store, err error) {
+	opts := Options{
+		TTL:     "24h",
+		LockTTL: "1m",
+	}
+	if err = config.Scan(res, key, &opts); err != nil {
+		return
+	}
+
+	s = idempotency.NewStore(db)
+	if s.TTL, err = config.Positive(key+".ttl", opts.TTL); err != nil {
+		return
+	}
+	if s.LockTTL, err = config.Positive(key+".lockTTL", opts.LockTTL); err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,41 @@
+package v1
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gota33/initializr"
+	"server/internal/cli/config"
+	"server/internal/service/operation"
+)
+
+type Options struct {
+	Workers  int    `json:"workers"`
+	Interval string `json:"interval"`
+	LeaseTTL string `json:"leaseTTL"`
+}
+
+func New(res initializr.Resource, key string, db *sql.DB) (r *operation.Runner, err error) {
+	opts := Options{
+		Workers:  4,
+		Interval: "1s",
+		LeaseTTL: "1m",
+	}
+	if err = config.Scan(res, key, &opts); err != nil {
+		return
+	}
+
+	if opts.Workers <= 0 {
+		return nil, fmt.Errorf("%s.workers must be positive, got %d", key, opts.Workers)
+	}
+
+	r = operation.NewRunner(db)
+	r.Workers = opts.Workers
+	if r.Interval, err = config.Positive(key+".interval", opts.Interval); err != nil {
+		return
+	}
+	if r.LeaseTTL, err = config.Positive(key+".leaseTTL", opts.LeaseTTL); err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,27 @@
+package v1
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gota33/initializr"
+)
+
+func TestNewWorkers(t *testing.T) {
+	tests := map[string]bool{
+		`{"operations": {}}`:                 false,
+		`{"operations": {"workers": 1}}`:     false,
+		`{"operations": {"workers": 0}}`:     true,
+		`{"operations": {"workers": -1}}`:    true,
+		`{"operations": {"leaseTTL": "0s"}}`: true,
+	}
+	for cfg, wantErr := range tests {
+		res, err := initializr.FromJson(strings.NewReader(cfg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = New(res, "operations", nil); (err != nil) != wantErr {
+			t.Errorf("New(%s) error = %v, wantErr %v", cfg, err, wantErr)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package v1
+
+import (
+	"database/sql"
+
+	"github.com/gota33/initializr"
+	"server/internal/cli/config"
+	"server/internal/service/event"
+)
+
+type Options struct {
+	Interval    string   `json:"interval"`
+	MaxBackoff  string   `json:"maxBackoff"`
+	BatchSize   int      `json:"batchSize"`
+	MaxAttempts int      `json:"maxAttempts"`
+	File        string   `json:"file"`
+	Webhooks    []string `json:"webhooks"`
+}
+
+func New(res initializr.Resource, key string, db *sql.DB, sinks ...event.Sink) (d *event.Dispatcher, err error) {
+	opts := Options{
+		Interval:    "1s",
+		MaxBackoff:  "5m",
+		BatchSize:   100,
+		MaxAttempts: 10,
+	}
+	if err = config.Scan(res, key, &opts); err != nil {
+		return
+	}
+
+	d = &event.Dispatcher{
+		DB:          db,
+		Sinks:       sinks,
+		BatchSize:   opts.BatchSize,
+		MaxAttempts: opts.MaxAttempts,
+	}
+	if d.Interval, err = config.Positive(key+".interval", opts.Interval); err != nil {
+		return
+	}
+	if d.MaxBackoff, err = config.Positive(key+".maxBackoff", opts.MaxBackoff); err != nil {
+		return
+	}
+	if opts.File != "" {
+		d.Sinks = append(d.Sinks, &event.File{Path: opts.File})
+	}
+	for _, url := range opts.Webhooks {
+		d.Sinks = append(d.Sinks, event.NewWebhook(url))
+	}
+	return
+}
@@ -0,0 +1,48 @@
+package v1
+
+import (
+	"database/sql"
+
+	"github.com/gota33/initializr"
+	"server/internal/cli/config"
+	"server/internal/service/job"
+)
+
+type Options struct {
+	Interval string            `json:"interval"`
+	LeaseTTL string            `json:"leaseTTL"`
+	History  string            `json:"history"`
+	Specs    map[string]string `json:"specs"`
+}
+
+func New(res initializr.Resource, key string, db *sql.DB) (s *job.Scheduler, err error) {
+	opts := Options{
+		Interval: "1s",
+		LeaseTTL: "1m",
+		History:  "168h",
+	}
+	if err = config.Scan(res, key, &opts); err != nil {
+		return
+	}
+
+	s = job.NewScheduler(db)
+	s.Specs = opts.Specs
+	if s.Interval, err = config.Positive(key+".interval", opts.Interval); err != nil {
+		return
+	}
+	if s.LeaseTTL, err = config.Positive(key+".leaseTTL", opts.LeaseTTL); err != nil {
+		return
+	}
+	if s.History, err = config.Positive(key+".history", opts.History); err != nil {
+		return
+	}
+	for _, spec := range opts.Specs {
+		if spec == job.Disabled {
+			continue
+		}
+		if _, err = job.Parse(spec); err != nil {
+			return
+		}
+	}
+	return
+}
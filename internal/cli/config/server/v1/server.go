@@ -0,0 +1,98 @@
+package v1
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gota33/initializr"
+	"server/internal/cli/config"
+	"server/internal/server"
+)
+
+type Options struct {
+	IdleTimeout    string            `json:"idleTimeout"`
+	ReadTimeout    string            `json:"readTimeout"`
+	WriteTimeout   string            `json:"writeTimeout"`
+	RequestTimeout string            `json:"requestTimeout"`
+	RouteTimeouts  map[string]string `json:"routeTimeouts"`
+	BodyLimit      int               `json:"bodyLimit"`
+	Concurrency    int               `json:"concurrency"`
+	ProxyHeader    string            `json:"proxyHeader"`
+	TrustedProxies []string          `json:"trustedProxies"`
+	Prefork        bool              `json:"prefork"`
+	DrainDelay     string            `json:"drainDelay"`
+	SwaggerUI      bool              `json:"swaggerUI"`
+	TLS            TLSOptions        `json:"tls"`
+}
+
+type TLSOptions struct {
+	CertFile       string `json:"certFile"`
+	KeyFile        string `json:"keyFile"`
+	ClientCAFile   string `json:"clientCAFile"`
+	RequireClient  bool   `json:"requireClient"`
+	HTTP2          bool   `json:"http2"`
+	ReloadInterval string `json:"reloadInterval"`
+}
+
+// New reads listener options, other fields of the config are left to the caller.
+func New(res initializr.Resource, key string) (c server.Config, err error) {
+	opts := Options{
+		IdleTimeout:    "10s",
+		ReadTimeout:    "10s",
+		WriteTimeout:   "10s",
+		RequestTimeout: "10s",
+		DrainDelay:     "5s",
+		TLS:            TLSOptions{ReloadInterval: "1m"},
+	}
+	if err = config.Scan(res, key, &opts); err != nil {
+		return
+	}
+
+	// Forwarded addresses of untrusted clients would be taken as is
+	if opts.ProxyHeader != "" && len(opts.TrustedProxies) == 0 {
+		return c, fmt.Errorf("proxyHeader %q requires trustedProxies", opts.ProxyHeader)
+	}
+
+	c = server.Config{
+		BodyLimit:      opts.BodyLimit,
+		Concurrency:    opts.Concurrency,
+		ProxyHeader:    opts.ProxyHeader,
+		TrustedProxies: opts.TrustedProxies,
+		Prefork:        opts.Prefork,
+		SwaggerUI:      opts.SwaggerUI,
+		TLS: server.TLS{
+			CertFile:      opts.TLS.CertFile,
+			KeyFile:       opts.TLS.KeyFile,
+			ClientCAFile:  opts.TLS.ClientCAFile,
+			RequireClient: opts.TLS.RequireClient,
+			HTTP2:         opts.TLS.HTTP2,
+		},
+		RouteTimeouts: make(map[string]time.Duration, len(opts.RouteTimeouts)),
+	}
+	if c.IdleTimeout, err = time.ParseDuration(opts.IdleTimeout); err != nil {
+		return
+	}
+	if c.ReadTimeout, err = time.ParseDuration(opts.ReadTimeout); err != nil {
+		return
+	}
+	if c.WriteTimeout, err = time.ParseDuration(opts.WriteTimeout); err != nil {
+		return
+	}
+	if c.RequestTimeout, err = time.ParseDuration(opts.RequestTimeout); err != nil {
+		return
+	}
+	if c.DrainDelay, err = time.ParseDuration(opts.DrainDelay); err != nil {
+		return
+	}
+	if c.TLS.ReloadInterval, err = time.ParseDuration(opts.TLS.ReloadInterval); err != nil {
+		return
+	}
+	for route, str := range opts.RouteTimeouts {
+		var d time.Duration
+		if d, err = time.ParseDuration(str); err != nil {
+			return
+		}
+		c.RouteTimeouts[route] = d
+	}
+	return
+}
@@ -0,0 +1,25 @@
+package v1
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gota33/initializr"
+)
+
+func TestNewProxyHeader(t *testing.T) {
+	tests := map[string]bool{
+		`{"server": {}}`: false,
+		`{"server": {"proxyHeader": "X-Forwarded-For", "trustedProxies": ["10.0.0.0/8"]}}`: false,
+		`{"server": {"proxyHeader": "X-Forwarded-For"}}`:                                   true,
+	}
+	for cfg, wantErr := range tests {
+		res, err := initializr.FromJson(strings.NewReader(cfg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = New(res, "server"); (err != nil) != wantErr {
+			t.Errorf("New(%s) error = %v, wantErr %v", cfg, err, wantErr)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gota33/initializr"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"server/internal/cli/config"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+type Options struct {
+	ServiceName string  `json:"serviceName"`
+	Exporter    string  `json:"exporter"`
+	Endpoint    string  `json:"endpoint"`
+	Insecure    bool    `json:"insecure"`
+	SampleRate  float64 `json:"sampleRate"`
+}
+
+// New installs the global tracer provider and W3C trace context propagator.
+// Spans are still created with exporter "none", so IDs in logs stay correlated.
+func New(res initializr.Resource, key string) (close func(), err error) {
+	opts := Options{
+		ServiceName: "app",
+		Exporter:    ExporterNone,
+		SampleRate:  1,
+	}
+	if err = config.Scan(res, key, &opts); err != nil {
+		return
+	}
+
+	providerOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRate))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceNameKey.String(opts.ServiceName))),
+	}
+
+	var exporter sdktrace.SpanExporter
+	switch opts.Exporter {
+	case ExporterNone:
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		clientOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(opts.Endpoint)}
+		if opts.Insecure {
+			clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), clientOpts...)
+	default:
+		err = fmt.Errorf("unknown trace exporter: %q", opts.Exporter)
+	}
+	if err != nil {
+		return
+	}
+	if exporter != nil {
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exporter))
+	}
+
+	provider := sdktrace.NewTracerProvider(providerOpts...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logrus.WithError(err).Warn("OpenTelemetry error")
+	}))
+
+	// Nothing to flush without exporter, and shutdown fails with no span processor
+	if exporter == nil {
+		return func() {}, nil
+	}
+
+	close = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if closeErr := provider.Shutdown(ctx); closeErr != nil {
+			logrus.WithError(closeErr).Warn("Shutdown tracer provider error")
+		}
+	}
+	return
+}
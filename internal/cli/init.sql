@@ -28,3 +28,131 @@ create table if not exists cart
 );
 
 create index if not exists idx_cart on cart (customer_id, status);
+
+create table if not exists revision
+(
+    id          integer primary key autoincrement,
+    resource    text      not null,
+    operation   text      not null check (operation IN ('create', 'update', 'delete')),
+    actor       text      not null default '',
+    update_mask text      not null default '',
+    before_json text      null,
+    after_json  text      null,
+    create_time timestamp not null default current_timestamp
+);
+
+create index if not exists idx_revision on revision (resource, id);
+
+create table if not exists outbox
+(
+    id          integer primary key autoincrement,
+    type        text      not null,
+    resource    text      not null,
+    actor       text      not null default '',
+    update_mask text      not null default '',
+    data        text      not null,
+    status      text      not null default 'pending' check (status IN ('pending', 'delivered', 'dead')),
+    attempts    integer   not null default 0,
+    last_error  text      not null default '',
+    next_time   timestamp not null default current_timestamp,
+    create_time timestamp not null default current_timestamp
+);
+
+create index if not exists idx_outbox on outbox (status, next_time);
+
+create table if not exists outbox_sink
+(
+    event_id integer not null,
+    sink     text    not null,
+    primary key (event_id, sink),
+    foreign key (event_id) references outbox (id) on delete cascade
+);
+
+create table if not exists webhook
+(
+    id            integer primary key autoincrement,
+    url           text      not null check (length(url) > 0),
+    event_types   text      not null default '[]',
+    active        boolean   not null default true,
+    failure_count integer   not null default 0,
+    secret        text      not null,
+    owner         text      not null default '',
+    create_time   timestamp not null default current_timestamp
+);
+
+create index if not exists idx_webhook_owner on webhook (owner, id);
+
+create table if not exists webhook_delivery
+(
+    id          integer primary key autoincrement,
+    webhook_id  integer   not null,
+    event_id    integer   not null,
+    event_type  text      not null,
+    status_code integer   not null default 0,
+    error       text      not null default '',
+    success     boolean   not null,
+    latency_ms  integer   not null default 0,
+    create_time timestamp not null default current_timestamp,
+    foreign key (webhook_id) references webhook (id) on delete cascade
+);
+
+create index if not exists idx_webhook_delivery on webhook_delivery (webhook_id, event_id);
+
+create table if not exists operation
+(
+    id               integer primary key autoincrement,
+    type             text      not null,
+    request          text      null,
+    actor            text      not null default '',
+    request_id       text      not null default '',
+    status           text      not null default 'pending' check (status IN ('pending', 'running', 'done')),
+    done             boolean   not null default false,
+    cancel_requested boolean   not null default false,
+    owner            text      not null default '',
+    expire_time      timestamp null,
+    metadata         text      null,
+    response         text      null,
+    error            text      null,
+    create_time      timestamp not null default current_timestamp,
+    update_time      timestamp not null default current_timestamp
+);
+
+create index if not exists idx_operation on operation (status, id);
+create index if not exists idx_operation_actor on operation (actor, id);
+
+create table if not exists job_lease
+(
+    name        text primary key,
+    owner       text      not null,
+    last_time   timestamp not null,
+    expire_time timestamp not null
+);
+
+create table if not exists job_run
+(
+    id             integer primary key autoincrement,
+    job            text      not null,
+    owner          text      not null,
+    scheduled_time timestamp not null,
+    start_time     timestamp not null,
+    end_time       timestamp null,
+    success        boolean   not null default false,
+    error          text      not null default ''
+);
+
+create index if not exists idx_job_run on job_run (job, start_time);
+
+create table if not exists idempotency
+(
+    actor           text      not null,
+    idempotency_key text      not null,
+    fingerprint     text      not null,
+    status          integer   null,
+    content_type    text      not null default '',
+    body            blob      null,
+    create_time     timestamp not null default current_timestamp,
+    expire_time     timestamp not null,
+    primary key (actor, idempotency_key)
+);
+
+create index if not exists idx_idempotency on idempotency (expire_time);
@@ -0,0 +1,44 @@
+package route
+
+import "reflect"
+
+// BindingTags bind request fields to other parts of the request than the body, in
+// ascending precedence: defaults < body < cookie < header < form < query < param.
+// A field with several tags, e.g. `query:"pageSize" header:"X-Page-Size"`, takes
+// the value of the highest source present.
+var BindingTags = []string{"cookie", "header", "form", "query", "param"}
+
+// IsBound reports fields sent in other parts of the request than the body.
+func IsBound(f reflect.StructField) bool {
+	for _, tag := range BindingTags {
+		if f.Tag.Get(tag) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// EachField walks exported fields of struct t, promoting fields of embedded structs.
+// Index of f is the path from t, e.g. for reflect.Value.FieldByIndex.
+func EachField(t reflect.Type, fn func(f reflect.StructField)) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		eachField(t, nil, fn)
+	}
+}
+
+func eachField(t reflect.Type, index []int, fn func(f reflect.StructField)) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		f.Index = append(append([]int(nil), index...), i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			eachField(f.Type, f.Index, fn)
+			continue
+		}
+		if f.IsExported() {
+			fn(f)
+		}
+	}
+}
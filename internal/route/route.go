@@ -0,0 +1,29 @@
+// Package route describes typed routes of the API. It only depends on the
+// standard library, so clients can bind routes without linking the server.
+package route
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// Route is a typed route registered by the server.
+type Route struct {
+	Method string
+	// Path is the fiber route, e.g. "items/:itemID", or "items/:itemID:restore" of custom methods
+	Path      string
+	Operation string
+	// Stream routes send any number of Response, e.g. exports
+	Stream   bool
+	Request  reflect.Type
+	Response reflect.Type
+}
+
+// OperationName names the operation of a service method, e.g. "item.Service.Get"
+// of both item.Service.Get and srv.Get.
+func OperationName(method any) string {
+	name := runtime.FuncForPC(reflect.ValueOf(method).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	return name[strings.LastIndexByte(name, '/')+1:]
+}
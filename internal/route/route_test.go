@@ -0,0 +1,62 @@
+package route
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type service struct{}
+
+func (service) Get(context.Context, string) (string, error) { return "", nil }
+
+func TestOperationName(t *testing.T) {
+	var srv service
+	for _, method := range []any{service.Get, srv.Get} {
+		if got := OperationName(method); got != "route.service.Get" {
+			t.Errorf("OperationName = %q, want route.service.Get", got)
+		}
+	}
+}
+
+func TestEachField(t *testing.T) {
+	type Paging struct {
+		PageSize int `query:"pageSize"`
+		token    string
+	}
+	type request struct {
+		ID string `param:"id"`
+		Paging
+		Title string `json:"title"`
+	}
+
+	req := request{ID: "1", Paging: Paging{PageSize: 20}, Title: "a"}
+	v := reflect.ValueOf(req)
+
+	var names []string
+	var values []any
+	EachField(reflect.TypeOf(&req), func(f reflect.StructField) {
+		names = append(names, f.Name)
+		values = append(values, v.FieldByIndex(f.Index).Interface())
+	})
+	if want := []string{"ID", "PageSize", "Title"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("fields = %v, want %v", names, want)
+	}
+	if want := []any{"1", 20, "a"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %v, want %v", values, want)
+	}
+}
+
+func TestIsBound(t *testing.T) {
+	type request struct {
+		ID    string `param:"id"`
+		Size  int    `query:"size" json:"size"`
+		Title string `json:"title"`
+	}
+	typ := reflect.TypeOf(request{})
+	for i, want := range []bool{true, true, false} {
+		if got := IsBound(typ.Field(i)); got != want {
+			t.Errorf("IsBound(%s) = %v, want %v", typ.Field(i).Name, got, want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"math/rand"
+	"path"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gota33/errors"
+	"github.com/sirupsen/logrus"
+	"server/internal/service/auth"
+	"server/internal/service/trace"
+)
+
+// AccessLog configures access logs. Requests are logged at SampleRate (0 to 1),
+// server errors are always logged. Exclude holds path patterns, e.g. "/healthz".
+type AccessLog struct {
+	SampleRate float64
+	Exclude    []string
+}
+
+func (a AccessLog) excluded(p string) bool {
+	for _, pattern := range a.Exclude {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// accessLog writes one logrus entry per request. Errors are handled here,
+// so status and error code of the response are known when logging.
+func accessLog(a AccessLog) fiber.Handler {
+	return func(c *fiber.Ctx) (err error) {
+		if a.excluded(c.Path()) {
+			return c.Next()
+		}
+
+		start := time.Now()
+		chainErr := c.Next()
+
+		var code errors.StatusCode
+		if chainErr != nil {
+			code = errors.Code(translateError(c, chainErr))
+			if err = c.App().ErrorHandler(c, chainErr); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		if status < fiber.StatusInternalServerError && rand.Float64() >= a.SampleRate {
+			return nil
+		}
+
+		var (
+			ctx  = c.UserContext()
+			user auth.User
+		)
+		fields := logrus.Fields{
+			"method":    c.Method(),
+			"route":     c.Route().Path,
+			"status":    status,
+			"latencyMs": float64(time.Since(start).Microseconds()) / 1000,
+		}
+		// Reading a streamed body would buffer all of it, e.g. watch and export
+		if !c.Response().IsBodyStream() {
+			fields["bytes"] = len(c.Response().Body())
+		}
+		if user.FromContext(ctx) == nil {
+			fields["user"] = user.Subject
+		}
+		if chainErr != nil {
+			fields["code"] = code.Name()
+		}
+		trace.Logger(ctx).WithFields(fields).Info("Access")
+		return nil
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gota33/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func newAccessLogApp(a AccessLog) *fiber.App {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, ErrorHandler: errorHandler(false)})
+	app.Use(initUserContext, initTraceContext, accessLog(a))
+	app.Get("/healthz", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	app.Get("/items/:itemID", func(c *fiber.Ctx) error { return c.SendString("item") })
+	app.Get("/fail", func(c *fiber.Ctx) error { return fiber.ErrServiceUnavailable })
+	return app
+}
+
+func accessEntries(t *testing.T, app *fiber.App, path string) []logrus.Entry {
+	t.Helper()
+
+	hook := test.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(logrus.LevelHooks{})
+
+	if _, err := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil)); err != nil {
+		t.Fatal(err)
+	}
+	var entries []logrus.Entry
+	for _, e := range hook.AllEntries() {
+		if e.Message == "Access" {
+			entries = append(entries, *e)
+		}
+	}
+	return entries
+}
+
+func TestAccessLog(t *testing.T) {
+	app := newAccessLogApp(AccessLog{SampleRate: 1, Exclude: []string{"/healthz"}})
+
+	entries := accessEntries(t, app, "/items/42")
+	if len(entries) != 1 {
+		t.Fatalf("entries = %v, want one", entries)
+	}
+	fields := entries[0].Data
+	if fields["method"] != fiber.MethodGet || fields["route"] != "/items/:itemID" || fields["status"] != fiber.StatusOK ||
+		fields["bytes"] != len("item") || fields["requestId"] == "" {
+		t.Errorf("fields = %v", fields)
+	}
+	if _, ok := fields["code"]; ok {
+		t.Errorf("code = %v without error", fields["code"])
+	}
+
+	if entries = accessEntries(t, app, "/fail"); len(entries) != 1 ||
+		entries[0].Data["status"] != fiber.StatusServiceUnavailable || entries[0].Data["code"] != errors.Unavailable.Name() {
+		t.Errorf("entries of error = %v", entries)
+	}
+	if entries = accessEntries(t, app, "/healthz"); len(entries) != 0 {
+		t.Errorf("entries of excluded path = %v", entries)
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	app := newAccessLogApp(AccessLog{})
+
+	if entries := accessEntries(t, app, "/items/42"); len(entries) != 0 {
+		t.Errorf("entries = %v, want none at sample rate 0", entries)
+	}
+	// Server errors are always logged
+	if entries := accessEntries(t, app, "/fail"); len(entries) != 1 {
+		t.Errorf("entries of error = %v, want one", entries)
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"runtime/debug"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/pprof"
+	"github.com/gota33/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	endpointBuildInfo = "buildinfo"
+	endpointLogLevel  = "loglevel"
+)
+
+// newAdmin serves operational endpoints apart from business routes, without auth.
+// There's no write timeout, so CPU profiles and traces can run longer.
+func newAdmin(c Config, h *health) *fiber.App {
+	admin := fiber.New(fiber.Config{
+		IdleTimeout:           c.IdleTimeout,
+		ReadTimeout:           c.ReadTimeout,
+		ErrorHandler:          errorHandler(c.Debug),
+		DisableStartupMessage: true,
+	})
+
+	admin.Use(pprof.New())
+	mountOps(admin, h)
+	admin.Get(endpointBuildInfo, buildInfo(c.Name, c.Version))
+	admin.Get(endpointLogLevel, logLevel)
+	admin.Put(endpointLogLevel, setLogLevel)
+	return admin
+}
+
+// mountOps mounts health and metrics endpoints, on the public app if there's no admin listener.
+func mountOps(r fiber.Router, h *health) {
+	r.Get(endpointHealth, live())
+	r.Get(endpointLive, live())
+	r.Get(endpointReady, h.ready())
+	r.Get(endpointMetrics, metrics())
+}
+
+type BuildInfo struct {
+	Name      string            `json:"name"`
+	Version   string            `json:"version"`
+	GoVersion string            `json:"goVersion"`
+	Path      string            `json:"path,omitempty"`
+	Settings  map[string]string `json:"settings,omitempty"`
+}
+
+func buildInfo(name, version string) fiber.Handler {
+	res := BuildInfo{Name: name, Version: version}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		res.GoVersion = info.GoVersion
+		res.Path = info.Path
+		res.Settings = make(map[string]string, len(info.Settings))
+		for _, s := range info.Settings {
+			res.Settings[s.Key] = s.Value
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		return c.JSON(res)
+	}
+}
+
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+func logLevel(c *fiber.Ctx) error {
+	return c.JSON(LogLevel{Level: logrus.GetLevel().String()})
+}
+
+// setLogLevel changes the level at runtime, e.g. `{"level": "debug"}`.
+func setLogLevel(c *fiber.Ctx) (err error) {
+	var (
+		req LogLevel
+		lvl logrus.Level
+	)
+	if err = c.BodyParser(&req); err != nil {
+		return
+	}
+	if lvl, err = logrus.ParseLevel(req.Level); err != nil {
+		return errors.WithBadRequest(err, errors.BadRequest{
+			FieldViolations: []errors.FieldViolation{{Field: "level", Description: err.Error()}},
+		})
+	}
+
+	logrus.SetLevel(lvl)
+	logrus.Infof("Log level changed to %s", lvl)
+	return logLevel(c)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+func TestAdminEndpoints(t *testing.T) {
+	h := &health{}
+	h.Register("db", func(ctx context.Context) error { return nil })
+	admin := newAdmin(Config{Name: "server", Version: "v1.2.3"}, h)
+
+	for _, target := range []string{"/healthz", "/livez", "/readyz", "/metrics", "/debug/pprof/"} {
+		res, err := admin.Test(httptest.NewRequest(fiber.MethodGet, target, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("GET %s = %d, want 200", target, res.StatusCode)
+		}
+	}
+
+	res, err := admin.Test(httptest.NewRequest(fiber.MethodGet, "/buildinfo", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info BuildInfo
+	if err = json.NewDecoder(res.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "server" || info.Version != "v1.2.3" || info.GoVersion == "" {
+		t.Errorf("build info = %+v", info)
+	}
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	defer logrus.SetLevel(logrus.GetLevel())
+	logrus.SetLevel(logrus.InfoLevel)
+
+	admin := newAdmin(Config{}, &health{})
+	put := func(body string) *http.Response {
+		req := httptest.NewRequest(fiber.MethodPut, "/loglevel", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		res, err := admin.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := put(`{"level":"debug"}`); res.StatusCode != http.StatusOK || logrus.GetLevel() != logrus.DebugLevel {
+		t.Errorf("set debug = %d, level %s", res.StatusCode, logrus.GetLevel())
+	}
+	if res := put(`{"level":"loud"}`); res.StatusCode != http.StatusBadRequest || logrus.GetLevel() != logrus.DebugLevel {
+		t.Errorf("set an unknown level = %d, level %s", res.StatusCode, logrus.GetLevel())
+	}
+
+	res, err := admin.Test(httptest.NewRequest(fiber.MethodGet, "/loglevel", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(res.Body); string(body) != `{"level":"debug"}` {
+		t.Errorf("level = %s, want debug", body)
+	}
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"encoding"
+	"fmt"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gota33/errors"
+	"server/internal/route"
+)
+
+const tagDefault = "default"
+
+// bindingSource reads values of a tag from the request, ok is false if absent.
+type bindingSource func(c *fiber.Ctx, name string) (values []string, ok bool)
+
+// bindingSources bind fields by route.BindingTags after the body is decoded.
+var bindingSources = map[string]bindingSource{
+	"cookie": cookieValues,
+	"header": headerValues,
+	"form":   formValues,
+	"query":  queryValues,
+	"param":  paramValues,
+}
+
+var (
+	typeDuration   = reflect.TypeOf(time.Duration(0))
+	typeFileHeader = reflect.TypeOf((*multipart.FileHeader)(nil))
+	typeUnmarshal  = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// bindDefaults sets fields tagged like `default:"20"`, before anything is parsed into req.
+func bindDefaults(req any) (err error) {
+	rv := reflect.ValueOf(req).Elem()
+	route.EachField(rv.Type(), func(f reflect.StructField) {
+		v := rv.FieldByIndex(f.Index)
+		value, ok := f.Tag.Lookup(tagDefault)
+		if !ok || err != nil {
+			return
+		}
+		if setErr := setValue(v, splitValues([]string{value}, v.Type())); setErr != nil {
+			err = fmt.Errorf("default of %s: %w", f.Name, setErr)
+		}
+	})
+	return
+}
+
+// bindRequest sets tagged fields from every binding source, values that can't be
+// converted are reported as field violations named after the source, e.g. "query.pageSize".
+func bindRequest(c *fiber.Ctx, req any) error {
+	var violations []errors.FieldViolation
+	rv := reflect.ValueOf(req).Elem()
+	route.EachField(rv.Type(), func(f reflect.StructField) {
+		v := rv.FieldByIndex(f.Index)
+		for _, tag := range route.BindingTags {
+			name := f.Tag.Get(tag)
+			if name == "" {
+				continue
+			}
+
+			var err error
+			if tag == "form" && isFileType(v.Type()) {
+				err = bindFiles(c, name, v)
+			} else if values, ok := bindingSources[tag](c, name); ok {
+				err = setValue(v, splitValues(values, v.Type()))
+			}
+			if err != nil {
+				violations = append(violations, errors.FieldViolation{
+					Field:       tag + "." + name,
+					Description: err.Error(),
+				})
+			}
+		}
+	})
+
+	if len(violations) > 0 {
+		return errors.WithBadRequest(fmt.Errorf("invalid request: %s", violations[0].Description),
+			errors.BadRequest{FieldViolations: violations})
+	}
+	return nil
+}
+
+func cookieValues(c *fiber.Ctx, name string) ([]string, bool) {
+	value := c.Request().Header.Cookie(name)
+	return []string{string(value)}, value != nil
+}
+
+func headerValues(c *fiber.Ctx, name string) ([]string, bool) {
+	value := c.Request().Header.Peek(name)
+	return []string{string(value)}, value != nil
+}
+
+func formValues(c *fiber.Ctx, name string) (values []string, ok bool) {
+	switch {
+	case isMediaType(c, fiber.MIMEApplicationForm):
+		values = argValues(c.Request().PostArgs().PeekMulti(name))
+	case isMediaType(c, fiber.MIMEMultipartForm):
+		if form, err := c.MultipartForm(); err == nil {
+			values = form.Value[name]
+		}
+	}
+	return values, len(values) > 0
+}
+
+func queryValues(c *fiber.Ctx, name string) ([]string, bool) {
+	values := argValues(c.Context().QueryArgs().PeekMulti(name))
+	return values, len(values) > 0
+}
+
+func paramValues(c *fiber.Ctx, name string) ([]string, bool) {
+	params := c.Route().Params
+	for i, param := range params {
+		if param != name {
+			continue
+		}
+		value := c.Params(name)
+		// Custom methods end the last segment with their verb, e.g. "1:restore"
+		if verb, ok := c.Locals(localVerb).(string); ok && i == len(params)-1 {
+			value = strings.TrimSuffix(value, ":"+verb)
+		}
+		return []string{value}, true
+	}
+	return nil, false
+}
+
+func argValues(args [][]byte) []string {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = string(arg)
+	}
+	return values
+}
+
+// bindFiles sets uploads of a multipart form to *multipart.FileHeader or a slice of them.
+func bindFiles(c *fiber.Ctx, name string, v reflect.Value) (err error) {
+	if !isMediaType(c, fiber.MIMEMultipartForm) {
+		return
+	}
+	var form *multipart.Form
+	if form, err = c.MultipartForm(); err != nil {
+		return
+	}
+	files := form.File[name]
+	if len(files) == 0 {
+		return
+	}
+
+	if v.Type() == typeFileHeader {
+		v.Set(reflect.ValueOf(files[0]))
+		return
+	}
+	v.Set(reflect.ValueOf(files))
+	return
+}
+
+func isFileType(t reflect.Type) bool {
+	return t == typeFileHeader || (t.Kind() == reflect.Slice && t.Elem() == typeFileHeader)
+}
+
+func isMediaType(c *fiber.Ctx, mediaType string) bool {
+	value, _, _ := strings.Cut(c.Get(fiber.HeaderContentType), ";")
+	return strings.EqualFold(strings.TrimSpace(value), mediaType)
+}
+
+// splitValues splits a single comma separated value of slice fields, e.g. "?ids=1,2".
+func splitValues(values []string, t reflect.Type) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if len(values) == 1 && t.Kind() == reflect.Slice && !reflect.PointerTo(t).Implements(typeUnmarshal) {
+		return strings.Split(values[0], ",")
+	}
+	return values
+}
+
+// setValue converts values to the type of v, slices take every value and others the last one.
+func setValue(v reflect.Value, values []string) (err error) {
+	if len(values) == 0 {
+		return
+	}
+
+	switch {
+	case v.Kind() == reflect.Pointer:
+		elem := reflect.New(v.Type().Elem())
+		if err = setValue(elem.Elem(), values); err == nil {
+			v.Set(elem)
+		}
+		return
+	case reflect.PointerTo(v.Type()).Implements(typeUnmarshal):
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(values[len(values)-1]))
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err = setValue(slice.Index(i), []string{strings.TrimSpace(value)}); err != nil {
+				return
+			}
+		}
+		v.Set(slice)
+		return
+	default:
+		return setScalar(v, values[len(values)-1])
+	}
+}
+
+func setScalar(v reflect.Value, value string) (err error) {
+	if value == "" && v.Kind() != reflect.String {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Slice:
+		v.SetBytes([]byte(value))
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(value); err == nil {
+			v.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == typeDuration {
+			var d time.Duration
+			if d, err = time.ParseDuration(value); err == nil {
+				v.SetInt(int64(d))
+			}
+			break
+		}
+		var n int64
+		if n, err = strconv.ParseInt(value, 10, v.Type().Bits()); err == nil {
+			v.SetInt(n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		if n, err = strconv.ParseUint(value, 10, v.Type().Bits()); err == nil {
+			v.SetUint(n)
+		}
+	case reflect.Float32, reflect.Float64:
+		var n float64
+		if n, err = strconv.ParseFloat(value, v.Type().Bits()); err == nil {
+			v.SetFloat(n)
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	if err != nil {
+		err = fmt.Errorf("invalid %s %q", v.Type(), value)
+	}
+	return
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type bindingRequest struct {
+	Size int    `json:"size" header:"X-Size" query:"size" default:"5"`
+	Name string `json:"-" param:"name"`
+	Part string `json:"-" param:"part"`
+}
+
+type bindingResult struct {
+	Size int    `json:"size"`
+	Name string `json:"name"`
+	Part string `json:"part"`
+}
+
+// bind serves route, or its custom methods if there are verbs, answering with the parsed request.
+func bind(t *testing.T, route string, verbs []string, method, target, body string, header map[string]string) (got bindingResult) {
+	t.Helper()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	parse := func(c *fiber.Ctx) error {
+		var req bindingRequest
+		if err := parseRequest(c, &req); err != nil {
+			return err
+		}
+		return c.JSON(bindingResult{Size: req.Size, Name: req.Name, Part: req.Part})
+	}
+	if len(verbs) == 0 {
+		app.Add(method, route, parse)
+	} else {
+		m := customMethods{}
+		for _, verb := range verbs {
+			m[verb] = endpoint{handle: parse}
+		}
+		app.Post(route, m.handle)
+	}
+
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	for key, value := range header {
+		r.Header.Set(key, value)
+	}
+	res, err := app.Test(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != fiber.StatusOK {
+		t.Fatalf("%s %s = %d", method, target, res.StatusCode)
+	}
+	if err = json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestBindingPrecedence(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		target string
+		body   string
+		header map[string]string
+		want   int
+	}{
+		{name: "default", target: "/things/1", want: 5},
+		{name: "body", target: "/things/1", body: `{"size":6}`, want: 6},
+		{name: "header", target: "/things/1", body: `{"size":6}`, header: map[string]string{"X-Size": "7"}, want: 7},
+		{name: "query", target: "/things/1?size=8", body: `{"size":6}`, header: map[string]string{"X-Size": "7"}, want: 8},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := bind(t, "/things/:name", nil, fiber.MethodPut, tc.target, tc.body, tc.header)
+			if got.Size != tc.want {
+				t.Errorf("size = %d, want %d", got.Size, tc.want)
+			}
+		})
+	}
+}
+
+func TestBindingParamVerb(t *testing.T) {
+	restore := []string{"restore"}
+	for _, tc := range []struct {
+		name   string
+		route  string
+		verbs  []string
+		method string
+		target string
+		want   bindingResult
+	}{
+		{name: "colon", route: "/things/:name", method: fiber.MethodGet,
+			target: "/things/a:b", want: bindingResult{Size: 5, Name: "a:b"}},
+		{name: "not custom", route: "/things/:name", method: fiber.MethodGet,
+			target: "/things/a:restore", want: bindingResult{Size: 5, Name: "a:restore"}},
+		{name: "custom", route: "/things/:name", verbs: restore, method: fiber.MethodPost,
+			target: "/things/a:b:restore", want: bindingResult{Size: 5, Name: "a:b"}},
+		{name: "parent", route: "/things/:name/parts/:part", verbs: restore, method: fiber.MethodPost,
+			target: "/things/a:b/parts/c:restore", want: bindingResult{Size: 5, Name: "a:b", Part: "c"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := bind(t, tc.route, tc.verbs, tc.method, tc.target, "", nil)
+			if got != tc.want {
+				t.Errorf("request = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,431 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gota33/errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"server/internal/service/entity"
+)
+
+const (
+	mimeMsgPack   = "application/msgpack"
+	mimeProtoJSON = "application/x-protobuf+json"
+	mimeCSV       = "text/csv"
+
+	headerNextPageToken = "X-Next-Page-Token"
+)
+
+// errUnsupportedType is returned by codecs for types they can't encode or decode.
+var errUnsupportedType = errors.New("unsupported type")
+
+// Codec encodes responses and decodes requests of its media types.
+type Codec interface {
+	// MediaTypes lists the media types handled by the codec.
+	MediaTypes() []string
+	// Supports reports whether values of t are encoded and decoded by the codec.
+	Supports(t reflect.Type) bool
+	Marshal(v any, opts EncodeOptions) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// EncodeOptions are taken from the request, e.g. the readMask of list requests.
+type EncodeOptions struct {
+	ReadMask []string
+}
+
+var (
+	codecsMu sync.RWMutex
+	// codecs are negotiated in order, the first one is used without Accept
+	codecs = []Codec{
+		jsonCodec{},
+		msgpackCodec{},
+		newProtoJSONCodec(
+			protoType(itemToProto, itemFromProto),
+			protoType(listItemsToProto, nil),
+		),
+		csvCodec{},
+	}
+)
+
+// RegisterCodec adds c to the codecs negotiated by handlers, it takes
+// precedence over built-in codecs of the same media types.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs = append([]Codec{c}, codecs...)
+}
+
+// negotiate picks the codec of the Accept header among those supporting t,
+// fiber.ErrNotAcceptable if none is acceptable.
+func negotiate(c *fiber.Ctx, t reflect.Type) (codec Codec, mediaType string, err error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	var offers []string
+	byType := map[string]Codec{}
+	for _, codec := range codecs {
+		if !codec.Supports(t) {
+			continue
+		}
+		for _, mediaType := range codec.MediaTypes() {
+			if _, ok := byType[mediaType]; !ok {
+				byType[mediaType] = codec
+				offers = append(offers, mediaType)
+			}
+		}
+	}
+
+	c.Vary(fiber.HeaderAccept)
+	if mediaType = c.Accepts(offers...); mediaType == "" {
+		err = fiber.NewError(fiber.StatusNotAcceptable,
+			fmt.Sprintf("%s is not acceptable, available: %s", c.Get(fiber.HeaderAccept), strings.Join(offers, ", ")))
+		return
+	}
+	return byType[mediaType], mediaType, nil
+}
+
+// bodyCodec finds the codec of the Content-Type header supporting t.
+func bodyCodec(c *fiber.Ctx, t reflect.Type) (codec Codec, ok bool) {
+	mediaType, _, _ := strings.Cut(c.Get(fiber.HeaderContentType), ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	for _, codec = range codecs {
+		for _, m := range codec.MediaTypes() {
+			if m == mediaType && codec.Supports(t) {
+				return codec, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// bodyParser decodes the body by codecs, falling back to forms and XML parsed by fiber.
+// Bodies of other media types are rejected with 415, and those without a media
+// type are ignored, as they were before codecs.
+func bodyParser(c *fiber.Ctx, req any) (err error) {
+	if len(c.Body()) == 0 {
+		return
+	}
+	if codec, ok := bodyCodec(c, reflect.TypeOf(req).Elem()); ok {
+		if err = codec.Unmarshal(c.Body(), req); errors.Is(err, errUnsupportedType) {
+			return fiber.NewError(fiber.StatusUnsupportedMediaType, err.Error())
+		} else if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		return
+	}
+	if err = c.BodyParser(req); errors.Is(err, fiber.ErrUnprocessableEntity) {
+		if len(c.Request().Header.ContentType()) == 0 {
+			return nil
+		}
+		err = fiber.NewError(fiber.StatusUnsupportedMediaType,
+			fmt.Sprintf("unsupported content type %q", c.Get(fiber.HeaderContentType)))
+	}
+	return
+}
+
+// send encodes res by the negotiated codec.
+func send(c *fiber.Ctx, res any, opts EncodeOptions) (err error) {
+	var (
+		codec     Codec
+		mediaType string
+		body      []byte
+	)
+	if codec, mediaType, err = negotiate(c, reflect.TypeOf(res)); err != nil {
+		return
+	}
+	if body, err = codec.Marshal(res, opts); errors.Is(err, errUnsupportedType) {
+		return fiber.NewError(fiber.StatusNotAcceptable, err.Error())
+	} else if err != nil {
+		return
+	}
+	if token, ok := nextPageToken(res); ok && mediaType == mimeCSV {
+		c.Set(headerNextPageToken, token)
+	}
+	c.Set(fiber.HeaderContentType, mediaType)
+	return c.Send(body)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) MediaTypes() []string       { return []string{mimeJSON} }
+func (jsonCodec) Supports(reflect.Type) bool { return true }
+
+func (jsonCodec) Marshal(v any, _ EncodeOptions) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// msgpackCodec names fields like JSON, so clients share models of both.
+type msgpackCodec struct{}
+
+func (msgpackCodec) MediaTypes() []string       { return []string{mimeMsgPack, "application/x-msgpack"} }
+func (msgpackCodec) Supports(reflect.Type) bool { return true }
+
+func (msgpackCodec) Marshal(v any, _ EncodeOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// protoJSONCodec encodes types served over gRPC by the JSON mapping of their messages,
+// e.g. int64 fields as strings.
+type protoJSONCodec struct {
+	types map[reflect.Type]protoConverter
+}
+
+type protoConverter struct {
+	t    reflect.Type
+	to   func(v any) proto.Message
+	from func(data []byte, v any) error
+}
+
+// protoType converts T from and to M, from is nil for types only sent as responses.
+func protoType[T any, M proto.Message](to func(T) M, from func(M) T) (pc protoConverter) {
+	pc.t = reflect.TypeOf((*T)(nil)).Elem()
+	pc.to = func(v any) proto.Message { return to(v.(T)) }
+	if from != nil {
+		pc.from = func(data []byte, v any) (err error) {
+			var zero M
+			m := zero.ProtoReflect().New().Interface().(M)
+			if err = protojson.Unmarshal(data, m); err == nil {
+				*v.(*T) = from(m)
+			}
+			return
+		}
+	}
+	return
+}
+
+func newProtoJSONCodec(converters ...protoConverter) protoJSONCodec {
+	p := protoJSONCodec{types: make(map[reflect.Type]protoConverter, len(converters))}
+	for _, pc := range converters {
+		p.types[pc.t] = pc
+	}
+	return p
+}
+
+func (p protoJSONCodec) MediaTypes() []string { return []string{mimeProtoJSON} }
+
+func (p protoJSONCodec) Supports(t reflect.Type) bool {
+	_, ok := p.types[t]
+	return ok
+}
+
+func (p protoJSONCodec) Marshal(v any, _ EncodeOptions) ([]byte, error) {
+	pc, ok := p.types[reflect.TypeOf(v)]
+	if !ok {
+		return nil, errUnsupportedType
+	}
+	return protojson.Marshal(pc.to(v))
+}
+
+func (p protoJSONCodec) Unmarshal(data []byte, v any) error {
+	pc, ok := p.types[reflect.TypeOf(v).Elem()]
+	if !ok || pc.from == nil {
+		return errUnsupportedType
+	}
+	return pc.from(data, v)
+}
+
+// csvCodec encodes list responses as one row per resource, with a header of
+// JSON field names. Columns are selected by the readMask of the request.
+type csvCodec struct{}
+
+var typeListResponseFragment = reflect.TypeOf(entity.ListResponseFragment{})
+
+func (csvCodec) MediaTypes() []string { return []string{mimeCSV} }
+
+func (csvCodec) Supports(t reflect.Type) bool {
+	_, ok := listField(t)
+	return ok
+}
+
+func (csvCodec) Marshal(v any, opts EncodeOptions) (data []byte, err error) {
+	rv := reflect.ValueOf(v)
+	index, ok := listField(rv.Type())
+	if !ok {
+		return nil, errUnsupportedType
+	}
+	list := rv.Field(index)
+
+	var (
+		columns []string
+		record  []string
+	)
+	if columns, err = csvColumns(list.Type().Elem(), opts.ReadMask); err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err = w.Write(columns); err != nil {
+		return
+	}
+	for i := 0; i < list.Len(); i++ {
+		if record, err = csvRecord(list.Index(i).Interface(), columns); err != nil {
+			return
+		}
+		if err = w.Write(record); err != nil {
+			return
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func (csvCodec) Unmarshal([]byte, any) error {
+	return errUnsupportedType
+}
+
+// csvColumns lists JSON field names of struct t, or those selected by readMask.
+func csvColumns(t reflect.Type, readMask []string) (columns []string, err error) {
+	columns = jsonNames(t)
+	if len(readMask) == 0 {
+		return
+	}
+
+	var violations []errors.FieldViolation
+	for _, name := range readMask {
+		if !contains(columns, name) {
+			violations = append(violations, errors.FieldViolation{
+				Field:       "readMask",
+				Description: fmt.Sprintf("unknown field %q, available: %s", name, strings.Join(columns, ", ")),
+			})
+		}
+	}
+	if len(violations) > 0 {
+		return nil, errors.WithBadRequest(fmt.Errorf("invalid readMask"), errors.BadRequest{FieldViolations: violations})
+	}
+	return readMask, nil
+}
+
+// csvRecord formats fields of v in the order of columns, strings as is and other values in JSON.
+// Strings spreadsheets would take for formulas are escaped, see entity.EscapeCSVCell.
+func csvRecord(v any, columns []string) (record []string, err error) {
+	var (
+		raw    []byte
+		fields map[string]json.RawMessage
+	)
+	if raw, err = json.Marshal(v); err != nil {
+		return
+	}
+	if err = json.Unmarshal(raw, &fields); err != nil {
+		return
+	}
+
+	record = make([]string, len(columns))
+	for i, name := range columns {
+		record[i] = csvCell(fields[name])
+	}
+	return
+}
+
+// listField finds the resources of a list response, which embeds
+// entity.ListResponseFragment and holds resources in a slice of structs.
+func listField(t reflect.Type) (index int, ok bool) {
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	paged := false
+	index = -1
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		switch {
+		case f.Anonymous && f.Type == typeListResponseFragment:
+			paged = true
+		case f.IsExported() && f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.Struct:
+			if index < 0 {
+				index = i
+			}
+		}
+	}
+	return index, paged && index >= 0
+}
+
+// jsonNames lists JSON field names of struct t in order, like encoding/json marshals them.
+func jsonNames(t reflect.Type) (names []string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for _, embedded := range jsonNames(f.Type) {
+				if !contains(names, embedded) {
+					names = append(names, embedded)
+				}
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+func csvCell(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if raw[0] == '"' && json.Unmarshal(raw, &s) == nil {
+		return entity.EscapeCSVCell(s)
+	}
+	return string(raw)
+}
+
+func nextPageToken(res any) (token string, ok bool) {
+	rv := reflect.ValueOf(res)
+	if rv.Kind() != reflect.Struct {
+		return
+	}
+	if f := rv.FieldByName(typeListResponseFragment.Name()); f.IsValid() && f.Type() == typeListResponseFragment {
+		token = f.Interface().(entity.ListResponseFragment).NextPageToken
+		return token, token != ""
+	}
+	return
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCSVRecordEscapesFormulas(t *testing.T) {
+	type row struct {
+		Title string `json:"title"`
+		Num   int    `json:"num"`
+	}
+	tests := map[string]string{
+		"plain":             "plain",
+		"=HYPERLINK(\"x\")": "'=HYPERLINK(\"x\")",
+		"+1":                "'+1",
+		"-1":                "'-1",
+		"@SUM(A1)":          "'@SUM(A1)",
+		"\t=1":              "'\t=1",
+		"'=1":               "''=1",
+		"'quoted":           "'quoted",
+		"mid=dle":           "mid=dle",
+	}
+	for title, want := range tests {
+		record, err := csvRecord(row{Title: title, Num: -1}, []string{"title", "num"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record[0] != want {
+			t.Errorf("cell of %q = %q, want %q", title, record[0], want)
+		}
+		if record[1] != "-1" {
+			t.Errorf("cell of number = %q, want -1", record[1])
+		}
+	}
+}
+
+func TestBodyParserContentType(t *testing.T) {
+	type request struct {
+		Title string `json:"title"`
+	}
+	app := fiber.New()
+	app.Post("/", func(c *fiber.Ctx) error {
+		var req request
+		if err := bodyParser(c, &req); err != nil {
+			return err
+		}
+		return c.SendString(req.Title)
+	})
+
+	tests := []struct {
+		contentType string
+		status      int
+		body        string
+	}{
+		{"application/json", http.StatusOK, "a"},
+		{"", http.StatusOK, ""},
+		{"text/plain", http.StatusUnsupportedMediaType, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"title":"a"}`))
+		if tt.contentType != "" {
+			req.Header.Set(fiber.HeaderContentType, tt.contentType)
+		}
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(strings.Builder)
+		_, _ = io.Copy(buf, res.Body)
+		if res.StatusCode != tt.status || tt.status == http.StatusOK && buf.String() != tt.body {
+			t.Errorf("content type %q: got %d %q, want %d %q", tt.contentType, res.StatusCode, buf, tt.status, tt.body)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const localTimeouts = "timeouts"
+
+type timeouts struct {
+	request time.Duration
+	write   time.Duration
+	routes  map[string]time.Duration
+}
+
+// initDeadline keeps timeouts for handler, the route template is only known
+// once the request is matched.
+func initDeadline(request, write time.Duration, routes map[string]time.Duration) fiber.Handler {
+	t := timeouts{request: request, write: write, routes: routes}
+	return func(c *fiber.Ctx) error {
+		c.Locals(localTimeouts, t)
+		return c.Next()
+	}
+}
+
+// withDeadline derives the context passed to services, e.g. "GET /items/:itemID"
+// may override the default request timeout.
+func withDeadline(c *fiber.Ctx) (context.Context, context.CancelFunc) {
+	t, _ := c.Locals(localTimeouts).(timeouts)
+
+	d := t.request
+	if override, ok := t.routes[c.Method()+" "+c.Route().Path]; ok {
+		d = override
+	}
+	if d <= 0 {
+		return context.WithCancel(c.UserContext())
+	}
+	return context.WithTimeout(c.UserContext(), d)
+}
+
+// withStreamDeadline derives the context of streams, only limited by timeouts of their
+// routes since streams last as long as they have something to send, and cancelled
+// once the client disconnects, see withDisconnect.
+func withStreamDeadline(c *fiber.Ctx) (context.Context, context.CancelFunc) {
+	ctx, cancel := withDisconnect(c)
+	t, _ := c.Locals(localTimeouts).(timeouts)
+	if d, ok := t.routes[c.Method()+" "+c.Route().Path]; ok && d > 0 {
+		ctx, cancelTimeout := context.WithTimeout(ctx, d)
+		return ctx, func() {
+			cancelTimeout()
+			cancel()
+		}
+	}
+	return ctx, cancel
+}
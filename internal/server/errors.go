@@ -0,0 +1,413 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/go-sql-driver/mysql"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gota33/errors"
+	"github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+	"server/internal/service/trace"
+)
+
+const localStack = "stack"
+
+// retryDelay is suggested to clients on transient errors like a locked database.
+const retryDelay = time.Second
+
+// httpStatus maps HTTP statuses produced by fiber and its middlewares to codes,
+// codes map back to HTTP by errors.StatusCode.Http. Each mapping attaches
+// the detail type defined for the code by google.rpc.
+var httpStatus = map[int]func(c *fiber.Ctx, cause error) error{
+	http.StatusBadRequest: func(c *fiber.Ctx, cause error) error {
+		return errors.WithBadRequest(cause, errors.BadRequest{
+			FieldViolations: []errors.FieldViolation{{Field: "request", Description: cause.Error()}},
+		})
+	},
+	http.StatusUnauthorized: func(c *fiber.Ctx, cause error) error {
+		return errors.WithUnauthenticated(cause, errorInfo(c, "UNAUTHENTICATED"))
+	},
+	http.StatusForbidden: func(c *fiber.Ctx, cause error) error {
+		return errors.WithPermissionDenied(cause, errorInfo(c, "PERMISSION_DENIED"))
+	},
+	http.StatusNotFound: func(c *fiber.Ctx, cause error) error {
+		return errors.WithNotFound(cause, errors.ResourceInfo{ResourceName: c.Path()})
+	},
+	http.StatusMethodNotAllowed: func(c *fiber.Ctx, cause error) error {
+		return errors.WithUnimplemented(cause)
+	},
+	http.StatusNotAcceptable: func(c *fiber.Ctx, cause error) error {
+		return errors.WithBadRequest(cause, headerViolation(fiber.HeaderAccept, cause))
+	},
+	http.StatusRequestTimeout: func(c *fiber.Ctx, cause error) error {
+		return errors.WithDeadlineExceeded(cause, errors.DebugInfo{Detail: cause.Error()})
+	},
+	http.StatusConflict: func(c *fiber.Ctx, cause error) error {
+		return errors.WithAborted(cause, errorInfo(c, "CONFLICT"))
+	},
+	http.StatusPreconditionFailed: func(c *fiber.Ctx, cause error) error {
+		return errors.WithFailedPrecondition(cause, errors.PreconditionFailure{
+			Violations: []errors.TypedViolation{{Type: "HTTP", Subject: c.Path(), Description: cause.Error()}},
+		})
+	},
+	http.StatusRequestEntityTooLarge: func(c *fiber.Ctx, cause error) error {
+		return errors.WithOutOfRange(cause, errors.BadRequest{
+			FieldViolations: []errors.FieldViolation{{Field: "body", Description: cause.Error()}},
+		})
+	},
+	http.StatusUnsupportedMediaType: func(c *fiber.Ctx, cause error) error {
+		return errors.WithBadRequest(cause, headerViolation(fiber.HeaderContentType, cause))
+	},
+	http.StatusRequestedRangeNotSatisfiable: func(c *fiber.Ctx, cause error) error {
+		return errors.WithOutOfRange(cause, headerViolation(fiber.HeaderRange, cause))
+	},
+	http.StatusUnprocessableEntity: func(c *fiber.Ctx, cause error) error {
+		return errors.WithBadRequest(cause, errors.BadRequest{
+			FieldViolations: []errors.FieldViolation{{Field: "body", Description: cause.Error()}},
+		})
+	},
+	http.StatusTooManyRequests: func(c *fiber.Ctx, cause error) error {
+		return errors.WithResourceExhausted(cause, errors.QuotaFailure{
+			Violations: []errors.Violation{{Subject: c.IP(), Description: cause.Error()}},
+		})
+	},
+	499: func(c *fiber.Ctx, cause error) error {
+		return errors.WithCancelled(cause)
+	},
+	http.StatusInternalServerError: func(c *fiber.Ctx, cause error) error {
+		return errors.WithInternal(cause, errors.DebugInfo{Detail: cause.Error()})
+	},
+	http.StatusNotImplemented: func(c *fiber.Ctx, cause error) error {
+		return errors.WithUnimplemented(cause)
+	},
+	http.StatusBadGateway: func(c *fiber.Ctx, cause error) error {
+		return errors.WithUnavailable(cause, errors.DebugInfo{Detail: cause.Error()})
+	},
+	http.StatusServiceUnavailable: func(c *fiber.Ctx, cause error) error {
+		return errors.Annotate(errors.WithUnavailable(cause, errors.DebugInfo{Detail: cause.Error()}),
+			errors.RetryInfo{RetryDelay: errors.Duration(retryDelay)})
+	},
+	http.StatusGatewayTimeout: func(c *fiber.Ctx, cause error) error {
+		return errors.WithDeadlineExceeded(cause, errors.DebugInfo{Detail: cause.Error()})
+	},
+}
+
+// negotiationStatuses are kept on responses instead of the HTTP status of their code,
+// so clients can tell that another Accept or Content-Type may succeed.
+var negotiationStatuses = map[int]bool{
+	http.StatusNotAcceptable:        true,
+	http.StatusUnsupportedMediaType: true,
+}
+
+func errorInfo(c *fiber.Ctx, reason string) errors.ErrorInfo {
+	return errors.ErrorInfo{
+		Reason:   reason,
+		Domain:   c.Hostname(),
+		Metadata: map[string]string{"method": c.Method(), "path": c.Path()},
+	}
+}
+
+func headerViolation(header string, cause error) errors.BadRequest {
+	return errors.BadRequest{
+		FieldViolations: []errors.FieldViolation{{Field: header, Description: cause.Error()}},
+	}
+}
+
+// errorHandler encodes errors as google.rpc.Status. Server errors are logged with
+// the full cause chain, and clients only see a generic message unless debug is enabled.
+func errorHandler(debug bool) fiber.ErrorHandler {
+	return func(c *fiber.Ctx, cause error) error {
+		var (
+			err   = translateError(c, cause)
+			code  = errors.Code(err)
+			chain = causeChain(cause)
+			info  = errors.RequestInfo{RequestId: requestIDOf(c)}
+			buf   = &bytes.Buffer{}
+			enc   = errors.NewEncoder(json.NewEncoder(buf))
+		)
+
+		log := trace.Logger(c.UserContext()).WithFields(logrus.Fields{
+			"method": c.Method(),
+			"path":   c.Path(),
+			"status": code.Name(),
+			"chain":  chain,
+		})
+		logError(log, code, cause)
+
+		stack, _ := c.Locals(localStack).([]string)
+		err, enc.Mappers = exposeError(err, chain, stack, info, debug)
+		if encErr := enc.Encode(err); encErr != nil {
+			return fiber.DefaultErrorHandler(c, encErr)
+		}
+
+		status := code.Http()
+		var fiberErr *fiber.Error
+		if errors.As(cause, &fiberErr) && negotiationStatuses[fiberErr.Code] {
+			status = fiberErr.Code
+		}
+		return c.
+			Status(status).
+			JSON(json.RawMessage(buf.Bytes()))
+	}
+}
+
+func translateError(c *fiber.Ctx, cause error) error {
+	var fiberErr *fiber.Error
+	if errors.As(cause, &fiberErr) {
+		if mapping, ok := httpStatus[fiberErr.Code]; ok {
+			return mapping(c, fiberErr)
+		}
+		return errors.Annotate(fiberErr, errors.Unknown)
+	}
+	return translateServiceError(cause)
+}
+
+// translateServiceError maps errors of services regardless of the transport.
+func translateServiceError(cause error) error {
+	var validateErrs validator.ValidationErrors
+	switch {
+	case errors.As(cause, &validateErrs):
+		details := errors.BadRequest{
+			FieldViolations: make([]errors.FieldViolation, len(validateErrs)),
+		}
+		for i, subErr := range validateErrs {
+			details.FieldViolations[i] = errors.FieldViolation{
+				Field:       subErr.Field(),
+				Description: subErr.Error(),
+			}
+		}
+		return errors.WithBadRequest(cause, details)
+	default:
+		return translateDBError(cause)
+	}
+}
+
+// logError logs server errors, errors of clients are only logged for debugging.
+func logError(log *logrus.Entry, code errors.StatusCode, cause error) {
+	if code.Http() >= http.StatusInternalServerError {
+		log.WithError(cause).Error("Request failed")
+	} else {
+		log.WithError(cause).Debug("Request rejected")
+	}
+}
+
+// operationError encodes errors of operations like responses, see errorHandler.
+func operationError(debug bool) func(context.Context, error) (json.RawMessage, error) {
+	return func(ctx context.Context, cause error) (data json.RawMessage, err error) {
+		var (
+			chain = causeChain(cause)
+			buf   = &bytes.Buffer{}
+			enc   = errors.NewEncoder(json.NewEncoder(buf))
+			t     trace.Trace
+		)
+		t.FromContext(ctx)
+
+		var exposed error
+		exposed, enc.Mappers = exposeError(translateServiceError(cause), chain, nil,
+			errors.RequestInfo{RequestId: t.RequestID}, debug)
+		if err = enc.Encode(exposed); err != nil {
+			return
+		}
+		return bytes.TrimSpace(buf.Bytes()), nil
+	}
+}
+
+// exposeError decides what clients see of a translated error, with mappers for its details.
+// Server errors only keep their code and details unless debug is enabled, and missing
+// resources are only named, since causes like "sql: no rows in result set" tell about
+// the implementation. In debug, only stacks captured where the error arose are shown:
+// the one of a panic, or a DebugInfo the error already carries, which is kept as is.
+func exposeError(err error, chain, stack []string, info errors.RequestInfo, debug bool) (exposed error, mappers []errors.DetailMapper) {
+	// Errors raised before middlewares, e.g. body too large, have no request ID
+	mappers = []errors.DetailMapper{hideEmptyRequestInfo}
+	code := errors.Code(err)
+
+	switch {
+	case debug && hasDebugInfo(err):
+		exposed = errors.Annotate(err, info)
+	case debug:
+		exposed = errors.Annotate(err, info, errors.DebugInfo{
+			StackEntries: stack,
+			Detail:       strings.Join(chain, "\n"),
+		})
+	case code.Http() >= http.StatusInternalServerError:
+		mappers = append(mappers, errors.HideDebugInfo)
+		exposed = withMessage(err, http.StatusText(code.Http()), info)
+	case code == errors.NotFound:
+		mappers = append(mappers, errors.HideDebugInfo)
+		exposed = withMessage(err, notFoundMessage(err), info)
+	default:
+		mappers = append(mappers, errors.HideDebugInfo)
+		exposed = errors.Annotate(err, info)
+	}
+	return
+}
+
+// hasDebugInfo reports whether err already carries debug info.
+func hasDebugInfo(err error) bool {
+	for _, detail := range errors.Details(err) {
+		if _, ok := detail.(errors.DebugInfo); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// withMessage replaces the message of err, keeping its code and details.
+func withMessage(err error, msg string, info errors.RequestInfo) error {
+	annotations := []errors.Annotation{errors.Code(err)}
+	for _, detail := range errors.Details(err) {
+		annotations = append(annotations, detail)
+	}
+	return errors.Annotate(errors.New(msg), append(annotations, info)...)
+}
+
+// notFoundMessage names the missing resource, e.g. "items/1 not found".
+func notFoundMessage(err error) string {
+	for _, detail := range errors.Details(err) {
+		if info, ok := detail.(errors.ResourceInfo); ok && info.ResourceName != "" {
+			return info.ResourceName + " not found"
+		}
+	}
+	return http.StatusText(http.StatusNotFound)
+}
+
+// causeChain lists every error wrapped by cause, outermost first.
+func causeChain(cause error) (chain []string) {
+	for cur := cause; cur != nil; cur = errors.Unwrap(cur) {
+		chain = append(chain, fmt.Sprintf("%T: %s", cur, cur))
+	}
+	return
+}
+
+// recoverPanic turns panics into errors, the stack is kept for debug info.
+func recoverPanic() fiber.Handler {
+	return recover.New(recover.Config{
+		EnableStackTrace: true,
+		StackTraceHandler: func(c *fiber.Ctx, _ any) {
+			c.Locals(localStack, currentStack())
+		},
+	})
+}
+
+// currentStack lists the lines of the stack of the calling goroutine, recovering
+// functions call it so that the stack still holds the frames that panicked.
+func currentStack() (stack []string) {
+	for _, line := range strings.Split(string(debug.Stack()), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			stack = append(stack, line)
+		}
+	}
+	return
+}
+
+func hideEmptyRequestInfo(a errors.Any) errors.Any {
+	if info, ok := a.(errors.RequestInfo); ok && info.RequestId == "" {
+		return nil
+	}
+	return a
+}
+
+func requestIDOf(c *fiber.Ctx) string {
+	var t trace.Trace
+	t.FromContext(c.UserContext())
+	return t.RequestID
+}
+
+// translateDBError maps errors of SQLite and MySQL drivers and context deadline to codes,
+// errors already annotated with a code are kept as is.
+func translateDBError(cause error) error {
+	if code := errors.Code(cause); code != errors.Unknown && code != errors.DeadlineExceeded {
+		return cause
+	}
+
+	var (
+		sqliteErr sqlite3.Error
+		mysqlErr  *mysql.MySQLError
+	)
+	switch {
+	case errors.As(cause, &sqliteErr):
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return alreadyExists(cause)
+		case sqlite3.ErrConstraintCheck, sqlite3.ErrConstraintNotNull:
+			return invalidValue(cause)
+		case sqlite3.ErrConstraintForeignKey:
+			return foreignKey(cause)
+		}
+		switch sqliteErr.Code {
+		case sqlite3.ErrBusy, sqlite3.ErrLocked:
+			return unavailable(cause)
+		}
+	case errors.As(cause, &mysqlErr):
+		switch mysqlErr.Number {
+		case 1062, 1586:
+			return alreadyExists(cause)
+		case 1048, 1364, 3819:
+			return invalidValue(cause)
+		case 1216, 1217, 1451, 1452:
+			return foreignKey(cause)
+		case 1205, 1213:
+			return unavailable(cause)
+		}
+	case errors.Is(cause, context.DeadlineExceeded):
+		return errors.WithDeadlineExceeded(cause, errors.DebugInfo{Detail: cause.Error()})
+	}
+	return cause
+}
+
+// constraintSubject extracts the column or constraint from driver messages,
+// e.g. "NOT NULL constraint failed: item.title" gives "title".
+func constraintSubject(cause error) string {
+	msg := cause.Error()
+	if i := strings.LastIndex(msg, ": "); i >= 0 {
+		msg = msg[i+2:]
+	}
+	if i := strings.LastIndexByte(msg, '.'); i >= 0 {
+		msg = msg[i+1:]
+	}
+	if fields := strings.Fields(msg); len(fields) > 0 {
+		return strings.Trim(fields[0], "'`\"")
+	}
+	return msg
+}
+
+func alreadyExists(cause error) error {
+	return errors.WithAlreadyExists(cause, errors.ResourceInfo{
+		Description: cause.Error(),
+	})
+}
+
+func invalidValue(cause error) error {
+	return errors.WithBadRequest(cause, errors.BadRequest{
+		FieldViolations: []errors.FieldViolation{{
+			Field:       constraintSubject(cause),
+			Description: cause.Error(),
+		}},
+	})
+}
+
+func foreignKey(cause error) error {
+	return errors.WithFailedPrecondition(cause, errors.PreconditionFailure{
+		Violations: []errors.TypedViolation{{
+			Type:        "FOREIGN_KEY",
+			Subject:     constraintSubject(cause),
+			Description: cause.Error(),
+		}},
+	})
+}
+
+func unavailable(cause error) error {
+	return errors.Annotate(errors.WithUnavailable(cause, errors.DebugInfo{Detail: cause.Error()}),
+		errors.RetryInfo{RetryDelay: errors.Duration(retryDelay)})
+}
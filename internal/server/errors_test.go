@@ -0,0 +1,245 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gota33/errors"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestHandleErrorStatus(t *testing.T) {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, ErrorHandler: errorHandler(false)})
+	app.Get("/:status", func(c *fiber.Ctx) error {
+		status, _ := strconv.Atoi(c.Params("status"))
+		return fiber.NewError(status)
+	})
+
+	tests := []struct {
+		status   int
+		code     errors.StatusCode
+		detailed bool
+	}{
+		{http.StatusBadRequest, errors.InvalidArgument, true},
+		{http.StatusUnauthorized, errors.Unauthenticated, true},
+		{http.StatusForbidden, errors.PermissionDenied, true},
+		{http.StatusNotFound, errors.NotFound, true},
+		{http.StatusMethodNotAllowed, errors.Unimplemented, false},
+		{http.StatusRequestTimeout, errors.DeadlineExceeded, false},
+		{http.StatusConflict, errors.Aborted, true},
+		{http.StatusRequestEntityTooLarge, errors.OutOfRange, true},
+		{http.StatusUnsupportedMediaType, errors.InvalidArgument, true},
+		{http.StatusTooManyRequests, errors.ResourceExhausted, true},
+		{http.StatusServiceUnavailable, errors.Unavailable, true},
+		{http.StatusTeapot, errors.Unknown, false},
+	}
+	for _, tt := range tests {
+		res, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/"+strconv.Itoa(tt.status), nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Error struct {
+				Status  string            `json:"status"`
+				Details []json.RawMessage `json:"details"`
+			} `json:"error"`
+		}
+		if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		// Statuses of content negotiation are kept
+		want := tt.code.Http()
+		if negotiationStatuses[tt.status] {
+			want = tt.status
+		}
+		if res.StatusCode != want || body.Error.Status != tt.code.String() {
+			t.Errorf("status %d: got %d %s, want %d %v", tt.status, res.StatusCode, body.Error.Status, want, tt.code)
+		}
+		if tt.detailed && len(body.Error.Details) == 0 {
+			t.Errorf("status %d: no details", tt.status)
+		}
+	}
+}
+
+func TestTranslateDBError(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err = db.Exec(`
+pragma foreign_keys = on;
+create table parent
+(
+    id integer primary key
+);
+create table child
+(
+    id        integer primary key,
+    title     text    not null unique,
+    parent_id integer null references parent (id)
+);
+insert into child (id, title) values (1, 'a');`); err != nil {
+		t.Fatal(err)
+	}
+
+	insert := func(id int, title any, parentID any) error {
+		_, err := db.Exec("insert into child (id, title, parent_id) values (?, ?, ?)", id, title, parentID)
+		return translateDBError(err)
+	}
+
+	if err = insert(1, "b", nil); errors.Code(err) != errors.AlreadyExists {
+		t.Errorf("duplicate id: got %v, want AlreadyExists", err)
+	}
+	if err = insert(2, "a", nil); errors.Code(err) != errors.AlreadyExists {
+		t.Errorf("duplicate title: got %v, want AlreadyExists", err)
+	}
+	if err = insert(2, nil, nil); !hasViolation(err, "title") {
+		t.Errorf("null title: got %v, want a violation of title", err)
+	}
+	if err = insert(2, "b", 404); errors.Code(err) != errors.FailedPrecondition {
+		t.Errorf("missing parent: got %v, want FailedPrecondition", err)
+	}
+
+	tests := []struct {
+		err  error
+		code errors.StatusCode
+	}{
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'title'"}, errors.AlreadyExists},
+		{&mysql.MySQLError{Number: 1048, Message: "Column 'title' cannot be null"}, errors.InvalidArgument},
+		{&mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row"}, errors.FailedPrecondition},
+		{&mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, errors.Unavailable},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), errors.DeadlineExceeded},
+		{errors.WithNotFound(sql.ErrNoRows, errors.ResourceInfo{ResourceName: "items/1"}), errors.NotFound},
+		{errors.New("broken"), errors.Unknown},
+	}
+	for _, tt := range tests {
+		if code := errors.Code(translateDBError(tt.err)); code != tt.code {
+			t.Errorf("translate %v = %v, want %v", tt.err, code, tt.code)
+		}
+	}
+}
+
+func hasViolation(err error, field string) bool {
+	for _, detail := range errors.Details(err) {
+		if br, ok := detail.(errors.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				if v.Field == field {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func TestExposeErrorNotFound(t *testing.T) {
+	err := errors.WithNotFound(sql.ErrNoRows, errors.ResourceInfo{ResourceType: "items", ResourceName: "items/1"})
+
+	exposed, mappers := exposeError(err, causeChain(err), nil, errors.RequestInfo{}, false)
+	exposed = errors.Flatten(exposed, mappers...)
+	if got, want := exposed.Error(), "items/1 not found"; got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+	if code := errors.Code(exposed); code != errors.NotFound {
+		t.Errorf("code = %v, want NotFound", code)
+	}
+}
+
+func TestExposeErrorSourceStack(t *testing.T) {
+	err := newTracedError()
+
+	exposed, _ := exposeError(err, causeChain(err), nil, errors.RequestInfo{}, true)
+	infos := debugInfos(exposed)
+	if len(infos) != 1 {
+		t.Fatalf("debug infos = %v, want the one of the source", infos)
+	}
+	if !hasFrame(infos[0].StackEntries, "server.newTracedError") {
+		t.Errorf("stack %v misses the frame that created the error", infos[0].StackEntries)
+	}
+}
+
+func TestExposeErrorNoStack(t *testing.T) {
+	err := errors.WithBadRequest(errors.New("bad title"), errors.BadRequest{})
+
+	exposed, _ := exposeError(err, causeChain(err), nil, errors.RequestInfo{}, true)
+	infos := debugInfos(exposed)
+	if len(infos) != 1 {
+		t.Fatalf("debug infos = %v, want one with the chain", infos)
+	}
+	if len(infos[0].StackEntries) > 0 {
+		t.Errorf("stack = %v, want none for errors without one", infos[0].StackEntries)
+	}
+}
+
+func TestErrorHandlerPanicStack(t *testing.T) {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, ErrorHandler: errorHandler(true)})
+	app.Use(recoverPanic())
+	app.Get("/", panicking)
+
+	res, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Error struct {
+			Details []struct {
+				Type         string   `json:"@type"`
+				StackEntries []string `json:"stackEntries"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	var stacks int
+	for _, detail := range body.Error.Details {
+		if len(detail.StackEntries) == 0 {
+			continue
+		}
+		stacks++
+		if !hasFrame(detail.StackEntries, "server.panicking") {
+			t.Errorf("stack %v misses the frame that panicked", detail.StackEntries)
+		}
+	}
+	if stacks != 1 {
+		t.Errorf("details %+v, want one stack", body.Error.Details)
+	}
+}
+
+func newTracedError() error {
+	return errors.Annotate(errors.New("broken"), errors.Internal, errors.StackTrace("broken"))
+}
+
+func panicking(*fiber.Ctx) error {
+	panic("boom")
+}
+
+func debugInfos(err error) (infos []errors.DebugInfo) {
+	for _, detail := range errors.Details(err) {
+		if info, ok := detail.(errors.DebugInfo); ok {
+			infos = append(infos, info)
+		}
+	}
+	return
+}
+
+func hasFrame(stack []string, fn string) bool {
+	for _, line := range stack {
+		if strings.Contains(line, fn+"(") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gota33/errors"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
+	itemv1 "server/internal/proto/item/v1"
+	"server/internal/service/auth"
+	"server/internal/service/entity"
+	"server/internal/service/item"
+	"server/internal/service/trace"
+)
+
+//go:generate buf generate ../../proto --template ../../buf.gen.yaml -o ../..
+
+const metadataAuthorization = "authorization"
+
+// newGRPC serves services over gRPC, with the same auth, tracing, access logs and
+// error details as HTTP. Certificates are shared with HTTP if tlsConfig is given.
+func newGRPC(c Config, tlsConfig *tls.Config) *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			grpcTrace,
+			grpcAccessLog(c.AccessLog),
+			grpcErrors(c.Debug),
+			grpcRecover,
+			grpcDeadline(c.RequestTimeout),
+			grpcAuth,
+		),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	srv := grpc.NewServer(opts...)
+	itemv1.RegisterItemServiceServer(srv, itemServer{srv: item.New(c.RDS, c.Operations)})
+	// TODO: More services here...
+
+	reflection.Register(srv)
+	return srv
+}
+
+// invoke calls a service method like handler does, requests are validated unless updating.
+func invoke[Request any, Response any](ctx context.Context, h func(context.Context, Request) (Response, error),
+	req Request, validate bool) (res Response, err error) {
+	if validate {
+		if err = entity.Validate.Struct(req); err != nil {
+			return
+		}
+	}
+
+	ctx, span := trace.Start(ctx, handlerName(h))
+	res, err = h(ctx, req)
+	trace.End(span, err)
+	return
+}
+
+// grpcTrace continues the W3C trace context of metadata, like initTraceContext.
+func grpcTrace(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res any, err error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+
+	service, method := path.Split(info.FullMethod)
+	t := trace.Trace{RequestID: first(md.Get(trace.HeaderRequestID))}
+	ctx, span := trace.Start(t.WithContext(ctx), strings.TrimPrefix(info.FullMethod, "/"),
+		oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+		oteltrace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.service", strings.Trim(service, "/")),
+			attribute.String("rpc.method", method),
+		))
+	defer func() { trace.End(span, err) }()
+
+	t.FromContext(ctx)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(trace.HeaderRequestID, t.RequestID))
+	return handler(ctx, req)
+}
+
+// grpcAccessLog writes one logrus entry per call, like accessLog.
+// Exclude patterns match full methods, e.g. "/grpc.reflection.*".
+func grpcAccessLog(a AccessLog) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res any, err error) {
+		if a.excluded(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		res, err = handler(ctx, req)
+
+		code := status.Code(err)
+		if code != codes.Internal && code != codes.Unknown && code != codes.Unavailable &&
+			code != codes.DataLoss && rand.Float64() >= a.SampleRate {
+			return
+		}
+
+		fields := logrus.Fields{
+			"method":    info.FullMethod,
+			"code":      code.String(),
+			"latencyMs": float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if user, ok, _ := grpcUser(ctx); ok {
+			fields["user"] = user.Subject
+		}
+		trace.Logger(ctx).WithFields(fields).Info("Access")
+		return
+	}
+}
+
+// grpcErrors translates errors to google.rpc.Status with details, like errorHandler.
+func grpcErrors(debug bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res any, err error) {
+		if res, err = handler(ctx, req); err == nil {
+			return
+		}
+		if _, ok := err.(interface{ GRPCStatus() *status.Status }); ok {
+			return
+		}
+
+		var (
+			cause = err
+			chain = causeChain(cause)
+			t     trace.Trace
+		)
+		err = translateServiceError(cause)
+		code := errors.Code(err)
+		t.FromContext(ctx)
+
+		log := trace.Logger(ctx).WithFields(logrus.Fields{
+			"method": info.FullMethod,
+			"status": code.Name(),
+			"chain":  chain,
+		})
+		logError(log, code, cause)
+
+		exposed, mappers := exposeError(err, chain, nil, errors.RequestInfo{RequestId: t.RequestID}, debug)
+		return nil, grpcStatus(errors.Flatten(exposed, mappers...)).Err()
+	}
+}
+
+// grpcStatus converts details through their JSON encoding, which follows google.rpc types.
+func grpcStatus(err error) *status.Status {
+	code := errors.Code(err)
+	st := &spb.Status{Code: int32(code), Message: err.Error()}
+
+	for _, detail := range errors.Details(err) {
+		data, marshalErr := json.Marshal(detail)
+		if marshalErr != nil {
+			continue
+		}
+		var a anypb.Any
+		if protojson.Unmarshal(data, &a) == nil {
+			st.Details = append(st.Details, &a)
+		}
+	}
+	return status.FromProto(st)
+}
+
+// grpcRecover turns panics into internal errors, the stack is kept for debug info.
+func grpcRecover(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.WithInternal(fmt.Errorf("%v", r), errors.DebugInfo{StackEntries: currentStack()})
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// grpcDeadline limits calls without a deadline from the client.
+func grpcDeadline(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if _, ok := ctx.Deadline(); !ok && timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return handler(ctx, req)
+	}
+}
+
+// grpcAuth maps bearer tokens of metadata, or verified client certificates, to the user.
+func grpcAuth(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	user, ok, err := grpcUser(ctx)
+	if err != nil {
+		return nil, errors.Annotate(err, errors.Unauthenticated)
+	}
+	if p, found := peer.FromContext(ctx); found {
+		if host, _, splitErr := net.SplitHostPort(p.Addr.String()); splitErr == nil {
+			ctx = auth.WithClientIP(ctx, host)
+		}
+	}
+	if ok {
+		ctx = user.WithContext(ctx)
+	}
+	return handler(ctx, req)
+}
+
+// grpcUser resolves the user of metadata and the peer like initAuthContext.
+func grpcUser(ctx context.Context) (user auth.User, ok bool, err error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var state *tls.ConnectionState
+	if p, found := peer.FromContext(ctx); found {
+		if tlsInfo, isTLS := p.AuthInfo.(credentials.TLSInfo); isTLS {
+			state = &tlsInfo.State
+		}
+	}
+	return userOf(first(md.Get(metadataAuthorization)), state)
+}
+
+// metadataCarrier adapts gRPC metadata to propagation.TextMapCarrier.
+type metadataCarrier metadata.MD
+
+func (mc metadataCarrier) Get(key string) string {
+	return first(metadata.MD(mc).Get(key))
+}
+
+func (mc metadataCarrier) Set(key string, value string) {
+	metadata.MD(mc).Set(key, value)
+}
+
+func (mc metadataCarrier) Keys() (keys []string) {
+	for key := range mc {
+		keys = append(keys, key)
+	}
+	return
+}
+
+func first(values []string) string {
+	if len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	itemv1 "server/internal/proto/item/v1"
+	"server/internal/service/entity"
+	"server/internal/service/item"
+)
+
+// itemServer serves item.Service over gRPC, resources are named like in HTTP responses.
+type itemServer struct {
+	itemv1.UnimplementedItemServiceServer
+	srv item.Service
+}
+
+func (s itemServer) GetItem(ctx context.Context, req *itemv1.GetItemRequest) (res *itemv1.Item, err error) {
+	var ids []string
+	if ids, err = item.Pattern.Parse(req.GetName()); err != nil {
+		return
+	}
+
+	var e item.Entity
+	if e, err = invoke(ctx, s.srv.Get, item.GetRequest{ItemID: ids[0]}, true); err != nil {
+		return
+	}
+	return itemToProto(e), nil
+}
+
+func (s itemServer) ListItems(ctx context.Context, req *itemv1.ListItemsRequest) (res *itemv1.ListItemsResponse, err error) {
+	var list item.ListResponse
+	if list, err = invoke(ctx, s.srv.List, item.ListRequest{
+		ListRequestFragment: entity.ListRequestFragment{
+			PageSize:  int(req.GetPageSize()),
+			PageToken: req.GetPageToken(),
+			Filter:    req.GetFilter(),
+		},
+	}, true); err != nil {
+		return
+	}
+
+	return listItemsToProto(list), nil
+}
+
+func (s itemServer) CreateItem(ctx context.Context, req *itemv1.CreateItemRequest) (res *itemv1.Item, err error) {
+	var e item.Entity
+	if e, err = invoke(ctx, s.srv.Create, itemFromProto(req.GetItem()), true); err != nil {
+		return
+	}
+	return itemToProto(e), nil
+}
+
+func (s itemServer) UpdateItem(ctx context.Context, req *itemv1.UpdateItemRequest) (res *itemv1.Item, err error) {
+	var ids []string
+	if ids, err = item.Pattern.ParseField("item.name", req.GetItem().GetName()); err != nil {
+		return
+	}
+
+	var e item.Entity
+	if e, err = invoke(ctx, s.srv.Update, item.UpdateRequest{
+		UpdateRequestFragment: entity.UpdateRequestFragment{
+			UpdateMask: entity.FieldMask{Paths: jsonPaths(req.GetUpdateMask().GetPaths())},
+		},
+		ItemID: ids[0],
+		Item:   itemFromProto(req.GetItem()),
+	}, false); err != nil {
+		return
+	}
+	return itemToProto(e), nil
+}
+
+func (s itemServer) DeleteItem(ctx context.Context, req *itemv1.DeleteItemRequest) (res *emptypb.Empty, err error) {
+	var ids []string
+	if ids, err = item.Pattern.Parse(req.GetName()); err != nil {
+		return
+	}
+
+	if _, err = invoke(ctx, s.srv.Delete, item.DeleteRequest{ItemID: ids[0]}, true); err != nil {
+		return
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s itemServer) RestoreItem(ctx context.Context, req *itemv1.RestoreItemRequest) (res *itemv1.Item, err error) {
+	var ids []string
+	if ids, err = item.Pattern.Parse(req.GetName()); err != nil {
+		return
+	}
+
+	var e item.Entity
+	if e, err = invoke(ctx, s.srv.Restore, item.RestoreRequest{
+		ItemID:     ids[0],
+		RevisionID: req.GetRevisionId(),
+	}, true); err != nil {
+		return
+	}
+	return itemToProto(e), nil
+}
+
+func itemToProto(e item.Entity) *itemv1.Item {
+	return &itemv1.Item{
+		Name:       e.Name,
+		Title:      e.Title,
+		Price:      e.Price,
+		Num:        e.Num,
+		CreateTime: timestamppb.New(e.CreateTime),
+	}
+}
+
+func listItemsToProto(list item.ListResponse) *itemv1.ListItemsResponse {
+	res := &itemv1.ListItemsResponse{NextPageToken: list.NextPageToken}
+	for _, e := range list.Items {
+		res.Items = append(res.Items, itemToProto(e))
+	}
+	return res
+}
+
+func itemFromProto(m *itemv1.Item) item.Entity {
+	return item.Entity{
+		Name:  m.GetName(),
+		Title: m.GetTitle(),
+		Price: m.GetPrice(),
+		Num:   m.GetNum(),
+	}
+}
+
+// jsonPaths converts field mask paths of protobuf to JSON names used by entities,
+// e.g. "create_time" to "createTime".
+func jsonPaths(paths []string) []string {
+	res := make([]string, len(paths))
+	for i, p := range paths {
+		var sb strings.Builder
+		upper := false
+		for _, r := range p {
+			switch {
+			case r == '_':
+				upper = true
+			case upper:
+				sb.WriteRune(unicode.ToUpper(r))
+				upper = false
+			default:
+				sb.WriteRune(r)
+			}
+		}
+		res[i] = sb.String()
+	}
+	return res
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"net"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	itemv1 "server/internal/proto/item/v1"
+)
+
+func TestGRPCStatusDetails(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	const schema = "create table item (id integer primary key autoincrement, title text not null, " +
+		"price decimal(12, 2) not null, num integer not null, create_time timestamp not null default current_timestamp)"
+	if _, err = db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+
+	ln := bufconn.Listen(1 << 20)
+	srv := newGRPC(Config{RDS: db}, nil)
+	go func() { _ = srv.Serve(ln) }()
+	defer srv.Stop()
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := itemv1.NewItemServiceClient(conn)
+	_, err = client.GetItem(context.Background(), &itemv1.GetItemRequest{Name: "items/404"})
+
+	st := status.Convert(err)
+	if st.Code() != codes.NotFound || st.Message() != "items/404 not found" {
+		t.Fatalf("got %v %q, want NotFound with a resource message", st.Code(), st.Message())
+	}
+
+	var (
+		resource *errdetails.ResourceInfo
+		request  *errdetails.RequestInfo
+	)
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ResourceInfo:
+			resource = detail
+		case *errdetails.RequestInfo:
+			request = detail
+		}
+	}
+	if resource == nil || resource.GetResourceName() != "items/404" || resource.GetResourceType() != "items" {
+		t.Errorf("resource info = %v, want items/404", resource)
+	}
+	if request == nil || request.GetRequestId() == "" {
+		t.Errorf("request info = %v, want a request ID", request)
+	}
+}
+
+func TestGRPCUserClientCertificate(t *testing.T) {
+	ca := issue(t, "ca", nil)
+	client := issue(t, "alice", &ca)
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{
+		State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{client.cert, ca.cert}}},
+	}})
+	if user, ok, err := grpcUser(ctx); err != nil || !ok || user.Subject != "alice" {
+		t.Errorf("certificate only: got %q, %v, %v, want alice", user.Subject, ok, err)
+	}
+
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(metadataAuthorization, token("mallory")))
+	if user, ok, err := grpcUser(ctx); err == nil || ok {
+		t.Errorf("other token: got %q, %v, %v, want error", user.Subject, ok, err)
+	}
+}
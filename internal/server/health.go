@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	endpointLive  = "livez"
+	endpointReady = "readyz"
+	checkTimeout  = 2 * time.Second
+)
+
+// HealthCheck reports whether a dependency is ready to serve, e.g. a database ping.
+type HealthCheck func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// health runs readiness checks concurrently, each within checkTimeout.
+// It goes unready once shutdown starts, so load balancers stop routing first.
+type health struct {
+	mu       sync.RWMutex
+	checks   []namedCheck
+	draining int32
+}
+
+func (h *health) Register(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+func (h *health) drain() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+type checkResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type readyResponse struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks"`
+}
+
+func (h *health) run(ctx context.Context) (res readyResponse) {
+	h.mu.RLock()
+	checks := h.checks
+	h.mu.RUnlock()
+
+	res.Status = statusOf(nil)
+	res.Checks = make([]checkResult, len(checks), len(checks)+1)
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c namedCheck) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.check(checkCtx)
+			res.Checks[i] = checkResult{
+				Name:      c.name,
+				Status:    statusOf(err),
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				res.Checks[i].Error = err.Error()
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	if atomic.LoadInt32(&h.draining) == 1 {
+		res.Checks = append(res.Checks, checkResult{Name: "shutdown", Status: statusOf(errDraining)})
+	}
+	for _, c := range res.Checks {
+		if c.Status != statusOf(nil) {
+			res.Status = c.Status
+		}
+	}
+	return
+}
+
+var errDraining = fiber.NewError(http.StatusServiceUnavailable, "server is shutting down")
+
+func statusOf(err error) string {
+	if err != nil {
+		return "fail"
+	}
+	return "ok"
+}
+
+// live only tells the process is serving, dependencies are left to readiness.
+func live() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	}
+}
+
+// ready runs all checks, "?verbose" reports status and latency of each one as JSON.
+func (h *health) ready() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		res := h.run(c.UserContext())
+
+		status := http.StatusOK
+		if res.Status != statusOf(nil) {
+			status = http.StatusServiceUnavailable
+		}
+		if c.Request().URI().QueryArgs().Has("verbose") {
+			return c.Status(status).JSON(res)
+		}
+		return c.Status(status).SendString(res.Status)
+	}
+}
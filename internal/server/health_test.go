@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func readyz(t *testing.T, h *health, verbose bool) (status int, res readyResponse) {
+	t.Helper()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/readyz", h.ready())
+
+	target := "/readyz"
+	if verbose {
+		target += "?verbose"
+	}
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, target, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verbose {
+		err = json.NewDecoder(resp.Body).Decode(&res)
+	} else {
+		var body []byte
+		body, err = io.ReadAll(resp.Body)
+		res.Status = string(body)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, res
+}
+
+func TestHealthReady(t *testing.T) {
+	var (
+		h      = &health{}
+		broken error
+	)
+	h.Register("db", func(ctx context.Context) error { return nil })
+	h.Register("cache", func(ctx context.Context) error { return broken })
+
+	if status, res := readyz(t, h, false); status != http.StatusOK || res.Status != "ok" {
+		t.Errorf("ready = %d %q, want 200 ok", status, res.Status)
+	}
+
+	broken = errors.New("connection refused")
+	status, res := readyz(t, h, true)
+	if status != http.StatusServiceUnavailable || res.Status != "fail" || len(res.Checks) != 2 {
+		t.Fatalf("ready with a failing check = %d %+v", status, res)
+	}
+	if db := res.Checks[0]; db.Name != "db" || db.Status != "ok" || db.Error != "" {
+		t.Errorf("check of db = %+v", db)
+	}
+	if cache := res.Checks[1]; cache.Name != "cache" || cache.Status != "fail" || cache.Error != "connection refused" {
+		t.Errorf("check of cache = %+v", cache)
+	}
+}
+
+func TestHealthDrain(t *testing.T) {
+	h := &health{}
+	h.Register("db", func(ctx context.Context) error { return nil })
+	h.drain()
+
+	status, res := readyz(t, h, true)
+	if status != http.StatusServiceUnavailable || len(res.Checks) != 2 || res.Checks[1].Name != "shutdown" {
+		t.Errorf("ready while draining = %d %+v", status, res)
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gota33/errors"
+	"github.com/sirupsen/logrus"
+	"server/internal/service/auth"
+	"server/internal/service/idempotency"
+	"server/internal/service/trace"
+)
+
+const (
+	headerIdempotencyKey = "Idempotency-Key"
+	// headerReplayed tells clients the response is replayed for the key
+	headerReplayed = "Idempotent-Replayed"
+)
+
+// idempotent replays responses of POST requests retried with the same Idempotency-Key,
+// so retries on flaky networks don't create duplicates. Keys are scoped to the user,
+// or to the client IP of anonymous requests. Only successful responses are saved,
+// failed requests may be retried by the key.
+func idempotent(store *idempotency.Store) fiber.Handler {
+	return func(c *fiber.Ctx) (err error) {
+		value := c.Get(headerIdempotencyKey)
+		if value == "" || c.Method() != fiber.MethodPost {
+			return c.Next()
+		}
+		if len(value) > idempotency.MaxKeyLength {
+			cause := fmt.Errorf("idempotency key exceeds %d bytes", idempotency.MaxKeyLength)
+			return errors.WithBadRequest(cause, headerViolation(headerIdempotencyKey, cause))
+		}
+
+		ctx := c.UserContext()
+		key := idempotency.Key{Actor: auth.ActorOf(ctx), Key: value}
+
+		var saved *idempotency.Response
+		if saved, err = store.Claim(ctx, key, fingerprint(c)); err != nil {
+			return
+		}
+		if saved != nil {
+			c.Set(fiber.HeaderContentType, saved.ContentType)
+			c.Set(headerReplayed, "true")
+			return c.Status(saved.Status).Send(saved.Body)
+		}
+
+		log := trace.Logger(ctx).WithFields(logrus.Fields{"idempotencyKey": value})
+
+		// Streams can't be replayed, e.g. exports
+		if err = c.Next(); err != nil || c.Response().IsBodyStream() ||
+			c.Response().StatusCode() >= fiber.StatusInternalServerError {
+			if releaseErr := store.Release(ctx, key); releaseErr != nil {
+				log.WithError(releaseErr).Warn("Release idempotency key error")
+			}
+			return
+		}
+
+		res := idempotency.Response{
+			Status:      c.Response().StatusCode(),
+			ContentType: string(c.Response().Header.ContentType()),
+			Body:        c.Response().Body(),
+		}
+		// A key left claimed would fail retries with Aborted until LockTTL
+		if saveErr := store.Save(ctx, key, res); saveErr != nil {
+			log.WithError(saveErr).Warn("Save idempotent response error")
+			if releaseErr := store.Release(ctx, key); releaseErr != nil {
+				log.WithError(releaseErr).Warn("Release idempotency key error")
+			}
+		}
+		return
+	}
+}
+
+// fingerprint identifies the request by its content, rather than the encoding of its body.
+// Multipart bodies are fingerprinted by their fields and files, as boundaries change between
+// retries. Malformed ones fall back to the raw body, they're rejected by handlers anyway.
+func fingerprint(c *fiber.Ctx) string {
+	body := c.Body()
+	if strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEMultipartForm) {
+		if form, err := c.MultipartForm(); err == nil {
+			if content, contentErr := formContent(form); contentErr == nil {
+				body = content
+			}
+		}
+	}
+	return idempotency.Fingerprint(c.Method(), c.OriginalURL(), body)
+}
+
+// formContent lists fields and digests of files of form in order of their names.
+func formContent(form *multipart.Form) (content []byte, err error) {
+	var buf bytes.Buffer
+	for _, name := range sortedKeys(form.Value) {
+		for _, value := range form.Value[name] {
+			_, _ = fmt.Fprintf(&buf, "%q=%q\n", name, value)
+		}
+	}
+	for _, name := range sortedKeys(form.File) {
+		for _, fh := range form.File[name] {
+			var sum []byte
+			if sum, err = fileDigest(fh); err != nil {
+				return
+			}
+			_, _ = fmt.Fprintf(&buf, "%q@%q;%q;%x\n", name, fh.Filename, fh.Header.Get(fiber.HeaderContentType), sum)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func fileDigest(fh *multipart.FileHeader) (sum []byte, err error) {
+	var f multipart.File
+	if f, err = fh.Open(); err != nil {
+		return
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return
+	}
+	return h.Sum(nil), nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	_ "github.com/mattn/go-sqlite3"
+	"server/internal/service/idempotency"
+)
+
+type idempotentApp struct {
+	*fiber.App
+	db    *sql.DB
+	calls int32
+	// block holds requests in the handler until closed if set
+	block chan struct{}
+}
+
+func newIdempotentApp(t *testing.T) *idempotentApp {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err = db.Exec(`create table idempotency
+(
+    actor           text      not null,
+    idempotency_key text      not null,
+    fingerprint     text      not null,
+    status          integer   null,
+    content_type    text      not null default '',
+    body            blob      null,
+    create_time     timestamp not null default current_timestamp,
+    expire_time     timestamp not null,
+    primary key (actor, idempotency_key)
+)`); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &idempotentApp{db: db}
+	a.App = fiber.New(fiber.Config{
+		DisableStartupMessage: true,
+		ErrorHandler:          errorHandler(false),
+		ProxyHeader:           fiber.HeaderXForwardedFor,
+	})
+	a.Use(initUserContext, initAuthContext, idempotent(idempotency.NewStore(db)))
+	a.Post("/items", func(c *fiber.Ctx) error {
+		n := atomic.AddInt32(&a.calls, 1)
+		if a.block != nil {
+			<-a.block
+		}
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"n": n})
+	})
+	return a
+}
+
+type idempotentRequest struct {
+	key, body, contentType, ip, authorization string
+}
+
+func (a *idempotentApp) post(t *testing.T, r idempotentRequest) (status int, body string, replayed bool) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/items", bytes.NewBufferString(r.body))
+	req.Header.Set(headerIdempotencyKey, r.key)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if r.contentType != "" {
+		req.Header.Set(fiber.HeaderContentType, r.contentType)
+	}
+	if r.ip != "" {
+		req.Header.Set(fiber.HeaderXForwardedFor, r.ip)
+	}
+	if r.authorization != "" {
+		req.Header.Set(fiber.HeaderAuthorization, r.authorization)
+	}
+
+	res, err := a.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(data), res.Header.Get(headerReplayed) == "true"
+}
+
+func TestIdempotentReplay(t *testing.T) {
+	a := newIdempotentApp(t)
+	req := idempotentRequest{key: "k1", body: `{"title":"a"}`}
+
+	status, first, replayed := a.post(t, req)
+	if status != fiber.StatusCreated || replayed {
+		t.Fatalf("first: got %d %q, replayed %v", status, first, replayed)
+	}
+	status, second, replayed := a.post(t, req)
+	if status != fiber.StatusCreated || !replayed || second != first {
+		t.Errorf("retry: got %d %q, replayed %v, want %q replayed", status, second, replayed, first)
+	}
+	if a.calls != 1 {
+		t.Errorf("handled %d times, want once", a.calls)
+	}
+
+	// another key is another request
+	if status, _, replayed = a.post(t, idempotentRequest{key: "k2", body: req.body}); status != fiber.StatusCreated || replayed {
+		t.Errorf("other key: got %d, replayed %v", status, replayed)
+	}
+}
+
+func TestIdempotentMismatch(t *testing.T) {
+	a := newIdempotentApp(t)
+
+	a.post(t, idempotentRequest{key: "k1", body: `{"title":"a"}`})
+	if status, body, _ := a.post(t, idempotentRequest{key: "k1", body: `{"title":"b"}`}); status != fiber.StatusBadRequest {
+		t.Errorf("got %d %q, want 400", status, body)
+	}
+	if a.calls != 1 {
+		t.Errorf("handled %d times, want once", a.calls)
+	}
+}
+
+func TestIdempotentConcurrent(t *testing.T) {
+	a := newIdempotentApp(t)
+	a.block = make(chan struct{})
+	req := idempotentRequest{key: "k1", body: `{"title":"a"}`}
+
+	first := make(chan int)
+	go func() {
+		status, _, _ := a.post(t, req)
+		first <- status
+	}()
+	for atomic.LoadInt32(&a.calls) == 0 {
+		runtime.Gosched()
+	}
+
+	if status, body, _ := a.post(t, req); status != fiber.StatusConflict {
+		t.Errorf("concurrent: got %d %q, want 409", status, body)
+	}
+	close(a.block)
+	if status := <-first; status != fiber.StatusCreated {
+		t.Errorf("first: got %d, want 201", status)
+	}
+	if _, _, replayed := a.post(t, req); !replayed {
+		t.Error("retry after the first finished isn't replayed")
+	}
+}
+
+func TestIdempotentScope(t *testing.T) {
+	a := newIdempotentApp(t)
+	body := `{"title":"a"}`
+
+	for i, req := range []idempotentRequest{
+		{key: "k1", body: body, ip: "10.0.0.1"},
+		{key: "k1", body: body, ip: "10.0.0.2"},
+		{key: "k1", body: body, ip: "10.0.0.1", authorization: token("bob")},
+		{key: "k1", body: body, ip: "10.0.0.2", authorization: token("alice")},
+	} {
+		if status, _, replayed := a.post(t, req); status != fiber.StatusCreated || replayed {
+			t.Errorf("request %d: got %d, replayed %v, want a new response", i, status, replayed)
+		}
+	}
+	if _, _, replayed := a.post(t, idempotentRequest{key: "k1", body: body, ip: "10.0.0.2", authorization: token("bob")}); !replayed {
+		t.Error("bob's retry from another IP isn't replayed")
+	}
+}
+
+func TestIdempotentMultipart(t *testing.T) {
+	a := newIdempotentApp(t)
+	form := func(boundary, file string) (string, string) {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		if err := w.SetBoundary(boundary); err != nil {
+			t.Fatal(err)
+		}
+		_ = w.WriteField("dryRun", "true")
+		fw, _ := w.CreateFormFile("file", "items.csv")
+		_, _ = fw.Write([]byte(file))
+		_ = w.Close()
+		return buf.String(), w.FormDataContentType()
+	}
+
+	body, contentType := form("boundary1", "title\na\n")
+	a.post(t, idempotentRequest{key: "k1", body: body, contentType: contentType})
+
+	body, contentType = form("boundary2", "title\na\n")
+	if status, _, replayed := a.post(t, idempotentRequest{key: "k1", body: body, contentType: contentType}); !replayed {
+		t.Errorf("retry with another boundary: got %d, want replayed", status)
+	}
+	body, contentType = form("boundary3", "title\nb\n")
+	if status, _, _ := a.post(t, idempotentRequest{key: "k1", body: body, contentType: contentType}); status != fiber.StatusBadRequest {
+		t.Errorf("other file: got %d, want 400", status)
+	}
+}
+
+func TestIdempotentSaveError(t *testing.T) {
+	a := newIdempotentApp(t)
+	if _, err := a.db.Exec(`create trigger fail_save before update of status on idempotency
+begin select raise(fail, 'disk full'); end`); err != nil {
+		t.Fatal(err)
+	}
+
+	req := idempotentRequest{key: "k1", body: `{"title":"a"}`}
+	for i := 1; i <= 2; i++ {
+		status, body, replayed := a.post(t, req)
+		if want := `{"n":` + strconv.Itoa(i) + `}`; status != fiber.StatusCreated || replayed || body != want {
+			t.Errorf("request %d: got %d %q, replayed %v, want 201 %s", i, status, body, replayed, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/gota33/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests by route template, method and error code.",
+	}, []string{"route", "method", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by route template, method and error code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	httpInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests being served by method.",
+	}, []string{"method"})
+)
+
+// recordMetrics observes rate, errors and duration of requests. It runs inside
+// accessLog, so the chain error is still available to derive the code.
+func recordMetrics(c *fiber.Ctx) (err error) {
+	// Labels are kept by prometheus, but fiber reuses the method buffer
+	method := utils.CopyString(c.Method())
+	inFlight := httpInFlight.WithLabelValues(method)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	start := time.Now()
+	err = c.Next()
+
+	code := errors.OK
+	if err != nil {
+		code = errors.Code(translateError(c, err))
+	}
+
+	labels := []string{c.Route().Path, method, string(code.Name())}
+	httpRequests.WithLabelValues(labels...).Inc()
+	httpDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	return
+}
+
+// registerDBStats exports sql.DBStats of the pool, registering twice is tolerated.
+func registerDBStats(db *sql.DB, name string) (err error) {
+	var already prometheus.AlreadyRegisteredError
+	if err = prometheus.Register(collectors.NewDBStatsCollector(db, name)); errors.As(err, &already) {
+		err = nil
+	}
+	return
+}
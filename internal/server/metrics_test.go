@@ -0,0 +1,76 @@
+package server
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestRecordMetrics(t *testing.T) {
+	const route = "/metered/:id"
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, ErrorHandler: errorHandler(false)})
+	app.Use(recordMetrics)
+	app.Get(route, func(c *fiber.Ctx) error {
+		if inFlight := testutil.ToFloat64(httpInFlight.WithLabelValues(fiber.MethodGet)); inFlight < 1 {
+			t.Errorf("in flight = %v while serving", inFlight)
+		}
+		if c.Params("id") == "404" {
+			return fiber.ErrNotFound
+		}
+		return c.SendString("ok")
+	})
+
+	var (
+		requests = testutil.ToFloat64(httpRequests.WithLabelValues(route, fiber.MethodGet, "OK"))
+		failures = testutil.ToFloat64(httpRequests.WithLabelValues(route, fiber.MethodGet, "NOT_FOUND"))
+		observed = sampleCount(t, httpDuration.WithLabelValues(route, fiber.MethodGet, "OK"))
+	)
+	for _, path := range []string{"/metered/1", "/metered/2", "/metered/404"} {
+		if _, err := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := testutil.ToFloat64(httpRequests.WithLabelValues(route, fiber.MethodGet, "OK")) - requests; n != 2 {
+		t.Errorf("requests of route = %v, want 2", n)
+	}
+	if n := testutil.ToFloat64(httpRequests.WithLabelValues(route, fiber.MethodGet, "NOT_FOUND")) - failures; n != 1 {
+		t.Errorf("failed requests of route = %v, want 1", n)
+	}
+	if n := sampleCount(t, httpDuration.WithLabelValues(route, fiber.MethodGet, "OK")) - observed; n != 2 {
+		t.Errorf("observed durations = %d, want 2", n)
+	}
+	if n := testutil.ToFloat64(httpInFlight.WithLabelValues(fiber.MethodGet)); n != 0 {
+		t.Errorf("in flight = %v after requests", n)
+	}
+}
+
+func TestRegisterDBStats(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	for i := 0; i < 2; i++ {
+		if err = registerDBStats(db, "metrics_test"); err != nil {
+			t.Fatalf("register #%d: %v", i+1, err)
+		}
+	}
+}
+
+func sampleCount(t *testing.T, o prometheus.Observer) uint64 {
+	t.Helper()
+
+	var m dto.Metric
+	if err := o.(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
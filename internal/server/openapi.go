@@ -0,0 +1,357 @@
+package server
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gota33/errors"
+	"server/internal/route"
+	"server/internal/service/idempotency"
+	"server/internal/service/operation"
+)
+
+const (
+	endpointOpenAPI = "openapi.json"
+	endpointSwagger = "swagger"
+
+	openAPIVersion = "3.1.0"
+	mimeJSON       = fiber.MIMEApplicationJSON
+	schemaError    = "Error"
+)
+
+//go:embed swagger/index.html swagger/*.css swagger/*.js
+var swaggerFiles embed.FS
+
+var typeOperation = reflect.TypeOf(operation.Entity{})
+
+// Document is an OpenAPI 3.1 document.
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security,omitempty"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PathItem holds operations of a path by lower-cased HTTP method.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	Responses       map[string]*Response       `json:"responses"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// endpoint is a typed handler, its request and response types document the route.
+// Streams send any number of responses, see streamHandler, or events, see watch.
+type endpoint struct {
+	handle   fiber.Handler
+	name     string
+	stream   bool
+	events   bool
+	request  reflect.Type
+	response reflect.Type
+}
+
+// api collects operations while routes are registered.
+type api struct {
+	routes  []route.Route
+	paths   map[string]PathItem
+	schemas schemas
+	errors  map[errors.StatusCode]bool
+}
+
+func newAPI() *api {
+	return &api{
+		paths:   map[string]PathItem{},
+		schemas: schemas{},
+		errors:  map[errors.StatusCode]bool{},
+	}
+}
+
+// operation documents e served on a fiber route like "items/:itemID".
+func (a *api) operation(method, pattern string, e endpoint) {
+	a.routes = append(a.routes, route.Route{
+		Method:    method,
+		Path:      pattern,
+		Operation: e.name,
+		Stream:    e.stream,
+		Request:   e.request,
+		Response:  e.response,
+	})
+
+	p, vars := openAPIPath(pattern)
+	op := &Operation{
+		OperationID: e.name,
+		Tags:        []string{e.name[:strings.IndexByte(e.name+".", '.')]},
+		Responses:   map[string]*Response{},
+	}
+
+	op.Parameters = a.parameters(e.request, vars)
+	if method == fiber.MethodPost {
+		maxLength := uint64(idempotency.MaxKeyLength)
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:   headerIdempotencyKey,
+			In:     "header",
+			Schema: &Schema{Type: "string", MaxLength: &maxLength},
+		})
+	}
+	if method == fiber.MethodPost || method == fiber.MethodPut || method == fiber.MethodPatch {
+		content := map[string]MediaType{}
+		if a.hasBody(e.request) {
+			content[mimeJSON] = MediaType{Schema: a.schemas.of(e.request)}
+		}
+		if form := a.schemas.form(e.request); form != nil {
+			content[fiber.MIMEMultipartForm] = MediaType{Schema: form}
+		}
+		if len(content) > 0 {
+			op.RequestBody = &RequestBody{Required: true, Content: content}
+		}
+	}
+
+	// Status only responses, e.g. 204 of deletes
+	switch {
+	case e.events:
+		op.Responses[strconv.Itoa(http.StatusOK)] = &Response{
+			Description: "Server-Sent Events, data of each is the event",
+			Content:     map[string]MediaType{mimeEventStream: {Schema: a.schemas.of(e.response)}},
+		}
+	case e.stream:
+		op.Responses[strconv.Itoa(http.StatusOK)] = &Response{
+			Description: "Stream of responses, one per line",
+			Content: map[string]MediaType{
+				mimeNDJSON: {Schema: a.schemas.of(e.response)},
+				mimeCSV:    {Schema: &Schema{Type: "string"}},
+			},
+		}
+	case e.response.Kind() == reflect.Int:
+		op.Responses["2XX"] = &Response{Description: "Success without content"}
+	default:
+		op.Responses[strconv.Itoa(http.StatusOK)] = &Response{
+			Description: http.StatusText(http.StatusOK),
+			Content:     map[string]MediaType{mimeJSON: {Schema: a.schemas.of(e.response)}},
+		}
+		if e.response == typeOperation && method != fiber.MethodGet {
+			op.Responses[strconv.Itoa(http.StatusAccepted)] = &Response{
+				Description: "Operation not done yet, poll it by name",
+				Content:     map[string]MediaType{mimeJSON: {Schema: a.schemas.of(e.response)}},
+			}
+		}
+	}
+
+	codes := []errors.StatusCode{errors.InvalidArgument, errors.Unauthenticated}
+	if len(vars) > 0 {
+		codes = append(codes, errors.NotFound)
+	}
+	if method == fiber.MethodPost || method == fiber.MethodPatch {
+		codes = append(codes, errors.AlreadyExists)
+	}
+	for _, code := range codes {
+		a.errors[code] = true
+		op.Responses[strconv.Itoa(code.Http())] = &Response{Ref: "#/components/responses/" + string(code.Name())}
+	}
+	op.Responses["default"] = &Response{
+		Description: "Error",
+		Content:     map[string]MediaType{mimeJSON: {Schema: &Schema{Ref: "#/components/schemas/" + schemaError}}},
+	}
+
+	item, ok := a.paths[p]
+	if !ok {
+		item = PathItem{}
+		a.paths[p] = item
+	}
+	item[strings.ToLower(method)] = op
+}
+
+// parameters documents path, query, header and cookie fields of the request,
+// path variables without a field are parsed by the handler itself.
+func (a *api) parameters(t reflect.Type, vars []string) (params []Parameter) {
+	bound := make(map[string]bool, len(vars))
+	route.EachField(t, func(f reflect.StructField) {
+		for _, in := range route.BindingTags {
+			name := f.Tag.Get(in)
+			if name == "" || in == "form" {
+				continue
+			}
+			if in == "param" {
+				in, bound[name] = "path", true
+			}
+
+			schema := a.schemas.of(f.Type)
+			if f.Type == typeDuration {
+				// Parsed by time.ParseDuration, unlike durations of JSON bodies
+				schema = &Schema{Type: "string", Format: "duration"}
+			}
+			applyDefault(schema, f)
+			required := applyValidate(schema, f) || in == "path"
+			params = append(params, Parameter{Name: name, In: in, Required: required, Schema: schema})
+		}
+	})
+
+	for _, v := range vars {
+		if !bound[v] {
+			params = append(params, Parameter{Name: v, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+	return
+}
+
+func (a *api) hasBody(t reflect.Type) bool {
+	body := &Schema{Properties: map[string]*Schema{}}
+	if t.Kind() == reflect.Struct {
+		a.schemas.fields(t, body)
+	}
+	return len(body.Properties) > 0
+}
+
+func (a *api) document(title, version string) Document {
+	doc := Document{
+		OpenAPI: openAPIVersion,
+		Info:    Info{Title: title, Version: version},
+		Paths:   a.paths,
+		Components: Components{
+			Schemas:   a.schemas,
+			Responses: map[string]*Response{},
+			SecuritySchemes: map[string]*SecurityScheme{
+				"bearer": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+		// Token is optional, handlers needing a user reject anonymous requests
+		Security: []map[string][]string{{"bearer": {}}, {}},
+	}
+
+	doc.Components.Schemas[schemaError] = errorSchema()
+	for code := range a.errors {
+		doc.Components.Responses[string(code.Name())] = &Response{
+			Description: http.StatusText(code.Http()),
+			Content:     map[string]MediaType{mimeJSON: {Schema: &Schema{Ref: "#/components/schemas/" + schemaError}}},
+		}
+	}
+	return doc
+}
+
+// errorSchema describes errors encoded by gota33/errors, details follow google.rpc types.
+func errorSchema() *Schema {
+	status := &Schema{Type: "string"}
+	for code := errors.OK; code <= errors.Unauthenticated; code++ {
+		status.Enum = append(status.Enum, string(code.Name()))
+	}
+
+	detail := &Schema{
+		Type:                 "object",
+		Properties:           map[string]*Schema{"@type": {Type: "string", Format: "uri-reference"}},
+		Required:             []string{"@type"},
+		AdditionalProperties: &Schema{},
+	}
+	body := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"code":    {Type: "integer", Format: "int32", Description: "HTTP status code"},
+			"message": {Type: "string"},
+			"status":  status,
+			"details": {Type: "array", Items: detail},
+		},
+		Required: []string{"code", "message", "status"},
+	}
+	return &Schema{
+		Type:       "object",
+		Properties: map[string]*Schema{"error": body},
+		Required:   []string{"error"},
+	}
+}
+
+// openAPIPath converts fiber routes to OpenAPI paths, e.g. "items/:itemID" to "/items/{itemID}".
+func openAPIPath(route string) (p string, vars []string) {
+	segments := strings.Split(path.Join("/", route), "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			name, verb, _ := strings.Cut(segment[1:], ":")
+			vars = append(vars, name)
+			segments[i] = "{" + name + "}"
+			if verb != "" {
+				segments[i] += ":" + verb
+			}
+		}
+	}
+	p = strings.ReplaceAll(strings.Join(segments, "/"), "\\:", ":")
+	return
+}
+
+// openAPI serves the document generated when routes were registered.
+func openAPI(doc []byte) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, mimeJSON)
+		return c.Send(doc)
+	}
+}
+
+func swaggerUI(c *fiber.Ctx) error {
+	return sendSwaggerFile(c, "index.html")
+}
+
+// swaggerAsset serves scripts and styles of the page, see swagger/README.md.
+func swaggerAsset(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=86400")
+	return sendSwaggerFile(c, c.Params("file"))
+}
+
+func sendSwaggerFile(c *fiber.Ctx, name string) error {
+	data, err := swaggerFiles.ReadFile(path.Join(endpointSwagger, name))
+	if err != nil {
+		return fiber.ErrNotFound
+	}
+	c.Type(strings.TrimPrefix(path.Ext(name), "."), "utf-8")
+	return c.Send(data)
+}
+
+// OpenAPI generates the document of all routes.
+func OpenAPI(c Config) ([]byte, error) {
+	return json.MarshalIndent(describe(c).document(c.Name, c.Version), "", "  ")
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestOpenAPIPath(t *testing.T) {
+	tests := []struct {
+		route, path string
+		vars        []string
+	}{
+		{"items", "/items", nil},
+		{"items/:itemID", "/items/{itemID}", []string{"itemID"}},
+		{"customers/:customerID/carts/:cartID", "/customers/{customerID}/carts/{cartID}", []string{"customerID", "cartID"}},
+		{"items/:itemID:restore", "/items/{itemID}:restore", []string{"itemID"}},
+		{"items\\:watch", "/items:watch", nil},
+	}
+	for _, tt := range tests {
+		p, vars := openAPIPath(tt.route)
+		if p != tt.path || !reflect.DeepEqual(vars, tt.vars) {
+			t.Errorf("openAPIPath(%q) = %q %v, want %q %v", tt.route, p, vars, tt.path, tt.vars)
+		}
+	}
+}
+
+type updateThingRequest struct {
+	ThingID string      `param:"thingID"`
+	DryRun  bool        `query:"dryRun"`
+	Thing   schemaThing `json:"thing" validate:"required"`
+}
+
+func TestAPIOperation(t *testing.T) {
+	a := newAPI()
+	a.operation(fiber.MethodPatch, "things/:thingID", endpoint{
+		name:     "thing.Service.Update",
+		request:  reflect.TypeOf(updateThingRequest{}),
+		response: reflect.TypeOf(schemaThing{}),
+	})
+	a.operation(fiber.MethodDelete, "things/:thingID", endpoint{
+		name:     "thing.Service.Delete",
+		request:  reflect.TypeOf(struct{ ThingID string }{}),
+		response: reflect.TypeOf(0),
+	})
+	doc := a.document("things", "v1")
+
+	update := doc.Paths["/things/{thingID}"]["patch"]
+	if update == nil || update.OperationID != "thing.Service.Update" || !reflect.DeepEqual(update.Tags, []string{"thing"}) {
+		t.Fatalf("update = %+v", update)
+	}
+	wantParams := []Parameter{
+		{Name: "thingID", In: "path", Required: true, Schema: &Schema{Type: "string"}},
+		{Name: "dryRun", In: "query", Schema: &Schema{Type: "boolean"}},
+	}
+	if !reflect.DeepEqual(update.Parameters, wantParams) {
+		t.Errorf("parameters = %+v, want %+v", update.Parameters, wantParams)
+	}
+	body := doc.Components.Schemas["server.updateThingRequest"]
+	if update.RequestBody == nil || body == nil || len(body.Properties) != 1 || body.Properties["thing"] == nil {
+		t.Errorf("request body = %+v, schema %+v, want only the thing", update.RequestBody, body)
+	}
+	if got := update.Responses["200"].Content[mimeJSON].Schema.Ref; got != "#/components/schemas/server.schemaThing" {
+		t.Errorf("response = %q", got)
+	}
+	for status, name := range map[string]string{"400": "INVALID_ARGUMENT", "404": "NOT_FOUND", "409": "ALREADY_EXISTS"} {
+		if res := update.Responses[status]; res == nil || res.Ref != "#/components/responses/"+name {
+			t.Errorf("response %s = %+v, want a ref of %s", status, res, name)
+		}
+		if doc.Components.Responses[name] == nil {
+			t.Errorf("response %s isn't a component", name)
+		}
+	}
+
+	// Delete has no body and responds with a status only
+	del := doc.Paths["/things/{thingID}"]["delete"]
+	if del == nil || del.RequestBody != nil || del.Responses["2XX"] == nil || del.Responses["409"] != nil {
+		t.Errorf("delete = %+v", del)
+	}
+	if len(del.Parameters) != 1 || del.Parameters[0].Name != "thingID" || !del.Parameters[0].Required {
+		t.Errorf("parameters of delete = %+v, want the path variable", del.Parameters)
+	}
+
+	if doc.OpenAPI != openAPIVersion || doc.Components.Schemas[schemaError] == nil {
+		t.Errorf("document = %+v", doc)
+	}
+}
@@ -1,37 +1,204 @@
 package server
 
 import (
+	"path"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
+	"server/internal/route"
+	"server/internal/service/cart"
+	"server/internal/service/customer"
 	"server/internal/service/demo"
+	"server/internal/service/entity"
 	"server/internal/service/item"
+	"server/internal/service/job"
+	"server/internal/service/operation"
+	"server/internal/service/webhook"
 )
 
+// Routes lists typed routes, clients call them by operation, see route.OperationName.
+func Routes() []route.Route {
+	return describe(Config{}).routes
+}
+
+// describe registers routes on a detached app, without serving or touching databases.
+func describe(c Config) *api {
+	r := router{Router: fiber.New(), config: c, health: &health{}, api: newAPI()}
+	r.setup()
+	return r.api
+}
+
 type router struct {
 	fiber.Router
 	config Config
+	health *health
+	api    *api
+	prefix string
 }
 
 func (r router) setup() {
+	r.history()
 	r.demo()
 	r.item()
+	r.customer()
+	r.cart()
+	r.webhook()
+	r.operation()
 	// TODO: More modules here...
 }
 
+// history checks the revision and outbox tables, which every module writes to.
+func (r router) history() {
+	r.health.Register("history", entity.CheckTables(r.config.RDS, "revision", "outbox"))
+}
+
 func (r router) demo() {
 	srv := demo.New()
 
-	g := r.Group("demo")
-	g.Get("hello", handler(srv.Hello))
+	g := r.group("demo")
+	g.get("hello", handler(srv.Hello))
 	// TODO: More actions here...
 }
 
 func (r router) item() {
-	srv := item.New(r.config.RDS)
-
-	g := r.Group("items")
-	g.Post("", handler(srv.Create))
-	g.Get("", handler(srv.List))
-	g.Get(":itemID", handler(srv.Get))
-	g.Patch(":itemID", handler(srv.Update))
-	g.Delete(":itemID", handler(srv.Delete))
+	srv := item.New(r.config.RDS, r.config.Operations)
+	r.health.Register("item", srv.Check)
+
+	p := item.Pattern
+	r.post(p.CollectionRoute(), handler(srv.Create))
+	r.get(p.CollectionRoute(), handler(srv.List))
+	r.get(p.CollectionRoute()+"\\:watch", r.watch("item"))
+	r.get(p.CollectionRoute()+"\\:export", streamHandler(srv.Export))
+	r.post(p.CollectionRoute()+"\\:import", handler(srv.Import))
+	r.get(p.Route(), handler(srv.Get))
+	r.patch(p.Route(), handler(srv.Update))
+	r.delete(p.Route(), handler(srv.Delete))
+	r.custom(p.Route(), customMethods{
+		"restore": handler(srv.Restore),
+	})
+	r.get(p.Route()+"/revisions", handler(srv.ListRevisions))
+}
+
+func (r router) customer() {
+	srv := customer.New(r.config.RDS)
+	r.health.Register("customer", srv.Check)
+
+	p := customer.Pattern
+	r.post(p.CollectionRoute(), handler(srv.Create))
+	r.get(p.CollectionRoute(), handler(srv.List))
+	r.get(p.Route(), handler(srv.Get))
+	r.patch(p.Route(), handler(srv.Update))
+	r.delete(p.Route(), handler(srv.Delete))
+}
+
+func (r router) cart() {
+	srv := cart.New(r.config.RDS)
+	r.health.Register("cart", srv.Check)
+
+	p := cart.Pattern
+	r.post(p.CollectionRoute(), handler(srv.Create))
+	r.get(p.CollectionRoute(), handler(srv.List))
+	r.get(p.Route(), handler(srv.Get))
+	r.patch(p.Route(), handler(srv.Update))
+	r.delete(p.Route(), handler(srv.Delete))
+
+	r.schedule("cart.expire", "@hourly", srv.Expire)
+}
+
+func (r router) webhook() {
+	srv := webhook.New(r.config.RDS)
+	r.health.Register("webhook", srv.Check)
+
+	p := webhook.Pattern
+	r.post(p.CollectionRoute(), handler(srv.Create))
+	r.get(p.CollectionRoute(), handler(srv.List))
+	r.get(p.Route(), handler(srv.Get))
+	r.patch(p.Route(), handler(srv.Update))
+	r.delete(p.Route(), handler(srv.Delete))
+
+	d := webhook.DeliveryPattern
+	r.get(d.CollectionRoute(), handler(srv.ListDeliveries))
+	r.get(d.Route(), handler(srv.GetDelivery))
+	r.custom(d.Route(), customMethods{
+		"redeliver": handler(srv.Redeliver),
+	})
+}
+
+func (r router) operation() {
+	srv := operation.New(r.config.RDS, r.config.Operations)
+	r.health.Register("operation", srv.Check)
+
+	p := operation.Pattern
+	r.get(p.CollectionRoute(), handler(srv.List))
+	r.get(p.Route(), handler(srv.Get))
+	r.custom(p.Route(), customMethods{
+		"cancel": handler(srv.Cancel),
+	})
+
+	r.schedule("operation.purge", "@daily", srv.Purge)
+}
+
+// schedule registers a job of a service, there's no scheduler when routes are only described.
+func (r router) schedule(name, spec string, fn job.Func) {
+	if r.config.Scheduler == nil {
+		return
+	}
+	if err := r.config.Scheduler.Register(name, spec, fn); err != nil {
+		panic(err)
+	}
+}
+
+func (r router) group(prefix string) router {
+	r.Router = r.Group(prefix)
+	r.prefix = path.Join(r.prefix, prefix)
+	return r
+}
+
+// handle registers e and documents it in the OpenAPI spec.
+func (r router) handle(method, route string, e endpoint) {
+	r.Add(method, route, e.handle)
+	r.api.operation(method, path.Join(r.prefix, route), e)
+}
+
+func (r router) get(route string, e endpoint) {
+	r.handle(fiber.MethodGet, route, e)
+}
+
+func (r router) post(route string, e endpoint) {
+	r.handle(fiber.MethodPost, route, e)
+}
+
+func (r router) patch(route string, e endpoint) {
+	r.handle(fiber.MethodPatch, route, e)
+}
+
+func (r router) delete(route string, e endpoint) {
+	r.handle(fiber.MethodDelete, route, e)
+}
+
+// custom registers custom methods of a resource, documented as "items/{itemID}:restore".
+func (r router) custom(route string, m customMethods) {
+	r.Post(route, m.handle)
+	for verb, e := range m {
+		r.api.operation(fiber.MethodPost, path.Join(r.prefix, route)+":"+verb, e)
+	}
+}
+
+// customMethods dispatches AIP-136 custom methods on a resource route,
+// e.g. "items/1:restore". fiber can't end a route parameter with an escaped
+// colon, so the verb is cut from the last path segment instead.
+type customMethods map[string]endpoint
+
+// localVerb keeps the verb of the custom method being handled, see paramValues.
+const localVerb = "verb"
+
+func (m customMethods) handle(c *fiber.Ctx) error {
+	path := c.Path()
+	if i := strings.LastIndexByte(path, ':'); i > strings.LastIndexByte(path, '/') {
+		if e, ok := m[path[i+1:]]; ok {
+			c.Locals(localVerb, path[i+1:])
+			return e.handle(c)
+		}
+	}
+	return fiber.ErrNotFound
 }
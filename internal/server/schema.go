@@ -0,0 +1,341 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/route"
+)
+
+// Schema is the subset of JSON Schema 2020-12 used by OpenAPI 3.1 documents.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+	MinLength            *uint64            `json:"minLength,omitempty"`
+	MaxLength            *uint64            `json:"maxLength,omitempty"`
+	MinItems             *uint64            `json:"minItems,omitempty"`
+	MaxItems             *uint64            `json:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+}
+
+var (
+	typeTime       = reflect.TypeOf(time.Time{})
+	typeRawMessage = reflect.TypeOf(json.RawMessage{})
+	invalidName    = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+)
+
+// validateFormats maps validator tags without parameters to formats or patterns.
+var validateFormats = map[string]Schema{
+	"email":        {Format: "email"},
+	"url":          {Format: "uri"},
+	"uri":          {Format: "uri"},
+	"uuid":         {Format: "uuid"},
+	"datetime":     {Format: "date-time"},
+	"ip":           {AnyOf: []*Schema{{Format: "ipv4"}, {Format: "ipv6"}}},
+	"ipv4":         {Format: "ipv4"},
+	"ipv6":         {Format: "ipv6"},
+	"hostname":     {Format: "hostname"},
+	"alpha":        {Pattern: "^[a-zA-Z]+$"},
+	"alphanum":     {Pattern: "^[a-zA-Z0-9]+$"},
+	"alphaunicode": {Pattern: `^\p{L}+$`},
+	"numeric":      {Pattern: `^[-+]?[0-9]+(?:\.[0-9]+)?$`},
+}
+
+// schemas builds schemas from Go types the way encoding/json marshals them,
+// named structs are collected as components and referenced.
+type schemas map[string]*Schema
+
+func (s schemas) of(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case typeTime:
+		return &Schema{Type: "string", Format: "date-time"}
+	case typeRawMessage:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &Schema{Type: "array", Items: s.of(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.of(t.Elem())}
+	case reflect.Struct:
+		return s.ref(t)
+	default:
+		return &Schema{}
+	}
+}
+
+// ref collects t as a component, anonymous structs are inlined.
+func (s schemas) ref(t reflect.Type) *Schema {
+	name := schemaName(t)
+	if name == "" {
+		return s.object(t)
+	}
+	if _, ok := s[name]; !ok {
+		// Reserve the name first, so recursive types end up referencing it
+		s[name] = &Schema{}
+		*s[name] = *s.object(t)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func (s schemas) object(t reflect.Type) *Schema {
+	res := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s.fields(t, res)
+	return res
+}
+
+// fields adds body fields of t to res, fields of embedded structs are promoted,
+// unless a field of the outer struct has the same name.
+func (s schemas) fields(t reflect.Type, res *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if route.IsBound(f) {
+			continue
+		}
+
+		tag := f.Tag.Get("json")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			embedded := &Schema{Properties: map[string]*Schema{}}
+			s.fields(ft, embedded)
+			for key, value := range embedded.Properties {
+				if _, ok := res.Properties[key]; !ok {
+					res.Properties[key] = value
+				}
+			}
+			for _, key := range embedded.Required {
+				if res.Properties[key] == embedded.Properties[key] {
+					res.Required = append(res.Required, key)
+				}
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := s.of(f.Type)
+		if strings.Contains(opts, "string") && (prop.Type == "integer" || prop.Type == "number" || prop.Type == "boolean") {
+			prop = &Schema{Type: "string", Format: prop.Format}
+		}
+		res.Required = without(res.Required, name)
+		applyDefault(prop, f)
+		if applyValidate(prop, f) {
+			res.Required = append(res.Required, name)
+		}
+		res.Properties[name] = prop
+	}
+}
+
+// applyValidate maps validator rules of f into constraints of prop,
+// rules after "dive" apply to elements and are left out.
+func applyValidate(prop *Schema, f reflect.StructField) (required bool) {
+	tag := f.Tag.Get("validate")
+	if tag == "" || prop.Ref != "" {
+		return tag != "" && strings.Contains(","+tag+",", ",required,")
+	}
+
+	t := f.Type
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	kind := t.Kind()
+
+	for _, rule := range strings.Split(tag, ",") {
+		key, param, _ := strings.Cut(rule, "=")
+		switch key {
+		case "dive":
+			return
+		case "required":
+			required = true
+		case "oneof":
+			for _, value := range strings.Fields(param) {
+				if n, err := strconv.ParseFloat(value, 64); err == nil && prop.Type != "string" {
+					prop.Enum = append(prop.Enum, n)
+				} else {
+					prop.Enum = append(prop.Enum, value)
+				}
+			}
+		case "min", "max", "len", "gt", "gte", "lt", "lte":
+			n, err := strconv.ParseFloat(param, 64)
+			// Numbers encoded as strings, e.g. `json:",string"`, can't be bounded
+			if err != nil || (prop.Type == "string" && kind != reflect.String) {
+				continue
+			}
+			applyBound(prop, kind, key, n)
+		default:
+			if format, ok := validateFormats[key]; ok {
+				if format.Format != "" {
+					prop.Format = format.Format
+				}
+				if format.Pattern != "" {
+					prop.Pattern = format.Pattern
+				}
+				if format.AnyOf != nil {
+					prop.AnyOf = format.AnyOf
+				}
+			}
+		}
+	}
+	return
+}
+
+// applyDefault documents values set by bindDefaults, typed like the property.
+func applyDefault(prop *Schema, f reflect.StructField) {
+	value, ok := f.Tag.Lookup(tagDefault)
+	if !ok {
+		return
+	}
+
+	var err error
+	switch prop.Type {
+	case "integer":
+		prop.Default, err = strconv.ParseInt(value, 10, 64)
+	case "number":
+		prop.Default, err = strconv.ParseFloat(value, 64)
+	case "boolean":
+		prop.Default, err = strconv.ParseBool(value)
+	default:
+		prop.Default = value
+	}
+	if err != nil {
+		prop.Default = nil
+	}
+}
+
+// form documents fields bound from multipart forms, nil if t has none.
+func (s schemas) form(t reflect.Type) (res *Schema) {
+	route.EachField(t, func(f reflect.StructField) {
+		name := f.Tag.Get("form")
+		if name == "" {
+			return
+		}
+		if res == nil {
+			res = &Schema{Type: "object", Properties: map[string]*Schema{}}
+		}
+
+		var prop *Schema
+		switch {
+		case f.Type == typeFileHeader:
+			prop = &Schema{Type: "string", Format: "binary"}
+		case isFileType(f.Type):
+			prop = &Schema{Type: "array", Items: &Schema{Type: "string", Format: "binary"}}
+		default:
+			prop = s.of(f.Type)
+			applyDefault(prop, f)
+		}
+		if applyValidate(prop, f) {
+			res.Required = append(res.Required, name)
+		}
+		res.Properties[name] = prop
+	})
+	return
+}
+
+// applyBound limits values of numbers, lengths of strings and sizes of collections,
+// like validator does depending on the kind.
+func applyBound(prop *Schema, kind reflect.Kind, key string, n float64) {
+	size := uint64(n)
+
+	switch kind {
+	case reflect.String:
+		switch key {
+		case "min", "gte":
+			prop.MinLength = &size
+		case "max", "lte":
+			prop.MaxLength = &size
+		case "len":
+			prop.MinLength, prop.MaxLength = &size, &size
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		switch key {
+		case "min", "gte":
+			prop.MinItems = &size
+		case "max", "lte":
+			prop.MaxItems = &size
+		case "len":
+			prop.MinItems, prop.MaxItems = &size, &size
+		}
+	default:
+		switch key {
+		case "min", "gte":
+			prop.Minimum = &n
+		case "max", "lte":
+			prop.Maximum = &n
+		case "len":
+			prop.Minimum, prop.Maximum = &n, &n
+		case "gt":
+			prop.ExclusiveMinimum = &n
+		case "lt":
+			prop.ExclusiveMaximum = &n
+		}
+	}
+}
+
+// schemaName names components after package and type, e.g. "item.Entity".
+func schemaName(t reflect.Type) string {
+	if t.Name() == "" {
+		return ""
+	}
+	pkg := t.PkgPath()
+	pkg = pkg[strings.LastIndexByte(pkg, '/')+1:]
+	return invalidName.ReplaceAllString(pkg+"."+t.Name(), "_")
+}
+
+func without(values []string, value string) []string {
+	for i, v := range values {
+		if v == value {
+			return append(values[:i], values[i+1:]...)
+		}
+	}
+	return values
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type schemaBase struct {
+	ID    string `json:"id"`
+	Title string `json:"title" validate:"required"`
+}
+
+type schemaThing struct {
+	schemaBase
+	Title    int               `json:"title"`
+	Price    int64             `json:"price,string" validate:"required,min=1"`
+	Code     string            `json:"code" validate:"len=4,alphanum"`
+	Status   string            `json:"status" validate:"oneof=open closed"`
+	Level    int               `json:"level" validate:"oneof=1 2" default:"1"`
+	Addr     string            `json:"addr" validate:"ip"`
+	Tags     []string          `json:"tags" validate:"max=3,dive,min=1"`
+	Labels   map[string]string `json:"labels"`
+	Time     time.Time         `json:"time"`
+	Parent   *schemaThing      `json:"parent"`
+	Data     []byte            `json:"data"`
+	Skipped  string            `json:"-"`
+	internal string
+}
+
+func TestSchemaOf(t *testing.T) {
+	s := schemas{}
+	ref := s.of(reflect.TypeOf(&schemaThing{}))
+	if want := "#/components/schemas/server.schemaThing"; ref.Ref != want {
+		t.Fatalf("ref = %q, want %q", ref.Ref, want)
+	}
+
+	thing := s["server.schemaThing"]
+	if got, want := thing.Properties["parent"].Ref, ref.Ref; got != want {
+		t.Errorf("parent ref = %q, want %q", got, want)
+	}
+	for _, name := range []string{"Skipped", "-", "internal", "schemaBase"} {
+		if _, ok := thing.Properties[name]; ok {
+			t.Errorf("property %q is documented", name)
+		}
+	}
+	if got := thing.Properties["id"]; got == nil || got.Type != "string" {
+		t.Errorf("promoted id = %+v, want a string", got)
+	}
+	if got := thing.Properties["title"]; got.Type != "integer" {
+		t.Errorf("shadowed title = %+v, want the outer integer", got)
+	}
+	if want := []string{"price"}; !reflect.DeepEqual(thing.Required, want) {
+		t.Errorf("required = %v, want %v", thing.Required, want)
+	}
+
+	four, three := uint64(4), uint64(3)
+	for name, want := range map[string]*Schema{
+		"price":  {Type: "string", Format: "int64"},
+		"code":   {Type: "string", MinLength: &four, MaxLength: &four, Pattern: "^[a-zA-Z0-9]+$"},
+		"status": {Type: "string", Enum: []any{"open", "closed"}},
+		"level":  {Type: "integer", Format: "int64", Enum: []any{1.0, 2.0}, Default: int64(1)},
+		"addr":   {Type: "string", AnyOf: []*Schema{{Format: "ipv4"}, {Format: "ipv6"}}},
+		"tags":   {Type: "array", Items: &Schema{Type: "string"}, MaxItems: &three},
+		"labels": {Type: "object", AdditionalProperties: &Schema{Type: "string"}},
+		"time":   {Type: "string", Format: "date-time"},
+		"data":   {Type: "string", ContentEncoding: "base64"},
+	} {
+		if got := thing.Properties[name]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %+v, want %+v", name, got, want)
+		}
+	}
+}
@@ -1,66 +1,278 @@
 package server
 
 import (
-	"bytes"
 	"context"
+	"crypto/tls"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/adaptor/v2"
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gota33/errors"
 	"github.com/gota33/initializr"
-	"github.com/mitchellh/mapstructure"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"server/internal/route"
 	"server/internal/service/auth"
 	"server/internal/service/entity"
+	"server/internal/service/event"
+	"server/internal/service/idempotency"
+	"server/internal/service/job"
+	"server/internal/service/operation"
+	"server/internal/service/trace"
 )
 
 const (
 	endpointHealth  = "healthz"
 	endpointMetrics = "metrics"
-	timeout         = 10 * time.Second
+	unixPrefix      = "unix:"
 )
 
 type Config struct {
+	// Addr is a TCP address, or a unix socket like "unix:/run/app.sock"
 	Addr string
-	RDS  *sql.DB
+	// AdminAddr serves metrics, health, pprof and runtime settings if set,
+	// otherwise metrics and health are served on Addr.
+	AdminAddr string
+	// GRPCAddr serves services over gRPC too if set, e.g. ":9090"
+	GRPCAddr   string
+	Name       string
+	Version    string
+	Debug      bool
+	AccessLog  AccessLog
+	RDS        *sql.DB
+	Events     *event.Bus
+	Dispatcher *event.Dispatcher
+	Operations *operation.Runner
+	Scheduler  *job.Scheduler
+	// Idempotency replays responses of POST requests retried with an Idempotency-Key if set
+	Idempotency *idempotency.Store
+
+	IdleTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// RequestTimeout bounds contexts passed to services, RouteTimeouts overrides it
+	// by method and route template, e.g. "GET /items". Zero means no deadline.
+	RequestTimeout time.Duration
+	RouteTimeouts  map[string]time.Duration
+
+	// BodyLimit and Concurrency fall back to fiber defaults when zero
+	BodyLimit   int
+	Concurrency int
+
+	// ProxyHeader is trusted for client IP, e.g. "X-Forwarded-For", only when
+	// the peer is one of TrustedProxies (IPs or CIDRs) if any is given.
+	ProxyHeader    string
+	TrustedProxies []string
+	Prefork        bool
+	TLS            TLS
+
+	// DrainDelay keeps serving after readiness fails on shutdown,
+	// so load balancers stop routing before connections are drained.
+	// It should exceed the period of readiness probes, 5s by default.
+	DrainDelay time.Duration
+
+	// SwaggerUI serves a page browsing the OpenAPI spec, which is always served.
+	SwaggerUI bool
 }
 
 func Run(ctx context.Context, c Config) (err error) {
+	if err = registerDBStats(c.RDS, "rds"); err != nil {
+		return
+	}
+
+	network, addr := "tcp", c.Addr
+	if strings.HasPrefix(addr, unixPrefix) {
+		network, addr = "unix", strings.TrimPrefix(addr, unixPrefix)
+		if c.Prefork {
+			return fmt.Errorf("prefork can't listen on unix socket %q", addr)
+		}
+	}
+	if c.Prefork && c.TLS.Enabled() {
+		return fmt.Errorf("prefork can't serve TLS with certificate reload")
+	}
+
 	srv := fiber.New(fiber.Config{
-		IdleTimeout:  timeout,
-		ReadTimeout:  timeout,
-		WriteTimeout: timeout,
-		ErrorHandler: handleError,
+		IdleTimeout:             c.IdleTimeout,
+		ReadTimeout:             c.ReadTimeout,
+		WriteTimeout:            c.WriteTimeout,
+		BodyLimit:               c.BodyLimit,
+		Concurrency:             c.Concurrency,
+		ProxyHeader:             c.ProxyHeader,
+		EnableTrustedProxyCheck: len(c.TrustedProxies) > 0,
+		TrustedProxies:          c.TrustedProxies,
+		Prefork:                 c.Prefork,
+		ErrorHandler:            errorHandler(c.Debug),
 	})
 
-	srv.Use(logger.New())
 	srv.Use(initUserContext)
+	srv.Use(initDeadline(c.RequestTimeout, c.WriteTimeout, c.RouteTimeouts))
+	srv.Use(initTraceContext)
+	srv.Use(accessLog(c.AccessLog))
+	srv.Use(recordMetrics)
+	srv.Use(recoverPanic())
 	srv.Use(initAuthContext)
+	if c.Idempotency != nil {
+		srv.Use(idempotent(c.Idempotency))
+	}
+
+	h := &health{}
+	h.Register("rds", c.RDS.PingContext)
 
-	srv.Get(endpointHealth, health())
-	srv.Get(endpointMetrics, metrics())
+	// Children of prefork only serve requests, the parent runs admin and background jobs
+	var admin *fiber.App
+	switch {
+	case c.AdminAddr == "":
+		mountOps(srv, h)
+	case !fiber.IsChild():
+		admin = newAdmin(c, h)
+	}
 
-	r := router{Router: srv, config: c}
+	r := router{Router: srv, config: c, health: h, api: newAPI()}
 	r.setup()
+	if c.Idempotency != nil {
+		r.schedule("idempotency.purge", "@hourly", c.Idempotency.Purge)
+	}
 
-	listen := func() error {
-		return srv.Listen(c.Addr)
+	var spec []byte
+	if spec, err = json.Marshal(r.api.document(c.Name, c.Version)); err != nil {
+		return
+	}
+	srv.Get(endpointOpenAPI, openAPI(spec))
+	if c.SwaggerUI {
+		srv.Get(endpointSwagger, swaggerUI)
+		srv.Get(endpointSwagger+"/:file", swaggerAsset)
+	}
+
+	bgCtx, cancelBg := context.WithCancel(ctx)
+	defer cancelBg()
+
+	var bg sync.WaitGroup
+	c.Operations.EncodeError = operationError(c.Debug)
+	if !fiber.IsChild() {
+		bg.Add(3)
+		go func() {
+			defer bg.Done()
+			c.Dispatcher.Run(bgCtx)
+		}()
+		go func() {
+			defer bg.Done()
+			c.Operations.Run(bgCtx)
+		}()
+		go func() {
+			defer bg.Done()
+			c.Scheduler.Run(bgCtx)
+		}()
 	}
 
-	shutdown := func() {
-		if shutdownErr := srv.Shutdown(); shutdownErr != nil {
-			logrus.WithError(shutdownErr).Warn("Shutdown server error")
+	var tlsConfig, grpcTLSConfig *tls.Config
+	if c.TLS.Enabled() {
+		var reloader *certReloader
+		if reloader, err = newCertReloader(c.TLS); err != nil {
+			return
+		}
+		tlsConfig = reloader.configure(srv)
+		grpcTLSConfig = reloader.grpcConfig()
+
+		bg.Add(1)
+		go func() {
+			defer bg.Done()
+			reloader.watch(bgCtx)
+		}()
+	}
+
+	serve := func() error {
+		if network == "tcp" && tlsConfig == nil {
+			return srv.Listen(addr)
+		}
+
+		if network == "unix" {
+			if removeErr := removeSocket(addr); removeErr != nil {
+				return removeErr
+			}
+		}
+		ln, listenErr := net.Listen(network, addr)
+		if listenErr != nil {
+			return listenErr
+		}
+		if tlsConfig != nil {
+			ln = tls.NewListener(ln, tlsConfig)
+		}
+		return srv.Listener(ln)
+	}
+
+	var grpcSrv *grpc.Server
+	if c.GRPCAddr != "" && !fiber.IsChild() {
+		grpcSrv = newGRPC(c, grpcTLSConfig)
+	}
+
+	// Admin is shut down last, so readiness can be watched while draining.
+	// Servers failing to start have nothing to drain.
+	var stopOnce sync.Once
+	stop := func(drain bool) {
+		stopOnce.Do(func() {
+			if drain {
+				h.drain()
+				time.Sleep(c.DrainDelay)
+			}
+
+			if shutdownErr := srv.Shutdown(); shutdownErr != nil {
+				logrus.WithError(shutdownErr).Warn("Shutdown server error")
+			}
+			if grpcSrv != nil {
+				grpcSrv.GracefulStop()
+			}
+			if admin != nil {
+				if shutdownErr := admin.Shutdown(); shutdownErr != nil {
+					logrus.WithError(shutdownErr).Warn("Shutdown admin server error")
+				}
+			}
+			cancelBg()
+			bg.Wait()
+		})
+	}
+
+	// All listeners run until shutdown, any failing to serve stops the others
+	listen := func() error {
+		listeners := []func() error{serve}
+		if admin != nil {
+			listeners = append(listeners, func() error { return admin.Listen(c.AdminAddr) })
+		}
+		if grpcSrv != nil {
+			listeners = append(listeners, func() error {
+				ln, listenErr := net.Listen("tcp", c.GRPCAddr)
+				if listenErr != nil {
+					return listenErr
+				}
+				return grpcSrv.Serve(ln)
+			})
+		}
+
+		errs := make(chan error, len(listeners))
+		for _, l := range listeners {
+			go func(l func() error) { errs <- l() }(l)
+		}
+		for range listeners {
+			if listenErr := <-errs; listenErr != nil {
+				stop(false)
+				return listenErr
+			}
 		}
+		return nil
 	}
 
+	shutdown := func() { stop(true) }
+
 	return initializr.Run(ctx, listen, shutdown)
 }
 
@@ -70,91 +282,40 @@ func initUserContext(c *fiber.Ctx) (err error) {
 }
 
 func initAuthContext(c *fiber.Ctx) (err error) {
-	if token := c.Get(fiber.HeaderAuthorization); token != "" {
-		var user auth.User
-		if err = user.FromJWT(token); err != nil {
-			return errors.Annotate(err, errors.Unauthenticated)
-		}
+	user, ok, err := userOf(c.Get(fiber.HeaderAuthorization), c.Context().TLSConnectionState())
+	if err != nil {
+		return errors.Annotate(err, errors.Unauthenticated)
+	}
+	c.SetUserContext(auth.WithClientIP(c.UserContext(), c.IP()))
+	if ok {
 		c.SetUserContext(user.WithContext(c.UserContext()))
 	}
 	return c.Next()
 }
 
-func health() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		return c.SendStatus(http.StatusOK)
-	}
-}
-
 func metrics() fiber.Handler {
 	return adaptor.HTTPHandler(promhttp.Handler())
 }
 
-func handleError(c *fiber.Ctx, cause error) error {
-	var (
-		err          error
-		fiberErr     *fiber.Error
-		validateErrs validator.ValidationErrors
-	)
-	switch {
-	case errors.As(cause, &fiberErr):
-		var status errors.StatusCode
-		switch fiberErr.Code {
-		case http.StatusBadRequest:
-			status = errors.InvalidArgument
-		case http.StatusNotFound:
-			status = errors.NotFound
-		// TODO: Handle more codes...
-		default:
-			status = errors.Unknown
-		}
-		err = errors.Annotate(fiberErr, status)
-	case errors.As(cause, &validateErrs):
-		details := errors.BadRequest{
-			FieldViolations: make([]errors.FieldViolation, len(validateErrs)),
-		}
-		for i, subErr := range validateErrs {
-			details.FieldViolations[i] = errors.FieldViolation{
-				Field:       subErr.Field(),
-				Description: subErr.Error(),
-			}
-		}
-		err = errors.WithBadRequest(cause, details)
-	default:
-		err = cause
-	}
-
-	buf := &bytes.Buffer{}
-	enc := errors.NewEncoder(json.NewEncoder(buf))
-	if encErr := enc.Encode(err); encErr != nil {
-		return fiber.DefaultErrorHandler(c, encErr)
-	}
-
-	return c.
-		Status(errors.Code(err).Http()).
-		JSON(json.RawMessage(buf.Bytes()))
-}
+func handler[Request any, Response any](h func(context.Context, Request) (Response, error)) endpoint {
+	name := handlerName(h)
 
-func handler[Request any, Response any](h func(context.Context, Request) (Response, error)) fiber.Handler {
-	return func(c *fiber.Ctx) (err error) {
+	handle := func(c *fiber.Ctx) (err error) {
 		var (
 			req Request
 			res Response
 		)
-		if err = c.BodyParser(&req); err != nil && !errors.Is(err, fiber.ErrUnprocessableEntity) {
-			return
-		}
-		if err = c.QueryParser(&req); err != nil {
+		if err = parseRequest(c, &req); err != nil {
 			return
 		}
-		if err = paramParser(c, &req); err != nil {
-			return
-		}
-		// TODO: More parsers here...
-		if err = doValidate(c, req); err != nil {
-			return
-		}
-		if res, err = h(c.UserContext(), req); err != nil {
+
+		ctx, cancel := withDeadline(c)
+		defer cancel()
+
+		ctx, span := trace.Start(ctx, name)
+		res, err = h(ctx, req)
+		trace.End(span, err)
+		if err != nil {
 			return
 		}
 
@@ -162,49 +323,69 @@ func handler[Request any, Response any](h func(context.Context, Request) (Respon
 		switch v := temp.(type) {
 		case int:
 			return c.SendStatus(v)
+		case operation.Entity:
+			// Operations started but not done are accepted, clients poll them until done
+			if !v.Done && c.Method() != fiber.MethodGet {
+				c.Status(fiber.StatusAccepted)
+			}
+			return send(c, res, encodeOptions(req))
 		default:
-			return c.JSON(res)
+			return send(c, res, encodeOptions(req))
 		}
 	}
+
+	return endpoint{
+		handle:   handle,
+		name:     name,
+		request:  reflect.TypeOf((*Request)(nil)).Elem(),
+		response: reflect.TypeOf((*Response)(nil)).Elem(),
+	}
 }
 
-func doValidate(c *fiber.Ctx, req any) (err error) {
-	if c.Method() != http.MethodPatch {
-		return entity.Validate.Struct(req)
+func encodeOptions(req any) (opts EncodeOptions) {
+	if r, ok := req.(interface{ GetReadMask() []string }); ok {
+		opts.ReadMask = r.GetReadMask()
 	}
 	return
 }
 
-func paramParser(c *fiber.Ctx, req any) (err error) {
-	const tagName = "param"
+// handlerName names spans after the service method, e.g. "item.Service.Get".
+func handlerName(h any) string {
+	return route.OperationName(h)
+}
 
-	keys := make([]string, 0)
-	t := reflect.TypeOf(req).Elem()
-	for i := 0; i < t.NumField(); i++ {
-		f := t.Field(i)
-		if v := f.Tag.Get(tagName); v != "" {
-			keys = append(keys, v)
-		}
+// parseRequest fills req from every part of the request, then validates it.
+func parseRequest(c *fiber.Ctx, req any) (err error) {
+	if err = bindDefaults(req); err != nil {
+		return
 	}
-
-	if len(keys) == 0 {
+	if err = bodyParser(c, req); err != nil {
 		return
 	}
-
-	var (
-		decoder *mapstructure.Decoder
-		config  = &mapstructure.DecoderConfig{
-			TagName: tagName,
-			Result:  req,
-		}
-	)
-	if decoder, err = mapstructure.NewDecoder(config); err != nil {
+	if err = bindRequest(c, req); err != nil {
 		return
 	}
+	return doValidate(c, req)
+}
+
+func doValidate(c *fiber.Ctx, req any) (err error) {
+	if c.Method() != http.MethodPatch {
+		return entity.Validate.Struct(req)
+	}
+	return
+}
 
-	params := make(map[string]any, len(keys))
-	for _, key := range keys {
-		params[key] = c.Params(key)
+// removeSocket removes the socket left by an unclean exit, other files
+// at the path are kept and make listening fail instead.
+func removeSocket(path string) error {
+	info, err := os.Lstat(path)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return err
+	case info.Mode()&os.ModeSocket == 0:
+		return fmt.Errorf("%s exists and is not a socket", path)
 	}
-	return decoder.Decode(params)
+	return os.Remove(path)
 }
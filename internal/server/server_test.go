@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"server/internal/service/trace"
+)
+
+func TestInitTraceContext(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, ErrorHandler: errorHandler(false)})
+	app.Use(initUserContext, initTraceContext)
+	app.Get("/", func(c *fiber.Ctx) error {
+		var tr trace.Trace
+		tr.FromContext(c.UserContext())
+		return c.JSON(tr)
+	})
+	app.Get("/fail", func(c *fiber.Ctx) error {
+		return fiber.ErrNotFound
+	})
+
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	req.Header.Set(trace.HeaderRequestID, "req-1")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tr trace.Trace
+	if err = json.NewDecoder(res.Body).Decode(&tr); err != nil {
+		t.Fatal(err)
+	}
+	if tr.RequestID != "req-1" || tr.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace of services = %+v", tr)
+	}
+	if got := res.Header.Get(trace.HeaderRequestID); got != "req-1" {
+		t.Errorf("%s = %q, want req-1", trace.HeaderRequestID, got)
+	}
+
+	// Generated request IDs are sent back and reported in errors
+	if res, err = app.Test(httptest.NewRequest(fiber.MethodGet, "/fail", nil)); err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Error struct {
+			Details []struct {
+				RequestID string `json:"requestId"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	requestID := res.Header.Get(trace.HeaderRequestID)
+	var reported bool
+	for _, detail := range body.Error.Details {
+		reported = reported || (requestID != "" && detail.RequestID == requestID)
+	}
+	if !reported {
+		t.Errorf("details %+v, want request ID %q", body.Error.Details, requestID)
+	}
+}
+
+func TestRemoveSocket(t *testing.T) {
+	dir := t.TempDir()
+
+	sock := filepath.Join(dir, "app.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = ln.Close()
+
+	if err = removeSocket(sock); err != nil {
+		t.Errorf("remove socket: %v", err)
+	}
+	if _, err = os.Lstat(sock); !os.IsNotExist(err) {
+		t.Errorf("socket still exists: %v", err)
+	}
+
+	file := filepath.Join(dir, "app.db")
+	if err = os.WriteFile(file, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = removeSocket(file); err == nil {
+		t.Error("removed a regular file")
+	}
+	if _, err = os.Stat(file); err != nil {
+		t.Errorf("regular file is gone: %v", err)
+	}
+
+	if err = removeSocket(filepath.Join(dir, "missing.sock")); err != nil {
+		t.Errorf("remove missing socket: %v", err)
+	}
+}
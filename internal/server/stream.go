@@ -0,0 +1,230 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"time"
+
+	"github.com/dgrr/http2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gota33/errors"
+	"server/internal/service/trace"
+)
+
+const (
+	mimeNDJSON = "application/x-ndjson"
+	// streamBuffer is how many responses a service runs ahead of a slow client
+	streamBuffer = 64
+)
+
+// errStreamHTTP2 refuses streams over HTTP/2: dgrr/http2 serves every stream of a
+// connection on one goroutine, so a long-lived response would stall the others, and
+// deadlines or reads of the shared connection would break them.
+var errStreamHTTP2 = errors.WithUnimplemented(fmt.Errorf("streams aren't served over HTTP/2, use HTTP/1.1"))
+
+// isHTTP2 reports requests served by dgrr/http2, see tls.http2.
+func isHTTP2(c *fiber.Ctx) bool {
+	return bytes.Equal(c.Request().Header.Protocol(), http2.StringHTTP2)
+}
+
+// streamHandler is handler of services sending any number of responses, e.g. exports.
+// Responses are written as NDJSON or CSV with chunked transfer encoding while the
+// service sends them. Once the buffer is full, send blocks until the client reads,
+// and a disconnected client cancels ctx of the service.
+//
+// Errors before the first response are sent as usual, later ones abort the response,
+// so clients can tell an incomplete stream.
+func streamHandler[Request any, Response any](h func(context.Context, Request, func(Response) error) error) endpoint {
+	name := handlerName(h)
+	responseType := reflect.TypeOf((*Response)(nil)).Elem()
+
+	handle := func(c *fiber.Ctx) (err error) {
+		var (
+			req     Request
+			columns []string
+		)
+		if isHTTP2(c) {
+			return errStreamHTTP2
+		}
+		if err = parseRequest(c, &req); err != nil {
+			return
+		}
+
+		c.Vary(fiber.HeaderAccept)
+		mediaType := c.Accepts(mimeNDJSON, mimeCSV)
+		switch mediaType {
+		case "":
+			return fiber.NewError(fiber.StatusNotAcceptable,
+				fmt.Sprintf("%s is not acceptable, available: %s, %s", c.Get(fiber.HeaderAccept), mimeNDJSON, mimeCSV))
+		case mimeCSV:
+			if columns, err = csvColumns(responseType, encodeOptions(req).ReadMask); err != nil {
+				return
+			}
+		}
+
+		ctx, cancel := withStreamDeadline(c)
+		ctx, span := trace.Start(ctx, name)
+
+		var (
+			responses = make(chan Response, streamBuffer)
+			done      = make(chan error, 1)
+		)
+		go func() {
+			defer close(responses)
+			done <- h(ctx, req, func(res Response) error {
+				select {
+				case responses <- res:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		}()
+
+		// Wait for the first response, so early errors still get their status
+		first, ok := <-responses
+		if !ok {
+			if err = <-done; err != nil {
+				trace.End(span, err)
+				cancel()
+				return
+			}
+		}
+
+		t, _ := c.Locals(localTimeouts).(timeouts)
+		s := &responseStream[Response]{columns: columns}
+		c.Set(fiber.HeaderContentType, mediaType)
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		streamBody(c, t.write, func(w *bufio.Writer) error {
+			defer cancel()
+
+			s.w = w
+			streamErr := s.run(first, ok, responses, done)
+			trace.End(span, streamErr)
+			if streamErr != nil {
+				trace.Logger(ctx).WithError(streamErr).Warn("Stream aborted")
+			}
+			return streamErr
+		})
+		return
+	}
+
+	return endpoint{
+		handle:   handle,
+		name:     name,
+		stream:   true,
+		request:  reflect.TypeOf((*Request)(nil)).Elem(),
+		response: responseType,
+	}
+}
+
+// bodyStream is the body of streamed responses. fasthttp reads it on the goroutine
+// serving the connection, which extends the write deadline there before each chunk,
+// so WriteTimeout limits chunks rather than the whole stream. Only HTTP/1 connections
+// stream, each serving one request, see errStreamHTTP2.
+type bodyStream struct {
+	*io.PipeReader
+	conn         net.Conn
+	writeTimeout time.Duration
+}
+
+func (b bodyStream) Read(p []byte) (n int, err error) {
+	if n, err = b.PipeReader.Read(p); n > 0 && b.writeTimeout > 0 {
+		if err = b.conn.SetWriteDeadline(time.Now().Add(b.writeTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	return
+}
+
+// streamBody sends what write writes as the chunked body of c, write runs after
+// the handler returns. An error of write aborts the response before the last chunk,
+// so clients can tell it's incomplete rather than looking like a shorter one, and a
+// failed write to the client fails writes of w.
+func streamBody(c *fiber.Ctx, writeTimeout time.Duration, write func(w *bufio.Writer) error) {
+	pr, pw := io.Pipe()
+	c.Context().SetBodyStream(bodyStream{PipeReader: pr, conn: c.Context().Conn(), writeTimeout: writeTimeout}, -1)
+
+	go func() {
+		w := bufio.NewWriter(pw)
+		err := write(w)
+		if err == nil {
+			err = w.Flush()
+		}
+		_ = pw.CloseWithError(err)
+	}()
+}
+
+type responseStream[Response any] struct {
+	columns []string
+	w       *bufio.Writer
+	csv     *csv.Writer
+}
+
+func (s *responseStream[Response]) run(first Response, ok bool, responses <-chan Response, done <-chan error) (err error) {
+	if s.columns != nil {
+		s.csv = csv.NewWriter(s.w)
+		if err = s.csv.Write(s.columns); err != nil {
+			return
+		}
+	}
+	// The service already finished without responses
+	if !ok {
+		return s.flush()
+	}
+	if err = s.write(first); err != nil {
+		return
+	}
+
+	for res := range responses {
+		if err = s.write(res); err != nil {
+			return
+		}
+		// Send what's buffered while the service is busy, e.g. waiting for rows
+		if len(responses) == 0 {
+			if err = s.flush(); err != nil {
+				return
+			}
+		}
+	}
+	if err = <-done; err != nil {
+		return
+	}
+	return s.flush()
+}
+
+func (s *responseStream[Response]) write(res Response) (err error) {
+	if s.csv != nil {
+		var record []string
+		if record, err = csvRecord(res, s.columns); err != nil {
+			return
+		}
+		return s.csv.Write(record)
+	}
+
+	var data []byte
+	if data, err = json.Marshal(res); err != nil {
+		return
+	}
+	if _, err = s.w.Write(data); err != nil {
+		return
+	}
+	return s.w.WriteByte('\n')
+}
+
+func (s *responseStream[Response]) flush() (err error) {
+	if s.csv != nil {
+		s.csv.Flush()
+		if err = s.csv.Error(); err != nil {
+			return
+		}
+	}
+	return s.w.Flush()
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type streamRequest struct{}
+
+type streamResponse struct {
+	N int `json:"n"`
+}
+
+// serveStream serves h on a real connection, since fiber's app.Test doesn't stream.
+func serveStream(t *testing.T, h func(context.Context, streamRequest, func(streamResponse) error) error) string {
+	t.Helper()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/", streamHandler(h).handle)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = app.Listener(ln) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+	return "http://" + ln.Addr().String() + "/"
+}
+
+func TestStreamHandlerAbortsOnError(t *testing.T) {
+	url := serveStream(t, func(_ context.Context, _ streamRequest, send func(streamResponse) error) error {
+		for i := 0; i < 3; i++ {
+			if err := send(streamResponse{N: i}); err != nil {
+				return err
+			}
+		}
+		return errors.New("database gone")
+	})
+
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %d %q, %v, want 200 and an incomplete body", res.StatusCode, body, err)
+	}
+}
+
+func TestStreamHandlerCancelsOnDisconnect(t *testing.T) {
+	stopped := make(chan error, 1)
+	url := serveStream(t, func(ctx context.Context, _ streamRequest, send func(streamResponse) error) error {
+		for i := 0; ; i++ {
+			if err := send(streamResponse{N: i}); err != nil {
+				stopped <- ctx.Err()
+				return err
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	if err != nil || line != "{\"n\":0}\n" {
+		t.Fatalf("first line = %q, %v", line, err)
+	}
+	_ = res.Body.Close()
+
+	select {
+	case err = <-stopped:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("service stopped with ctx error %v, want canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("service still sending after the client disconnected")
+	}
+}
+
+func TestStreamRefusedOverHTTP2(t *testing.T) {
+	var (
+		ca     = issue(t, "ca", nil)
+		server = issue(t, "server", &ca, "127.0.0.1")
+		pool   = x509.NewCertPool()
+		dir    = t.TempDir()
+		c      = TLS{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem"), HTTP2: true}
+	)
+	pool.AddCert(ca.cert)
+	key, err := x509.MarshalECPrivateKey(server.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(c.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(c.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	reloader, err := newCertReloader(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, ErrorHandler: errorHandler(false)})
+	app.Get("/stream", streamHandler(func(_ context.Context, _ streamRequest, send func(streamResponse) error) error {
+		return send(streamResponse{N: 1})
+	}).handle)
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln = tls.NewListener(ln, reloader.configure(app))
+	go func() { _ = app.Listener(ln) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	get := func(client *http.Client, path string) (proto string, status int, body string) {
+		req, _ := http.NewRequest(http.MethodGet, "https://"+ln.Addr().String()+path, nil)
+		req.Header.Set(fiber.HeaderAccept, mimeNDJSON)
+		res, reqErr := client.Do(req)
+		if reqErr != nil {
+			t.Fatal(reqErr)
+		}
+		defer res.Body.Close()
+		data, _ := io.ReadAll(res.Body)
+		return res.Proto, res.StatusCode, string(data)
+	}
+
+	h2 := &http.Client{Timeout: 5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}, ForceAttemptHTTP2: true}}
+	// Shutdown waits for the connection otherwise
+	t.Cleanup(h2.CloseIdleConnections)
+	if proto, status, _ := get(h2, "/stream"); proto != "HTTP/2.0" || status != http.StatusNotImplemented {
+		t.Errorf("stream over %s = %d, want 501 over HTTP/2.0", proto, status)
+	}
+	if proto, status, body := get(h2, "/"); proto != "HTTP/2.0" || status != http.StatusOK || body != "ok" {
+		t.Errorf("next request over %s = %d %q, want ok", proto, status, body)
+	}
+
+	h1 := &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool},
+		TLSNextProto: map[string]func(string, *tls.Conn) http.RoundTripper{}}}
+	if proto, status, body := get(h1, "/stream"); proto != "HTTP/1.1" || status != http.StatusOK || body != "{\"n\":1}\n" {
+		t.Errorf("stream over %s = %d %q, want it served over HTTP/1.1", proto, status, body)
+	}
+}
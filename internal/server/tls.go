@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dgrr/http2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	"server/internal/service/auth"
+)
+
+// TLS serves HTTPS when CertFile and KeyFile are set. With ClientCAFile,
+// client certificates are verified and mapped to auth.User, see userOf.
+// Files are reloaded on change or SIGHUP, established connections are kept.
+type TLS struct {
+	CertFile       string
+	KeyFile        string
+	ClientCAFile   string
+	RequireClient  bool
+	HTTP2          bool
+	ReloadInterval time.Duration
+}
+
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+type certReloader struct {
+	TLS
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTime  time.Time
+	base     *tls.Config
+}
+
+func newCertReloader(t TLS) (r *certReloader, err error) {
+	r = &certReloader{TLS: t}
+	if err = r.reload(); err != nil {
+		return
+	}
+
+	r.base = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"http/1.1"},
+	}
+	r.base.GetConfigForClient = r.configForClient
+	return
+}
+
+// reload swaps certificates atomically, a broken file keeps the previous ones.
+func (r *certReloader) reload() (err error) {
+	var cert tls.Certificate
+	if cert, err = tls.LoadX509KeyPair(r.CertFile, r.KeyFile); err != nil {
+		return
+	}
+
+	var pool *x509.CertPool
+	if r.ClientCAFile != "" {
+		var data []byte
+		if data, err = os.ReadFile(r.ClientCAFile); err != nil {
+			return
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificate found in %q", r.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert, r.clientCA, r.modTime = &cert, pool, r.latestModTime()
+	return
+}
+
+func (r *certReloader) latestModTime() (latest time.Time) {
+	for _, file := range []string{r.CertFile, r.KeyFile, r.ClientCAFile} {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return
+}
+
+func (r *certReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c := r.base.Clone()
+	c.GetConfigForClient = nil
+	c.Certificates = []tls.Certificate{*r.cert}
+	if r.clientCA != nil {
+		c.ClientCAs = r.clientCA
+		c.ClientAuth = tls.VerifyClientCertIfGiven
+		if r.RequireClient {
+			c.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return c, nil
+}
+
+// watch reloads on SIGHUP, or when files are modified in ReloadInterval.
+func (r *certReloader) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if r.ReloadInterval > 0 {
+		ticker := time.NewTicker(r.ReloadInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-tick:
+			r.mu.RLock()
+			changed := r.latestModTime().After(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+		}
+
+		if err := r.reload(); err != nil {
+			logrus.WithError(err).Warn("Reload TLS certificate error")
+		} else {
+			logrus.Info("TLS certificate reloaded")
+		}
+	}
+}
+
+// configure serves TLS on srv, HTTP/2 is preferred by ALPN if enabled.
+func (r *certReloader) configure(srv *fiber.App) *tls.Config {
+	if r.HTTP2 {
+		http2.ConfigureServer(srv.Server(), http2.ServerConfig{})
+		r.base.NextProtos = append([]string{http2.H2TLSProto}, r.base.NextProtos...)
+	}
+	return r.base
+}
+
+// grpcConfig serves gRPC with the same certificates, HTTP/2 is required by gRPC.
+func (r *certReloader) grpcConfig() *tls.Config {
+	c := r.base.Clone()
+	c.NextProtos = []string{http2.H2TLSProto}
+	c.GetConfigForClient = func(hello *tls.ClientHelloInfo) (config *tls.Config, err error) {
+		if config, err = r.configForClient(hello); err == nil {
+			config.NextProtos = c.NextProtos
+		}
+		return
+	}
+	return c
+}
+
+// userOf resolves the user by a verified client certificate or a bearer token.
+// Tokens aren't verified by the server, so a verified certificate takes precedence,
+// and a token sent along with it must name the same subject.
+func userOf(token string, state *tls.ConnectionState) (user auth.User, ok bool, err error) {
+	if state == nil || len(state.VerifiedChains) == 0 {
+		if token == "" {
+			return
+		}
+		err = user.FromJWT(token)
+		return user, err == nil, err
+	}
+
+	user.FromCertificate(state.VerifiedChains[0][0])
+	if token != "" {
+		var claimed auth.User
+		if err = claimed.FromJWT(token); err != nil {
+			return
+		}
+		if claimed.Subject != user.Subject {
+			err = fmt.Errorf("token subject %q doesn't match client certificate %q", claimed.Subject, user.Subject)
+			return
+		}
+	}
+	return user, true, nil
+}
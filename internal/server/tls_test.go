@@ -0,0 +1,163 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"server/internal/service/auth"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issue creates a certificate for cn signed by parent, or a self-signed CA without parent.
+func issue(t *testing.T, cn string, parent *testCert, hosts ...string) testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		tmpl.IPAddresses = append(tmpl.IPAddresses, net.ParseIP(host))
+	}
+
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCert{cert: cert, key: key}
+}
+
+func (c testCert) tls() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+func token(subject string) string {
+	enc := base64.RawURLEncoding
+	return "Bearer " + enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		enc.EncodeToString([]byte(`{"sub":"`+subject+`"}`)) + ".sig"
+}
+
+func TestUserOf(t *testing.T) {
+	ca := issue(t, "ca", nil)
+	client := issue(t, "alice", &ca)
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{client.cert, ca.cert}}}
+
+	tests := []struct {
+		name    string
+		token   string
+		state   *tls.ConnectionState
+		subject string
+		ok      bool
+		wantErr bool
+	}{
+		{name: "anonymous"},
+		{name: "token", token: token("bob"), subject: "bob", ok: true},
+		{name: "unverified certificate", token: token("bob"), state: &tls.ConnectionState{}, subject: "bob", ok: true},
+		{name: "certificate", state: verified, subject: "alice", ok: true},
+		{name: "certificate and matching token", token: token("alice"), state: verified, subject: "alice", ok: true},
+		{name: "certificate and other token", token: token("bob"), state: verified, wantErr: true},
+		{name: "certificate and invalid token", token: "Bearer x", state: verified, wantErr: true},
+	}
+	for _, tt := range tests {
+		user, ok, err := userOf(tt.token, tt.state)
+		if (err != nil) != tt.wantErr || ok != tt.ok || ok && user.Subject != tt.subject {
+			t.Errorf("%s: got %q, %v, %v, want %q, %v, error %v", tt.name, user.Subject, ok, err, tt.subject, tt.ok, tt.wantErr)
+		}
+	}
+}
+
+func TestInitAuthContextClientCertificate(t *testing.T) {
+	var (
+		ca     = issue(t, "ca", nil)
+		server = issue(t, "server", &ca, "127.0.0.1")
+		client = issue(t, "alice", &ca)
+		pool   = x509.NewCertPool()
+	)
+	pool.AddCert(ca.cert)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, ErrorHandler: func(c *fiber.Ctx, err error) error {
+		return c.Status(http.StatusUnauthorized).SendString(err.Error())
+	}})
+	app.Use(initUserContext, initAuthContext)
+	app.Get("/", func(c *fiber.Ctx) error {
+		var user auth.User
+		_ = user.FromContext(c.UserContext())
+		return c.SendString(user.Subject)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln = tls.NewListener(ln, &tls.Config{
+		Certificates: []tls.Certificate{server.tls()},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	})
+	go func() { _ = app.Listener(ln) }()
+	defer func() { _ = app.Shutdown() }()
+
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{client.tls()},
+	}}}
+	get := func(authorization string) (int, string) {
+		req, _ := http.NewRequest(http.MethodGet, "https://"+ln.Addr().String()+"/", nil)
+		if authorization != "" {
+			req.Header.Set(fiber.HeaderAuthorization, authorization)
+		}
+		res, reqErr := httpClient.Do(req)
+		if reqErr != nil {
+			t.Fatal(reqErr)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(body)
+	}
+
+	if status, body := get(""); status != http.StatusOK || body != "alice" {
+		t.Errorf("certificate only: got %d %q, want alice", status, body)
+	}
+	if status, body := get(token("alice")); status != http.StatusOK || body != "alice" {
+		t.Errorf("matching token: got %d %q, want alice", status, body)
+	}
+	if status, body := get(token("mallory")); status != http.StatusUnauthorized {
+		t.Errorf("other token: got %d %q, want 401", status, body)
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"server/internal/service/trace"
+)
+
+// initTraceContext continues the incoming W3C trace context with a server span
+// and accepts or generates the request ID, which is echoed back to clients.
+func initTraceContext(c *fiber.Ctx) (err error) {
+	var (
+		method = utils.CopyString(c.Method())
+		t      = trace.Trace{RequestID: c.Get(trace.HeaderRequestID)}
+		ctx    = otel.GetTextMapPropagator().Extract(c.UserContext(), headerCarrier{&c.Request().Header})
+	)
+	ctx, span := trace.Start(t.WithContext(ctx), "HTTP "+method,
+		oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+		oteltrace.WithAttributes(
+			semconv.HTTPMethodKey.String(method),
+			semconv.HTTPTargetKey.String(utils.CopyString(c.OriginalURL())),
+		))
+	defer span.End()
+
+	t.FromContext(ctx)
+	c.Set(trace.HeaderRequestID, t.RequestID)
+	c.SetUserContext(ctx)
+
+	err = c.Next()
+
+	// Errors are handled by accessLog, the status is final here
+	route := c.Route().Path
+	status := c.Response().StatusCode()
+	span.SetName(method + " " + route)
+	span.SetAttributes(semconv.HTTPRouteKey.String(route))
+	span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+	if code, msg := semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(status, oteltrace.SpanKindServer); code == codes.Error {
+		span.SetStatus(code, msg)
+	}
+	return
+}
+
+// headerCarrier adapts fasthttp request headers to propagation.TextMapCarrier.
+type headerCarrier struct {
+	h *fasthttp.RequestHeader
+}
+
+func (hc headerCarrier) Get(key string) string {
+	return string(hc.h.Peek(key))
+}
+
+func (hc headerCarrier) Set(key string, value string) {
+	hc.h.Set(key, value)
+}
+
+func (hc headerCarrier) Keys() (keys []string) {
+	hc.h.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return
+}
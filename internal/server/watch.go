@@ -0,0 +1,293 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"server/internal/service/auth"
+	"server/internal/service/entity"
+	"server/internal/service/trace"
+)
+
+const (
+	mimeEventStream = "text/event-stream"
+	heartbeat       = 5 * time.Second
+	watchPoll       = time.Second
+	tailPageSize    = 100
+	// gapWait is how long a skipped id of the outbox is waited for, ids of MySQL
+	// are taken in order but committed in any, and rolled back ones never come
+	gapWait = time.Minute
+	maxGaps = 1000
+)
+
+type watchRequest struct {
+	// Filter matches data of events, like filters of lists
+	Filter string `query:"filter"`
+	// LastEventID resumes after the event, it's sent by EventSource on reconnect
+	LastEventID int64 `header:"Last-Event-ID"`
+}
+
+// watch streams change events of a resource type as Server-Sent Events,
+// e.g. "GET /items:watch?filter=price > 10". Each watcher tails the outbox, so it
+// gets events of every replica, and clients resume by sending Last-Event-ID.
+func (r router) watch(resourceType string) endpoint {
+	prefix := resourceType + "."
+
+	handle := func(c *fiber.Ctx) (err error) {
+		var (
+			req    watchRequest
+			user   auth.User
+			filter entity.Filter
+		)
+		if isHTTP2(c) {
+			return errStreamHTTP2
+		}
+		if err = user.FromContext(c.UserContext()); err != nil {
+			return
+		}
+		if err = parseRequest(c, &req); err != nil {
+			return
+		}
+		if filter, err = entity.ParseFilter(req.Filter); err != nil {
+			return
+		}
+
+		s := &stream{
+			db:     r.config.RDS,
+			prefix: prefix,
+			filter: filter,
+			last:   req.LastEventID,
+			gaps:   map[int64]time.Time{},
+			poll:   watchPoll,
+			wake:   make(chan struct{}, 1),
+		}
+		unsubscribe := r.config.Events.Subscribe(s.notify)
+
+		ctx, cancel := withDisconnect(c)
+		c.Set(fiber.HeaderContentType, mimeEventStream)
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		c.Set(fiber.HeaderConnection, "keep-alive")
+		streamBody(c, r.config.WriteTimeout, func(w *bufio.Writer) error {
+			defer cancel()
+			defer unsubscribe()
+
+			s.w = w
+			if streamErr := s.run(ctx); streamErr != nil {
+				trace.Logger(ctx).WithError(streamErr).Debug("Watch stream closed")
+			}
+			return nil
+		})
+		return
+	}
+
+	return endpoint{
+		handle:   handle,
+		name:     resourceType + ".Watch",
+		stream:   true,
+		events:   true,
+		request:  reflect.TypeOf(watchRequest{}),
+		response: reflect.TypeOf(entity.Event{}),
+	}
+}
+
+// withDisconnect returns ctx of the request cancelled once the client disconnects,
+// so long-lived responses stop without waiting for their next write to fail.
+// The connection is read until it's closed, so it's closed after the response
+// rather than serving a next request, whose bytes would be discarded. Connections
+// of HTTP/2 are shared by streams, which are refused instead, see errStreamHTTP2.
+func withDisconnect(c *fiber.Ctx) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(c.UserContext())
+	conn := c.Context().Conn()
+	c.Context().SetConnectionClose()
+
+	go func() {
+		defer cancel()
+		// The deadline of ReadTimeout would end the response otherwise
+		if err := conn.SetReadDeadline(time.Time{}); err != nil {
+			return
+		}
+		buf := make([]byte, 1)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	return ctx, cancel
+}
+
+// stream sends events of the outbox after last. Ids skipped on the way are kept as
+// gaps, events of transactions committed after later ones are sent once they show up.
+type stream struct {
+	db     *sql.DB
+	prefix string
+	filter entity.Filter
+	last   int64
+	gaps   map[int64]time.Time
+	poll   time.Duration
+	wake   chan struct{}
+	w      *bufio.Writer
+}
+
+// notify wakes the stream once the dispatcher of this replica delivers an event to
+// the bus, so it doesn't wait for its next poll. Events of other replicas are polled.
+func (s *stream) notify(_ context.Context, e entity.Event) error {
+	if strings.HasPrefix(e.Type, s.prefix) {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *stream) run(ctx context.Context) (err error) {
+	// Without Last-Event-ID, only events from now on are sent
+	if s.last == 0 {
+		if err = s.db.QueryRowContext(ctx, "select coalesce(max(id), 0) from outbox").Scan(&s.last); err != nil {
+			return
+		}
+	}
+	if err = s.ping(); err != nil {
+		return
+	}
+
+	poll := time.NewTicker(s.poll)
+	defer poll.Stop()
+	ping := time.NewTicker(heartbeat)
+	defer ping.Stop()
+
+	for {
+		if err = s.tail(ctx); err != nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-poll.C:
+		case <-ping.C:
+			if err = s.ping(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// tail sends events of gaps and after last, page by page. Types are matched here
+// rather than in SQL, so ids of other types aren't taken for gaps.
+func (s *stream) tail(ctx context.Context) (err error) {
+	const script = "select id, type, resource, actor, update_mask, data, create_time from outbox " +
+		"where id > ? order by id limit ?"
+
+	if err = s.fillGaps(ctx); err != nil {
+		return
+	}
+	for {
+		var events []entity.Event
+		if events, err = s.query(ctx, script, s.last, tailPageSize); err != nil {
+			return
+		}
+		now := time.Now()
+		for _, e := range events {
+			for id := s.last + 1; id < e.ID && len(s.gaps) < maxGaps; id++ {
+				s.gaps[id] = now
+			}
+			s.last = e.ID
+			if err = s.send(e); err != nil {
+				return
+			}
+		}
+		if len(events) < tailPageSize {
+			return
+		}
+	}
+}
+
+// fillGaps sends events of gaps committed since, and gives up gaps older than gapWait.
+func (s *stream) fillGaps(ctx context.Context) (err error) {
+	now := time.Now()
+	ids := make([]any, 0, len(s.gaps))
+	for id, since := range s.gaps {
+		if now.Sub(since) > gapWait {
+			delete(s.gaps, id)
+		} else {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	script := "select id, type, resource, actor, update_mask, data, create_time from outbox " +
+		"where id in (?" + strings.Repeat(", ?", len(ids)-1) + ") order by id"
+
+	var events []entity.Event
+	if events, err = s.query(ctx, script, ids...); err != nil {
+		return
+	}
+	for _, e := range events {
+		delete(s.gaps, e.ID)
+		if err = s.send(e); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *stream) query(ctx context.Context, script string, args ...any) (events []entity.Event, err error) {
+	var rows *sql.Rows
+	if rows, err = s.db.QueryContext(ctx, script, args...); err != nil {
+		return
+	}
+
+	defer entity.CloseRows(rows)
+
+	for rows.Next() {
+		var e entity.Event
+		if e, err = entity.ScanEvent(rows); err != nil {
+			return
+		}
+		events = append(events, e)
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *stream) send(e entity.Event) (err error) {
+	if !strings.HasPrefix(e.Type, s.prefix) {
+		return
+	}
+	if !s.filter.Empty() {
+		var fields map[string]any
+		if err = json.Unmarshal(e.Data, &fields); err != nil {
+			return
+		}
+		if !s.filter.Match(fields) {
+			return
+		}
+	}
+
+	var data []byte
+	if data, err = json.Marshal(e); err != nil {
+		return
+	}
+	if _, err = fmt.Fprintf(s.w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+		return
+	}
+	return s.w.Flush()
+}
+
+func (s *stream) ping() (err error) {
+	if _, err = s.w.WriteString(": ping\n\n"); err != nil {
+		return
+	}
+	return s.w.Flush()
+}
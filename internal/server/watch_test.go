@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"server/internal/service/entity"
+)
+
+func newOutbox(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err = db.Exec(`
+create table outbox
+(
+    id          integer primary key autoincrement,
+    type        text not null,
+    resource    text not null,
+    actor       text not null default '',
+    update_mask text not null default '',
+    data        text not null,
+    create_time timestamp not null default current_timestamp
+);`); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// appendEvent writes an event to the outbox the way another replica would, without the bus.
+func appendEvent(t *testing.T, db *sql.DB, typ, resource, data string) {
+	t.Helper()
+	if _, err := db.Exec("insert into outbox (type, resource, data) values (?, ?, ?)", typ, resource, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// commitEvent writes an event of the given id, like a transaction of MySQL committed
+// after one that took a later id.
+func commitEvent(t *testing.T, db *sql.DB, id int64, typ, resource, data string) {
+	t.Helper()
+	if _, err := db.Exec("insert into outbox (id, type, resource, data) values (?, ?, ?, ?)", id, typ, resource, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// watchOutbox runs a stream after last, returning lines of the events it sends.
+func watchOutbox(t *testing.T, db *sql.DB, last int64, filter string) <-chan string {
+	t.Helper()
+
+	f, err := entity.ParseFilter(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, pw := io.Pipe()
+	s := &stream{db: db, prefix: "item.", filter: f, last: last, gaps: map[int64]time.Time{}, poll: 10 * time.Millisecond,
+		wake: make(chan struct{}, 1), w: bufio.NewWriter(pw)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		_ = pr.Close()
+	})
+	go func() { _ = pw.CloseWithError(s.run(ctx)) }()
+
+	lines := make(chan string, 16)
+	started := make(chan struct{})
+	go func() {
+		defer close(lines)
+		pinged := false
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			switch line := scanner.Text(); {
+			case line == ": ping" && !pinged:
+				pinged = true
+				close(started)
+			case strings.HasPrefix(line, "id: "):
+				lines <- line
+			}
+		}
+	}()
+	// The first ping is sent once the stream knows where it starts
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream didn't start")
+	}
+	return lines
+}
+
+func expectEvents(t *testing.T, lines <-chan string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case got := <-lines:
+			if got != w {
+				t.Fatalf("event %q, want %q", got, w)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no event, want %q", w)
+		}
+	}
+	select {
+	case got := <-lines:
+		t.Fatalf("unexpected event %q", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWatchTailsOutbox(t *testing.T) {
+	db := newOutbox(t)
+	appendEvent(t, db, "item.created", "items/1", `{"price":1}`)
+
+	lines := watchOutbox(t, db, 0, "")
+	appendEvent(t, db, "item.updated", "items/1", `{"price":2}`)
+	appendEvent(t, db, "cart.created", "customers/1/carts/1", `{}`)
+	appendEvent(t, db, "item.deleted", "items/1", `{"price":2}`)
+
+	expectEvents(t, lines, "id: 2", "id: 4")
+}
+
+func TestWatchResumes(t *testing.T) {
+	db := newOutbox(t)
+	for _, price := range []string{"1", "20", "30"} {
+		appendEvent(t, db, "item.created", "items/"+price, `{"price":`+price+`}`)
+	}
+
+	lines := watchOutbox(t, db, 1, "price > 10")
+	expectEvents(t, lines, "id: 2", "id: 3")
+	appendEvent(t, db, "item.created", "items/4", `{"price":5}`)
+	appendEvent(t, db, "item.created", "items/5", `{"price":50}`)
+	expectEvents(t, lines, "id: 5")
+}
+
+func TestWatchFillsGaps(t *testing.T) {
+	db := newOutbox(t)
+	appendEvent(t, db, "item.created", "items/1", `{"price":1}`)
+
+	lines := watchOutbox(t, db, 0, "")
+	commitEvent(t, db, 4, "item.created", "items/4", `{"price":4}`)
+	expectEvents(t, lines, "id: 4")
+	commitEvent(t, db, 3, "cart.created", "customers/1/carts/1", `{}`)
+	commitEvent(t, db, 2, "item.created", "items/2", `{"price":2}`)
+	expectEvents(t, lines, "id: 2")
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"crypto/x509"
 	"strings"
 
 	"github.com/dgrijalva/jwt-go"
@@ -13,8 +14,12 @@ type ctxKey int
 const (
 	unknown ctxKey = iota
 	userKey
+	clientIPKey
 )
 
+// anonymousPrefix marks actors of anonymous callers, see ActorOf.
+const anonymousPrefix = "ip:"
+
 var parser = &jwt.Parser{}
 
 type User struct {
@@ -31,6 +36,20 @@ func (u *User) FromJWT(str string) (err error) {
 	return
 }
 
+// FromCertificate maps a verified client certificate of mTLS to the user,
+// the subject is the common name, or the whole distinguished name without one.
+func (u *User) FromCertificate(cert *x509.Certificate) {
+	*u = User{StandardClaims: jwt.StandardClaims{
+		Subject:   cert.Subject.CommonName,
+		Issuer:    cert.Issuer.CommonName,
+		NotBefore: cert.NotBefore.Unix(),
+		ExpiresAt: cert.NotAfter.Unix(),
+	}}
+	if u.Subject == "" {
+		u.Subject = cert.Subject.String()
+	}
+}
+
 func (u User) WithContext(ctx context.Context) context.Context {
 	return context.WithValue(ctx, userKey, u)
 }
@@ -42,3 +61,37 @@ func (u *User) FromContext(ctx context.Context) (err error) {
 	}
 	return
 }
+
+// WithClientIP keeps the IP of the client in ctx, which identifies anonymous callers.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey, ip)
+}
+
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey).(string)
+	return ip
+}
+
+// ActorOf identifies the caller of ctx to scope resources to: the subject of the
+// user, or "ip:" and the client IP of anonymous callers, empty if neither is known.
+func ActorOf(ctx context.Context) string {
+	var user User
+	if user.FromContext(ctx) == nil && user.Subject != "" {
+		return user.Subject
+	}
+	if ip := ClientIP(ctx); ip != "" {
+		return anonymousPrefix + ip
+	}
+	return ""
+}
+
+// WithActor restores the caller of ActorOf in ctx, e.g. for work done on their behalf later.
+func WithActor(ctx context.Context, actor string) context.Context {
+	if ip := strings.TrimPrefix(actor, anonymousPrefix); ip != actor {
+		return WithClientIP(ctx, ip)
+	}
+	if actor != "" {
+		ctx = User{StandardClaims: jwt.StandardClaims{Subject: actor}}.WithContext(ctx)
+	}
+	return ctx
+}
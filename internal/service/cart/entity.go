@@ -0,0 +1,79 @@
+package cart
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"server/internal/service/entity"
+	"server/internal/service/item"
+)
+
+const Pattern entity.Pattern = "customers/{customerID}/carts/{cartID}"
+
+type Entity struct {
+	ID         int64     `json:"id,string"`
+	Name       string    `json:"name"`
+	Item       string    `json:"item,omitempty"`
+	Num        int64     `json:"num" validate:"min=0"`
+	Status     string    `json:"status" validate:"required,oneof=open closed"`
+	CreateTime time.Time `json:"createTime"`
+
+	itemID sql.NullString
+}
+
+func (e Entity) GetID() string {
+	return strconv.FormatInt(e.ID, 10)
+}
+
+func (e Entity) GetName() string {
+	return e.Name
+}
+
+func (e Entity) InsertValues() []any {
+	return []any{e.itemID, e.Num, e.Status}
+}
+
+// parseItem resolves the item inserted by InsertValues, carts may have no item.
+func (e *Entity) parseItem() (err error) {
+	if e.Item == "" {
+		return
+	}
+	var ids []string
+	if ids, err = item.Pattern.ParseField("item", e.Item); err != nil {
+		return
+	}
+	e.itemID = sql.NullString{String: ids[0], Valid: true}
+	return
+}
+
+func newDao(db *sql.DB) entity.Dao[Entity] {
+	const allFields = "id, customer_id, item_id, num, status, create_time"
+	return entity.Dao[Entity]{
+		DB:      db,
+		Pattern: Pattern,
+		Table:   "cart",
+		Keys:    []string{"customer_id", "id"},
+		Columns: map[string]string{"item": ""},
+		// references like "item" can only be set on create
+		Updatable: []string{"num", "status"},
+		SqlCreate: "insert into cart (customer_id, item_id, num, status) values (?, ?, ?, ?)",
+		SqlGet:    "select " + allFields + " from cart where customer_id = ? and id = ? limit 1",
+		SqlList:   "select " + allFields + " from cart where customer_id = ? and id > ?",
+		SqlDelete: "delete from cart where customer_id = ? and id = ?",
+		ScanAllFields: func(row entity.Scanner) (e Entity, err error) {
+			var (
+				customerID string
+				itemID     sql.NullString
+			)
+			if err = row.Scan(&e.ID, &customerID, &itemID, &e.Num, &e.Status, &e.CreateTime); err != nil {
+				return
+			}
+			e.Name = Pattern.Format(customerID, e.GetID())
+			if itemID.Valid {
+				e.Item = item.Pattern.Format(itemID.String)
+			}
+			return
+		},
+	}
+}
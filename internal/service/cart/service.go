@@ -0,0 +1,139 @@
+package cart
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"server/internal/service/customer"
+	"server/internal/service/entity"
+)
+
+type Service struct {
+	dao entity.Dao[Entity]
+}
+
+func New(db *sql.DB) Service {
+	return Service{dao: newDao(db)}
+}
+
+func (srv Service) Check(ctx context.Context) error {
+	return srv.dao.Check(ctx)
+}
+
+type GetRequest struct {
+	CustomerID string `param:"customerID"`
+	CartID     string `param:"cartID"`
+}
+
+func (srv Service) Get(ctx context.Context, req GetRequest) (res Entity, err error) {
+	return srv.dao.Get(ctx, Pattern.Format(req.CustomerID, req.CartID))
+}
+
+type CreateRequest struct {
+	Entity
+	CustomerID string `param:"customerID"`
+}
+
+func (srv Service) Create(ctx context.Context, req CreateRequest) (res Entity, err error) {
+	if err = req.parseItem(); err != nil {
+		return
+	}
+	return srv.dao.Create(ctx, customer.Pattern.Format(req.CustomerID), req.Entity)
+}
+
+type ListRequest struct {
+	entity.ListRequestFragment
+	CustomerID string `param:"customerID"`
+}
+
+type ListResponse struct {
+	entity.ListResponseFragment
+	Carts []Entity `json:"carts"`
+}
+
+func (srv Service) List(ctx context.Context, req ListRequest) (res ListResponse, err error) {
+	var raw entity.ListResponse[Entity]
+	if raw, err = srv.dao.List(ctx, customer.Pattern.Format(req.CustomerID), req); err != nil {
+		return
+	}
+
+	res.Carts = raw.Items
+	res.ListResponseFragment = raw.ListResponseFragment
+	return
+}
+
+type UpdateRequest struct {
+	entity.UpdateRequestFragment
+	CustomerID string `param:"customerID"`
+	CartID     string `param:"cartID"`
+	Cart       Entity `json:"cart"`
+}
+
+func (srv Service) Update(ctx context.Context, req UpdateRequest) (res Entity, err error) {
+	uReq := entity.UpdateRequest[Entity]{
+		UpdateRequestFragment: req.UpdateRequestFragment,
+		Name:                  Pattern.Format(req.CustomerID, req.CartID),
+		Entity:                req.Cart,
+	}
+	return srv.dao.Update(ctx, uReq)
+}
+
+type DeleteRequest struct {
+	CustomerID string `param:"customerID"`
+	CartID     string `param:"cartID"`
+}
+
+func (srv Service) Delete(ctx context.Context, req DeleteRequest) (code int, err error) {
+	if err = srv.dao.Delete(ctx, Pattern.Format(req.CustomerID, req.CartID)); err == nil {
+		code = http.StatusNoContent
+	}
+	return
+}
+
+// openCartTTL closes carts left open for longer, see Expire.
+const openCartTTL = 7 * 24 * time.Hour
+
+// Expire closes carts left open for longer than openCartTTL, it's run as the job "cart.expire".
+// Carts are closed by updates, so revisions and events are recorded as if customers did.
+func (srv Service) Expire(ctx context.Context) (err error) {
+	const script = "select customer_id, id from cart where status = 'open' and create_time < ? order by id limit 100"
+
+	for {
+		// Rows are closed before updating, since SQLite may have a single connection
+		var names []string
+		if names, err = srv.expired(ctx, script, time.Now().UTC().Add(-openCartTTL)); err != nil || len(names) == 0 {
+			return
+		}
+
+		for _, name := range names {
+			req := entity.UpdateRequest[Entity]{
+				UpdateRequestFragment: entity.UpdateRequestFragment{UpdateMask: entity.FieldMask{Paths: []string{"status"}}},
+				Name:                  name,
+				Entity:                Entity{Status: "closed"},
+			}
+			if _, err = srv.dao.Update(ctx, req); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (srv Service) expired(ctx context.Context, script string, before time.Time) (names []string, err error) {
+	var rows *sql.Rows
+	if rows, err = srv.dao.DB.QueryContext(ctx, script, before); err != nil {
+		return
+	}
+	defer entity.CloseRows(rows)
+
+	for rows.Next() {
+		var customerID, id string
+		if err = rows.Scan(&customerID, &id); err != nil {
+			return
+		}
+		names = append(names, Pattern.Format(customerID, id))
+	}
+	err = rows.Err()
+	return
+}
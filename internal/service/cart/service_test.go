@@ -0,0 +1,111 @@
+package cart
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/gota33/errors"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestService(t *testing.T) Service {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err = db.Exec(`
+create table cart
+(
+    id          integer primary key autoincrement,
+    customer_id integer   not null,
+    item_id     integer   null,
+    num         integer   not null check (num >= 0),
+    status      text      not null check (status IN ('open', 'closed')),
+    create_time timestamp not null default current_timestamp
+);
+create table revision
+(
+    id          integer primary key autoincrement,
+    resource    text not null,
+    operation   text not null,
+    actor       text not null default '',
+    update_mask text not null default '',
+    before_json text null,
+    after_json  text null,
+    create_time timestamp not null default current_timestamp
+);
+create table outbox
+(
+    id          integer primary key autoincrement,
+    type        text not null,
+    resource    text not null,
+    actor       text not null default '',
+    update_mask text not null default '',
+    data        text not null,
+    create_time timestamp not null default current_timestamp
+);`); err != nil {
+		t.Fatal(err)
+	}
+	return New(db)
+}
+
+func TestCreateItemReference(t *testing.T) {
+	var (
+		srv = newTestService(t)
+		ctx = context.Background()
+	)
+	for _, ref := range []string{"items/7", ""} {
+		res, err := srv.Create(ctx, CreateRequest{CustomerID: "1", Entity: Entity{Item: ref, Status: "open"}})
+		if err != nil || res.Item != ref || res.Name != Pattern.Format("1", res.GetID()) {
+			t.Errorf("create with item %q = %+v, %v", ref, res, err)
+		}
+	}
+
+	for _, ref := range []string{"customers/7", "items/", "items/7/carts/1"} {
+		_, err := srv.Create(ctx, CreateRequest{CustomerID: "1", Entity: Entity{Item: ref, Status: "open"}})
+		if !violates(err, "item") {
+			t.Errorf("create with item %q: got %v, want a violation of item", ref, err)
+		}
+	}
+}
+
+func TestUpdateMask(t *testing.T) {
+	var (
+		srv = newTestService(t)
+		ctx = context.Background()
+	)
+	created, err := srv.Create(ctx, CreateRequest{CustomerID: "1", Entity: Entity{Item: "items/7", Num: 1, Status: "open"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := UpdateRequest{CustomerID: "1", CartID: created.GetID(), Cart: Entity{Item: "items/8", Num: 2, Status: "closed"}}
+	res, err := srv.Update(ctx, req)
+	if err != nil || res.Num != 2 || res.Status != "closed" || res.Item != "items/7" {
+		t.Errorf("update without mask = %+v, %v, want num and status only", res, err)
+	}
+
+	req.UpdateMask.Paths = []string{"item"}
+	if _, err = srv.Update(ctx, req); !violates(err, "updateMask") {
+		t.Errorf("update of item: got %v, want a violation of updateMask", err)
+	}
+}
+
+func violates(err error, field string) bool {
+	for _, detail := range errors.Details(err) {
+		if br, ok := detail.(errors.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				if v.Field == field {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package customer
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"server/internal/service/entity"
+)
+
+const Pattern entity.Pattern = "customers/{customerID}"
+
+type Entity struct {
+	ID         int64     `json:"id,string"`
+	Name       string    `json:"name"`
+	Nick       string    `json:"nick" validate:"required"`
+	Balance    float64   `json:"balance" validate:"min=0"`
+	CreateTime time.Time `json:"createTime"`
+}
+
+func (e Entity) GetID() string {
+	return strconv.FormatInt(e.ID, 10)
+}
+
+func (e Entity) GetName() string {
+	return e.Name
+}
+
+func (e Entity) InsertValues() []any {
+	return []any{e.Nick, e.Balance}
+}
+
+func newDao(db *sql.DB) entity.Dao[Entity] {
+	const allFields = "id, nick, balance, create_time"
+	return entity.Dao[Entity]{
+		DB:        db,
+		Pattern:   Pattern,
+		Table:     "customer",
+		Keys:      []string{"id"},
+		Updatable: []string{"nick", "balance"},
+		SqlCreate: "insert into customer (nick, balance) values (?, ?)",
+		SqlGet:    "select " + allFields + " from customer where id = ? limit 1",
+		SqlList:   "select " + allFields + " from customer where id > ?",
+		SqlDelete: "delete from customer where id = ?",
+		ScanAllFields: func(row entity.Scanner) (e Entity, err error) {
+			if err = row.Scan(&e.ID, &e.Nick, &e.Balance, &e.CreateTime); err == nil {
+				e.Name = Pattern.Format(e.GetID())
+			}
+			return
+		},
+	}
+}
@@ -0,0 +1,79 @@
+package customer
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"server/internal/service/entity"
+)
+
+type Service struct {
+	dao entity.Dao[Entity]
+}
+
+func New(db *sql.DB) Service {
+	return Service{dao: newDao(db)}
+}
+
+func (srv Service) Check(ctx context.Context) error {
+	return srv.dao.Check(ctx)
+}
+
+type GetRequest struct {
+	CustomerID string `param:"customerID"`
+}
+
+func (srv Service) Get(ctx context.Context, req GetRequest) (res Entity, err error) {
+	return srv.dao.Get(ctx, Pattern.Format(req.CustomerID))
+}
+
+func (srv Service) Create(ctx context.Context, entity Entity) (res Entity, err error) {
+	return srv.dao.Create(ctx, "", entity)
+}
+
+type ListRequest struct {
+	entity.ListRequestFragment
+}
+
+type ListResponse struct {
+	entity.ListResponseFragment
+	Customers []Entity `json:"customers"`
+}
+
+func (srv Service) List(ctx context.Context, req ListRequest) (res ListResponse, err error) {
+	var raw entity.ListResponse[Entity]
+	if raw, err = srv.dao.List(ctx, "", req); err != nil {
+		return
+	}
+
+	res.Customers = raw.Items
+	res.ListResponseFragment = raw.ListResponseFragment
+	return
+}
+
+type UpdateRequest struct {
+	entity.UpdateRequestFragment
+	CustomerID string `param:"customerID"`
+	Customer   Entity `json:"customer"`
+}
+
+func (srv Service) Update(ctx context.Context, req UpdateRequest) (res Entity, err error) {
+	uReq := entity.UpdateRequest[Entity]{
+		UpdateRequestFragment: req.UpdateRequestFragment,
+		Name:                  Pattern.Format(req.CustomerID),
+		Entity:                req.Customer,
+	}
+	return srv.dao.Update(ctx, uReq)
+}
+
+type DeleteRequest struct {
+	CustomerID string `param:"customerID"`
+}
+
+func (srv Service) Delete(ctx context.Context, req DeleteRequest) (code int, err error) {
+	if err = srv.dao.Delete(ctx, Pattern.Format(req.CustomerID)); err == nil {
+		code = http.StatusNoContent
+	}
+	return
+}
@@ -0,0 +1,97 @@
+package customer
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+
+	"github.com/gota33/errors"
+	_ "github.com/mattn/go-sqlite3"
+	"server/internal/service/entity"
+)
+
+func newTestService(t *testing.T) Service {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err = db.Exec(`
+create table customer
+(
+    id          integer primary key autoincrement,
+    nick        text           not null check (length(nick) > 0),
+    balance     decimal(12, 2) not null check (balance >= 0),
+    create_time timestamp      not null default current_timestamp
+);
+create table revision
+(
+    id          integer primary key autoincrement,
+    resource    text not null,
+    operation   text not null,
+    actor       text not null default '',
+    update_mask text not null default '',
+    before_json text null,
+    after_json  text null,
+    create_time timestamp not null default current_timestamp
+);
+create table outbox
+(
+    id          integer primary key autoincrement,
+    type        text not null,
+    resource    text not null,
+    actor       text not null default '',
+    update_mask text not null default '',
+    data        text not null,
+    create_time timestamp not null default current_timestamp
+);`); err != nil {
+		t.Fatal(err)
+	}
+	return New(db)
+}
+
+func TestCustomerResource(t *testing.T) {
+	var (
+		srv = newTestService(t)
+		ctx = context.Background()
+	)
+	created, err := srv.Create(ctx, Entity{Nick: "alice", Balance: 10})
+	if err != nil || created.Name != "customers/"+created.GetID() {
+		t.Fatalf("create = %+v, %v, want a name of its id", created, err)
+	}
+	if _, err = srv.Create(ctx, Entity{Nick: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := srv.Get(ctx, GetRequest{CustomerID: created.GetID()})
+	if err != nil || got != created {
+		t.Errorf("get = %+v, %v, want %+v", got, err, created)
+	}
+
+	list, err := srv.List(ctx, ListRequest{ListRequestFragment: entity.ListRequestFragment{PageSize: 1}})
+	if err != nil || len(list.Customers) != 1 || list.Customers[0].Name != created.Name || list.NextPageToken != created.GetID() {
+		t.Errorf("first page = %+v, %v", list, err)
+	}
+	list, err = srv.List(ctx, ListRequest{ListRequestFragment: entity.ListRequestFragment{PageSize: 1, PageToken: list.NextPageToken}})
+	if err != nil || len(list.Customers) != 1 || list.Customers[0].Nick != "bob" {
+		t.Errorf("second page = %+v, %v", list, err)
+	}
+
+	req := UpdateRequest{CustomerID: created.GetID(), Customer: Entity{Nick: "carol", Balance: 20}}
+	req.UpdateMask.Paths = []string{"nick"}
+	if got, err = srv.Update(ctx, req); err != nil || got.Nick != "carol" || got.Balance != 10 {
+		t.Errorf("update of nick = %+v, %v, want balance kept", got, err)
+	}
+
+	if code, err := srv.Delete(ctx, DeleteRequest{CustomerID: created.GetID()}); err != nil || code != http.StatusNoContent {
+		t.Fatalf("delete = %d, %v", code, err)
+	}
+	if _, err = srv.Get(ctx, GetRequest{CustomerID: created.GetID()}); errors.Code(err) != errors.NotFound {
+		t.Errorf("get after delete: got %v, want NotFound", err)
+	}
+}
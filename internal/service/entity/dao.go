@@ -3,8 +3,13 @@ package entity
 import (
 	"context"
 	"database/sql"
+	"strings"
+	"sync"
 
 	"github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"server/internal/service/trace"
 )
 
 type Scanner interface {
@@ -28,11 +33,31 @@ type SQLTx interface {
 	Rollback() error
 }
 
+// BeginTx begins a traced transaction if db supports it, otherwise runs on db as is,
+// e.g. nested in the transaction of the caller.
 func BeginTx(ctx context.Context, db SQLCmd, opts *sql.TxOptions) (tx SQLCmd, finish func(error) error, err error) {
-	switch db := db.(type) {
+	inner := db
+	if t, ok := db.(tracedCmd); ok {
+		inner = t.SQLCmd
+	}
+
+	switch inner := inner.(type) {
 	case SQLBeginTx:
-		tx, err = db.BeginTx(ctx, opts)
-		finish = func(cause error) error { return finishTx(tx.(*sql.Tx), cause) }
+		var (
+			span  oteltrace.Span
+			sqlTx *sql.Tx
+		)
+		ctx, span = trace.Start(ctx, "sql.tx", oteltrace.WithSpanKind(oteltrace.SpanKindClient))
+		if sqlTx, err = inner.BeginTx(ctx, opts); err != nil {
+			trace.End(span, err)
+			return
+		}
+		tx = Traced(sqlTx)
+		finish = func(cause error) error {
+			finishErr := finishTx(ctx, sqlTx, cause)
+			trace.End(span, finishErr)
+			return finishErr
+		}
 	default:
 		tx = db
 		finish = func(cause error) error { return cause }
@@ -40,18 +65,78 @@ func BeginTx(ctx context.Context, db SQLCmd, opts *sql.TxOptions) (tx SQLCmd, fi
 	return
 }
 
-func finishTx(tx SQLTx, cause error) (err error) {
+func finishTx(ctx context.Context, tx SQLTx, cause error) (err error) {
 	if err = cause; err == nil {
 		return tx.Commit()
 	}
-	if rollbackErr := tx.Rollback(); rollbackErr != nil {
-		logrus.WithError(rollbackErr).Warnf("Rollback error")
+	// Transactions are already rolled back once ctx is cancelled
+	if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+		trace.Logger(ctx).WithError(rollbackErr).Warnf("Rollback error")
 	}
 	return
 }
 
+// CloseRows releases the connection of rows, which isn't done by rows.Next
+// if reading stops early, e.g. a stream is cancelled. Spans of traced queries
+// end here, so rows of them must be closed by CloseRows.
 func CloseRows(rows *sql.Rows) {
-	if closeErr := rows.Err(); closeErr != nil {
+	closeErr := rows.Close()
+	if closeErr != nil {
 		logrus.WithError(closeErr).Warn("Close rows error")
 	}
+	if span, ok := rowSpans.LoadAndDelete(rows); ok {
+		err := rows.Err()
+		if err == nil {
+			err = closeErr
+		}
+		trace.End(span.(oteltrace.Span), err)
+	}
+}
+
+// Traced wraps db so every statement is recorded as a span.
+func Traced(db SQLCmd) SQLCmd {
+	if _, ok := db.(tracedCmd); ok {
+		return db
+	}
+	return tracedCmd{db}
+}
+
+type tracedCmd struct {
+	SQLCmd
+}
+
+// rowSpans keeps spans of queries by their rows until CloseRows,
+// so they cover reading rows rather than only sending queries.
+var rowSpans sync.Map
+
+func (t tracedCmd) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := startStatement(ctx, query)
+	row := t.SQLCmd.QueryRowContext(ctx, query, args...)
+	trace.End(span, row.Err())
+	return row
+}
+
+func (t tracedCmd) ExecContext(ctx context.Context, query string, args ...any) (res sql.Result, err error) {
+	ctx, span := startStatement(ctx, query)
+	defer func() { trace.End(span, err) }()
+
+	return t.SQLCmd.ExecContext(ctx, query, args...)
+}
+
+func (t tracedCmd) QueryContext(ctx context.Context, query string, args ...any) (rows *sql.Rows, err error) {
+	ctx, span := startStatement(ctx, query)
+	if rows, err = t.SQLCmd.QueryContext(ctx, query, args...); err != nil {
+		trace.End(span, err)
+		return
+	}
+	rowSpans.Store(rows, span)
+	return
+}
+
+// startStatement names spans after the SQL verb, e.g. "sql.select".
+func startStatement(ctx context.Context, query string) (context.Context, oteltrace.Span) {
+	verb, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	return trace.Start(ctx, "sql."+strings.ToLower(verb),
+		oteltrace.WithSpanKind(oteltrace.SpanKindClient),
+		oteltrace.WithAttributes(semconv.DBStatementKey.String(query)))
 }
@@ -0,0 +1,49 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var recorder = tracetest.NewSpanRecorder()
+
+func init() {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+}
+
+func TestTracedQuerySpansRows(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const script = "select 1 union all select 2"
+	rows, err := Traced(db).QueryContext(context.Background(), script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	if ended := recorder.Ended(); len(ended) != 0 {
+		t.Fatalf("%d spans ended before rows are closed", len(ended))
+	}
+
+	read := time.Now()
+	CloseRows(rows)
+
+	ended := recorder.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("%d spans ended, want 1", len(ended))
+	}
+	if span := ended[0]; span.Name() != "sql.select" || span.EndTime().Before(read) {
+		t.Errorf("span %q ended at %v, want sql.select ending after rows read at %v", span.Name(), span.EndTime(), read)
+	}
+}
@@ -35,14 +35,18 @@ func (mask FieldMask) ToMap(e any) (m map[string]any, err error) {
 		}
 	} else {
 		delete(mFields, "id")
+		delete(mFields, "name")
 		m = mFields
 	}
 	return
 }
 
 type ListRequestFragment struct {
-	PageSize          int    `query:"pageSize"`
-	PageToken         string `query:"pageToken"`
+	PageSize  int    `query:"pageSize"`
+	PageToken string `query:"pageToken"`
+	Filter    string `query:"filter"`
+	// ReadMask selects columns of CSV responses, e.g. "name,title"
+	ReadMask          string `query:"readMask"`
 	FallbackPageSize  int
 	FallbackPageToken string
 }
@@ -67,6 +71,38 @@ func (r ListRequestFragment) GetPageToken() string {
 	return "0"
 }
 
+func (r ListRequestFragment) GetFilter() string {
+	return r.Filter
+}
+
+func (r ListRequestFragment) GetReadMask() []string {
+	return splitPaths(r.ReadMask)
+}
+
+// ExportRequestFragment selects resources exported at once, without paging.
+type ExportRequestFragment struct {
+	Filter string `query:"filter"`
+	// ReadMask selects columns of CSV responses, e.g. "name,title"
+	ReadMask string `query:"readMask"`
+}
+
+func (r ExportRequestFragment) GetFilter() string {
+	return r.Filter
+}
+
+func (r ExportRequestFragment) GetReadMask() []string {
+	return splitPaths(r.ReadMask)
+}
+
+func splitPaths(mask string) (paths []string) {
+	for _, p := range strings.Split(mask, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return
+}
+
 type ListResponseFragment struct {
 	NextPageToken string `json:"nextPageToken"`
 }
@@ -75,14 +111,21 @@ type UpdateRequestFragment struct {
 	UpdateMask FieldMask `json:"updateMask"`
 }
 
-func SQLUpdate(table string, id any, fields map[string]any) (script string, args []any) {
+func SQLUpdate(table string, keys []string, ids []any, fields map[string]any) (script string, args []any) {
 	var sb strings.Builder
 	sb.WriteString("update ")
 	sb.WriteString(table)
 	sb.WriteString(" set ")
 	args = append(args, mapJoin(&sb, fields, ", ")...)
-	sb.WriteString(" where id = ?")
-	args = append(args, id)
+	sb.WriteString(" where ")
+	for i, key := range keys {
+		if i > 0 {
+			sb.WriteString(" and ")
+		}
+		sb.WriteString(key)
+		sb.WriteString(" = ?")
+	}
+	args = append(args, ids...)
 	script = sb.String()
 	return
 }
@@ -0,0 +1,81 @@
+package entity
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/service/auth"
+)
+
+var eventSuffix = map[string]string{
+	OperationCreate: "created",
+	OperationUpdate: "updated",
+	OperationDelete: "deleted",
+}
+
+// Event is a domain event appended to outbox in the same transaction as the change,
+// e.g. "item.updated". Data holds the resource after change, or before delete.
+type Event struct {
+	ID         int64           `json:"id,string"`
+	Type       string          `json:"type"`
+	Resource   string          `json:"resource"`
+	Actor      string          `json:"actor,omitempty"`
+	UpdateMask FieldMask       `json:"updateMask"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	CreateTime time.Time       `json:"createTime"`
+}
+
+func (e Event) GetID() string {
+	return strconv.FormatInt(e.ID, 10)
+}
+
+func (e Event) GetName() string {
+	return "events/" + e.GetID()
+}
+
+func (e Event) InsertValues() []any {
+	return []any{
+		e.Type,
+		e.Resource,
+		e.Actor,
+		strings.Join(e.UpdateMask.Paths, ","),
+		nullJSON(e.Data),
+	}
+}
+
+func ScanEvent(row Scanner) (e Event, err error) {
+	var mask, data string
+	if err = row.Scan(&e.ID, &e.Type, &e.Resource, &e.Actor, &mask, &data, &e.CreateTime); err != nil {
+		return
+	}
+	if mask != "" {
+		e.UpdateMask.Paths = strings.Split(mask, ",")
+	}
+	if data != "" {
+		e.Data = json.RawMessage(data)
+	}
+	return
+}
+
+func writeEvent(ctx context.Context, tx SQLCmd, table, name, op string, mask FieldMask, data any) (err error) {
+	e := Event{
+		Type:       table + "." + eventSuffix[op],
+		Resource:   name,
+		UpdateMask: mask,
+	}
+
+	var user auth.User
+	if user.FromContext(ctx) == nil {
+		e.Actor = user.Subject
+	}
+	if e.Data, err = json.Marshal(data); err != nil {
+		return
+	}
+
+	const script = "insert into outbox (type, resource, actor, update_mask, data) values (?, ?, ?, ?, ?)"
+	_, err = tx.ExecContext(ctx, script, e.InsertValues()...)
+	return
+}
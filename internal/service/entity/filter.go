@@ -0,0 +1,252 @@
+package entity
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gota33/errors"
+)
+
+var filterOps = map[string]string{
+	"=":  "=",
+	"!=": "<>",
+	"<":  "<",
+	"<=": "<=",
+	">":  ">",
+	">=": ">=",
+	":":  "like",
+}
+
+// likeEscape escapes wildcards in values of ":", it's not a backslash
+// since MySQL takes backslashes in string literals as escapes too.
+const likeEscape = "!"
+
+var likeReplacer = strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_")
+
+// Filter is a subset of AIP-160: comparisons joined by AND,
+// e.g. `price >= 10 AND title : "pen"`. The ":" operator matches substrings.
+type Filter struct {
+	terms []term
+}
+
+type term struct {
+	field string
+	op    string
+	value any
+}
+
+func ParseFilter(str string) (f Filter, err error) {
+	var tokens []string
+	if tokens, err = tokenize(str); err != nil {
+		return
+	}
+
+	for i := 0; i < len(tokens); i += 4 {
+		if i+3 > len(tokens) {
+			return f, invalidFilter("incomplete expression near %q", strings.Join(tokens[i:], " "))
+		}
+
+		t := term{field: tokens[i], op: tokens[i+1]}
+		if _, ok := filterOps[t.op]; !ok {
+			return f, invalidFilter("unknown operator %q", t.op)
+		}
+		if !isIdent(t.field) {
+			return f, invalidFilter("invalid field %q", t.field)
+		}
+		t.value = parseValue(tokens[i+2])
+		f.terms = append(f.terms, t)
+
+		if i+3 < len(tokens) && tokens[i+3] != "AND" {
+			return f, invalidFilter("expect AND, got %q", tokens[i+3])
+		}
+	}
+	return
+}
+
+func (f Filter) Empty() bool {
+	return len(f.terms) == 0
+}
+
+// Match evaluates filter against the json fields of a resource.
+func (f Filter) Match(fields map[string]any) bool {
+	for _, t := range f.terms {
+		value, ok := fields[t.field]
+		if !ok || !t.match(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// SQL renders filter as where condition, column maps fields to columns
+// and rejects fields that can't be filtered.
+func (f Filter) SQL(column func(field string) (string, bool)) (cond string, args []any, err error) {
+	conds := make([]string, len(f.terms))
+	for i, t := range f.terms {
+		name, ok := column(t.field)
+		if !ok {
+			return "", nil, invalidFilter("field %q can't be filtered", t.field)
+		}
+
+		value := t.value
+		conds[i] = name + " " + filterOps[t.op] + " ?"
+		if t.op == ":" {
+			value = "%" + likeReplacer.Replace(fmt.Sprint(value)) + "%"
+			conds[i] += " escape '" + likeEscape + "'"
+		}
+		args = append(args, value)
+	}
+	cond = strings.Join(conds, " and ")
+	return
+}
+
+func (t term) match(value any) bool {
+	if t.op == ":" {
+		return strings.Contains(fmt.Sprint(value), fmt.Sprint(t.value))
+	}
+
+	var c int
+	switch expect := t.value.(type) {
+	case float64:
+		actual, ok := toFloat(value)
+		if !ok {
+			return false
+		}
+		c = compare(actual < expect, actual > expect)
+	case bool:
+		actual, ok := value.(bool)
+		if !ok || (t.op != "=" && t.op != "!=") {
+			return false
+		}
+		c = compare(false, actual != expect)
+	default:
+		actual := fmt.Sprint(value)
+		expectStr := fmt.Sprint(expect)
+		c = compare(actual < expectStr, actual > expectStr)
+	}
+
+	switch t.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+func compare(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(value any) (f float64, ok bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		var err error
+		f, err = strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return
+}
+
+func parseValue(token string) any {
+	if unquoted, err := strconv.Unquote(token); err == nil {
+		return unquoted
+	}
+	switch token {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if f, err := strconv.ParseFloat(token, 64); err == nil {
+		return f
+	}
+	return token
+}
+
+func tokenize(str string) (tokens []string, err error) {
+	runes := []rune(str)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"':
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, invalidFilter("unterminated string")
+			}
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		case strings.ContainsRune("=!<>:", r):
+			j := i + 1
+			if j < len(runes) && runes[j] == '=' {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		default:
+			j := i
+			for ; j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("=!<>:\"", runes[j]); j++ {
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		}
+	}
+	return
+}
+
+func isIdent(str string) bool {
+	for i, r := range str {
+		if !(r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return str != ""
+}
+
+func invalidFilter(format string, args ...any) error {
+	cause := fmt.Errorf("invalid filter: "+format, args...)
+	return errors.WithBadRequest(cause, errors.BadRequest{
+		FieldViolations: []errors.FieldViolation{{
+			Field:       "filter",
+			Description: cause.Error(),
+		}},
+	})
+}
+
+// snakeCase converts json field name to column name, e.g. createTime to create_time.
+func snakeCase(field string) string {
+	var sb strings.Builder
+	for _, r := range field {
+		if unicode.IsUpper(r) {
+			sb.WriteByte('_')
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,57 @@
+package entity
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestFilterSQLEscapesWildcards(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err = db.Exec("create table item (title text); " +
+		"insert into item values ('100% off'), ('100 off'), ('a_b'), ('ab'), ('x!y')"); err != nil {
+		t.Fatal(err)
+	}
+
+	column := func(field string) (string, bool) { return field, field == "title" }
+	tests := map[string]string{
+		`title : "%"`:  "100% off",
+		`title : "_"`:  "a_b",
+		`title : "!"`:  "x!y",
+		`title : "ab"`: "ab",
+	}
+	for str, want := range tests {
+		filter, parseErr := ParseFilter(str)
+		if parseErr != nil {
+			t.Fatal(parseErr)
+		}
+		cond, args, sqlErr := filter.SQL(column)
+		if sqlErr != nil {
+			t.Fatal(sqlErr)
+		}
+
+		var titles []string
+		rows, queryErr := db.Query("select title from item where "+cond, args...)
+		if queryErr != nil {
+			t.Fatalf("%s: %v", cond, queryErr)
+		}
+		for rows.Next() {
+			var title string
+			if err = rows.Scan(&title); err != nil {
+				t.Fatal(err)
+			}
+			titles = append(titles, title)
+		}
+		_ = rows.Close()
+
+		if len(titles) != 1 || titles[0] != want {
+			t.Errorf("filter %s matched %q, want [%q]", str, titles, want)
+		}
+	}
+}
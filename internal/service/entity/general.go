@@ -3,21 +3,30 @@ package entity
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"strconv"
 	"unicode"
 
 	"github.com/gota33/errors"
+	"github.com/sirupsen/logrus"
+	"server/internal/service/trace"
 )
 
 type Entity interface {
 	GetID() string
+	GetName() string
 	InsertValues() []any
 }
 
 type Dao[e Entity] struct {
-	DB            SQLCmd
-	ResourceType  string
-	Table         string
+	DB      SQLCmd
+	Pattern Pattern
+	Table   string
+	Keys    []string
+	Columns map[string]string
+	// Updatable lists json fields updates may set, all of them are set without an update mask
+	Updatable     []string
 	SqlGet        string
 	SqlCreate     string
 	SqlList       string
@@ -28,8 +37,11 @@ type Dao[e Entity] struct {
 func (d Dao[Entity]) WithDB(db SQLCmd) Dao[Entity] {
 	return Dao[Entity]{
 		DB:            db,
-		ResourceType:  d.ResourceType,
+		Pattern:       d.Pattern,
 		Table:         d.Table,
+		Keys:          d.Keys,
+		Columns:       d.Columns,
+		Updatable:     d.Updatable,
 		SqlGet:        d.SqlGet,
 		SqlCreate:     d.SqlCreate,
 		SqlList:       d.SqlList,
@@ -38,34 +50,69 @@ func (d Dao[Entity]) WithDB(db SQLCmd) Dao[Entity] {
 	}
 }
 
-func (d Dao[Entity]) notFound(id string, cause error) error {
+func (d Dao[Entity]) notFound(name string, cause error) error {
 	return errors.WithNotFound(cause, errors.ResourceInfo{
-		ResourceType: d.ResourceType,
-		ResourceName: d.ResourceType + "/" + id,
+		ResourceType: d.Pattern.Collection(),
+		ResourceName: name,
 	})
 }
 
-func (d Dao[Entity]) Get(ctx context.Context, id string) (e Entity, err error) {
-	row := d.DB.QueryRowContext(ctx, d.SqlGet, id)
+// Check tells whether the table of Dao exists, i.e. its migrations are applied.
+// Tables shared by every Dao are checked once, see CheckTables.
+func (d Dao[Entity]) Check(ctx context.Context) error {
+	return CheckTables(d.DB, d.Table)(ctx)
+}
+
+// CheckTables returns a check telling whether tables exist, e.g. "revision" and "outbox"
+// which every Dao writes to.
+func CheckTables(db SQLCmd, tables ...string) func(ctx context.Context) error {
+	return func(ctx context.Context) (err error) {
+		for _, table := range tables {
+			if _, err = db.ExecContext(ctx, "select 1 from "+table+" limit 0"); err != nil {
+				return
+			}
+		}
+		return
+	}
+}
+
+func (d Dao[Entity]) Get(ctx context.Context, name string) (e Entity, err error) {
+	ctx, end := d.start(ctx, "get")
+	defer func() { end(err) }()
+
+	var ids []string
+	if ids, err = d.Pattern.Parse(name); err != nil {
+		return
+	}
+
+	row := Traced(d.DB).QueryRowContext(ctx, d.SqlGet, toArgs(ids)...)
 	if e, err = d.ScanAllFields(row); err != nil {
-		err = d.notFound(id, err)
+		err = d.notFound(name, err)
 	}
 	return
 }
 
-func (d Dao[Entity]) Create(ctx context.Context, e Entity) (next Entity, err error) {
+func (d Dao[Entity]) Create(ctx context.Context, parent string, e Entity) (next Entity, err error) {
+	ctx, end := d.start(ctx, "create")
+	defer func() { end(err) }()
+
 	var (
 		tx     SQLCmd
 		finish func(error) error
 		sr     sql.Result
 		id     int64
+		ids    []string
 	)
+	if ids, err = d.Pattern.Parent().Parse(parent); err != nil {
+		return
+	}
 	if tx, finish, err = BeginTx(ctx, d.DB, nil); err != nil {
 		return
 	}
 	defer func() { err = finish(err) }()
 
-	if sr, err = tx.ExecContext(ctx, d.SqlCreate, e.InsertValues()...); err != nil {
+	args := append(toArgs(ids), e.InsertValues()...)
+	if sr, err = tx.ExecContext(ctx, d.SqlCreate, args...); err != nil {
 		return
 	}
 	if id, err = sr.LastInsertId(); err != nil {
@@ -73,12 +120,18 @@ func (d Dao[Entity]) Create(ctx context.Context, e Entity) (next Entity, err err
 	}
 
 	sub := d.WithDB(tx)
-	return sub.Get(ctx, strconv.FormatInt(id, 10))
+	ids = append(ids, strconv.FormatInt(id, 10))
+	if next, err = sub.Get(ctx, d.Pattern.Format(ids...)); err != nil {
+		return
+	}
+	err = d.record(ctx, tx, next.GetName(), OperationCreate, FieldMask{}, nil, next)
+	return
 }
 
 type ListRequest interface {
 	GetPageSize() int
 	GetPageToken() string
+	GetFilter() string
 }
 
 type ListResponse[e Entity] struct {
@@ -86,35 +139,130 @@ type ListResponse[e Entity] struct {
 	Items []e
 }
 
-func (d Dao[Entity]) List(ctx context.Context, req ListRequest) (res ListResponse[Entity], err error) {
-	var rows *sql.Rows
-	if rows, err = d.DB.QueryContext(ctx, d.SqlList,
-		req.GetPageToken(), req.GetPageSize()); err != nil {
+func (d Dao[Entity]) List(ctx context.Context, parent string, req ListRequest) (res ListResponse[Entity], err error) {
+	ctx, end := d.start(ctx, "list")
+	defer func() { end(err) }()
+
+	var (
+		script string
+		args   []any
+	)
+	if script, args, err = d.listScript(parent, req.GetFilter(), req.GetPageToken()); err != nil {
 		return
 	}
+	script += " order by id limit ?"
+	args = append(args, req.GetPageSize())
 
-	defer CloseRows(rows)
+	err = d.scan(ctx, script, args, func(e Entity) error {
+		res.Items = append(res.Items, e)
+		return nil
+	})
+	if err != nil {
+		return
+	}
 
-	for rows.Next() {
-		var e Entity
-		if e, err = d.ScanAllFields(rows); err != nil {
+	if size := len(res.Items); size == req.GetPageSize() {
+		res.NextPageToken = res.Items[size-1].GetID()
+	}
+	return
+}
+
+type FilterRequest interface {
+	GetFilter() string
+}
+
+// streamPageSize is how many resources Stream reads at once.
+const streamPageSize = 100
+
+// Stream calls fn with every resource matching the filter in order, without a page size.
+// Resources are read in pages after the last ID, closing rows before fn is called, so a
+// slow consumer holds neither a connection nor more than a page, and an error of fn or
+// ctx stops it.
+func (d Dao[Entity]) Stream(ctx context.Context, parent string, req FilterRequest, fn func(Entity) error) (err error) {
+	ctx, end := d.start(ctx, "stream")
+	defer func() { end(err) }()
+
+	for last := "0"; ; {
+		var (
+			script string
+			args   []any
+			page   []Entity
+		)
+		if script, args, err = d.listScript(parent, req.GetFilter(), last); err != nil {
 			return
 		}
-		res.Items = append(res.Items, e)
+		err = d.scan(ctx, script+" order by id limit ?", append(args, streamPageSize), func(e Entity) error {
+			page = append(page, e)
+			return nil
+		})
+		if err != nil {
+			return
+		}
+
+		for _, e := range page {
+			if err = fn(e); err != nil {
+				return
+			}
+		}
+		if len(page) < streamPageSize {
+			return
+		}
+		last = page[len(page)-1].GetID()
+	}
+}
+
+// listScript selects resources of parent after pageToken, filtered by the filter expression.
+func (d Dao[Entity]) listScript(parent, expr, pageToken string) (script string, args []any, err error) {
+	var (
+		ids    []string
+		filter Filter
+	)
+	if ids, err = d.Pattern.Parent().Parse(parent); err != nil {
+		return
 	}
-	if err = rows.Err(); err != nil {
+	if filter, err = ParseFilter(expr); err != nil {
 		return
 	}
 
-	if size := len(res.Items); size == req.GetPageSize() {
-		res.NextPageToken = res.Items[size-1].GetID()
+	script = d.SqlList
+	args = append(toArgs(ids), pageToken)
+	if !filter.Empty() {
+		var (
+			cond  string
+			fArgs []any
+		)
+		if cond, fArgs, err = filter.SQL(d.column); err != nil {
+			return
+		}
+		script += " and " + cond
+		args = append(args, fArgs...)
 	}
 	return
 }
 
+func (d Dao[Entity]) scan(ctx context.Context, script string, args []any, fn func(Entity) error) (err error) {
+	var rows *sql.Rows
+	if rows, err = Traced(d.DB).QueryContext(ctx, script, args...); err != nil {
+		return
+	}
+
+	defer CloseRows(rows)
+
+	for rows.Next() {
+		var e Entity
+		if e, err = d.ScanAllFields(rows); err != nil {
+			return
+		}
+		if err = fn(e); err != nil {
+			return
+		}
+	}
+	return rows.Err()
+}
+
 type UpdateRequest[E Entity] struct {
 	UpdateRequestFragment
-	ID     string
+	Name   string
 	Entity E
 }
 
@@ -134,46 +282,172 @@ func (req UpdateRequest[Entity]) validate() (err error) {
 }
 
 func (d Dao[Entity]) Update(ctx context.Context, req UpdateRequest[Entity]) (res Entity, err error) {
+	ctx, end := d.start(ctx, "update")
+	defer func() { end(err) }()
+
+	var ids []string
+	if ids, err = d.Pattern.Parse(req.Name); err != nil {
+		return
+	}
 	if err = req.validate(); err != nil {
 		return
 	}
 
+	mask := req.UpdateMask
+	if len(mask.Paths) == 0 {
+		mask.Paths = d.Updatable
+	}
+	for _, path := range mask.Paths {
+		if !d.updatable(path) {
+			cause := fmt.Errorf("field %q is not updatable", path)
+			return res, errors.WithBadRequest(cause, errors.BadRequest{
+				FieldViolations: []errors.FieldViolation{{
+					Field:       "updateMask",
+					Description: cause.Error(),
+				}},
+			})
+		}
+	}
+
 	var fields map[string]any
-	if fields, err = req.UpdateMask.ToMap(req.Entity); err != nil {
+	if fields, err = mask.ToMap(req.Entity); err != nil {
+		return
+	}
+	if fields, err = d.toColumns(fields); err != nil {
 		return
 	}
-	script, args := SQLUpdate(d.Table, req.ID, fields)
+	script, args := SQLUpdate(d.Table, d.Keys, toArgs(ids), fields)
 
 	var (
 		tx     SQLCmd
 		finish func(error) error
+		prev   Entity
 	)
 	if tx, finish, err = BeginTx(ctx, d.DB, nil); err != nil {
 		return
 	}
 	defer func() { err = finish(err) }()
 
+	sub := d.WithDB(tx)
+	if prev, err = sub.Get(ctx, req.Name); err != nil {
+		return
+	}
 	if _, err = tx.ExecContext(ctx, script, args...); err != nil {
 		return
 	}
-
-	sub := d.WithDB(tx)
-	return sub.Get(ctx, req.ID)
+	if res, err = sub.Get(ctx, req.Name); err != nil {
+		return
+	}
+	err = d.record(ctx, tx, req.Name, OperationUpdate, req.UpdateMask, prev, res)
+	return
 }
 
-func (d Dao[Entity]) Delete(ctx context.Context, id string) (err error) {
+func (d Dao[Entity]) Delete(ctx context.Context, name string) (err error) {
+	ctx, end := d.start(ctx, "delete")
+	defer func() { end(err) }()
+
 	var (
-		sr  sql.Result
-		num int64
+		tx     SQLCmd
+		finish func(error) error
+		sr     sql.Result
+		num    int64
+		ids    []string
+		prev   Entity
 	)
-	if sr, err = d.DB.ExecContext(ctx, d.SqlDelete, id); err != nil {
+	if ids, err = d.Pattern.Parse(name); err != nil {
+		return
+	}
+	if tx, finish, err = BeginTx(ctx, d.DB, nil); err != nil {
+		return
+	}
+	defer func() { err = finish(err) }()
+
+	sub := d.WithDB(tx)
+	if prev, err = sub.Get(ctx, name); err != nil {
+		return
+	}
+	if sr, err = tx.ExecContext(ctx, d.SqlDelete, toArgs(ids)...); err != nil {
 		return
 	}
 	if num, err = sr.RowsAffected(); err != nil {
 		return
 	}
 	if num == 0 {
-		err = d.notFound(id, errors.NotFound)
+		return d.notFound(name, errors.NotFound)
+	}
+	return d.record(ctx, tx, name, OperationDelete, FieldMask{}, prev, nil)
+}
+
+// column maps a json field to its column, fields are converted to snake case
+// unless renamed by Columns. An empty column means the field isn't stored as is.
+func (d Dao[Entity]) column(field string) (column string, ok bool) {
+	if column, ok = d.Columns[field]; ok {
+		return column, column != ""
+	}
+
+	var zero Entity
+	fields, err := toFields(zero)
+	if err != nil || field == "name" {
+		return
+	}
+	switch fields[field].(type) {
+	case string, float64, bool:
+		return snakeCase(field), true
+	}
+	return
+}
+
+func (d Dao[Entity]) updatable(field string) bool {
+	for _, f := range d.Updatable {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// toColumns maps json fields to columns like filters do, composite values are stored as JSON text.
+func (d Dao[Entity]) toColumns(fields map[string]any) (m map[string]any, err error) {
+	m = make(map[string]any, len(fields))
+	for field, value := range fields {
+		column, ok := d.column(field)
+		if !ok {
+			return nil, fmt.Errorf("field %q of %s isn't stored in a column", field, d.Table)
+		}
+		switch value.(type) {
+		case []any, map[string]any:
+			var data []byte
+			if data, err = json.Marshal(value); err != nil {
+				return
+			}
+			value = string(data)
+		}
+		m[column] = value
 	}
 	return
 }
+
+// record appends the audit revision and domain event within the write transaction.
+func (d Dao[Entity]) record(ctx context.Context, tx SQLCmd, name, op string, mask FieldMask, before, after any) (err error) {
+	trace.Logger(ctx).
+		WithFields(logrus.Fields{"resource": name, "operation": op}).
+		Debug("Record change")
+
+	if err = writeRevision(ctx, tx, name, op, mask, before, after); err != nil {
+		return
+	}
+
+	data := after
+	if op == OperationDelete {
+		data = before
+	}
+	return writeEvent(ctx, tx, d.Table, name, op, mask, data)
+}
+
+func toArgs(ids []string) []any {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
@@ -0,0 +1,218 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gota33/errors"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type thing struct {
+	ID         int64     `json:"id,string"`
+	Name       string    `json:"name"`
+	Title      string    `json:"title"`
+	CreateTime time.Time `json:"createTime"`
+}
+
+func (e thing) GetID() string       { return strconv.FormatInt(e.ID, 10) }
+func (e thing) GetName() string     { return e.Name }
+func (e thing) InsertValues() []any { return []any{e.Title} }
+
+type filterRequest struct{}
+
+func (filterRequest) GetFilter() string { return "" }
+
+func newThingDao(t *testing.T) Dao[thing] {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err = db.Exec(`
+create table thing
+(
+    id          integer primary key autoincrement,
+    title       text      not null,
+    create_time timestamp not null default current_timestamp
+);
+create table revision
+(
+    id          integer primary key autoincrement,
+    resource    text not null,
+    operation   text not null,
+    actor       text not null default '',
+    update_mask text not null default '',
+    before_json text null,
+    after_json  text null,
+    create_time timestamp not null default current_timestamp
+);
+create table outbox
+(
+    id          integer primary key autoincrement,
+    type        text not null,
+    resource    text not null,
+    actor       text not null default '',
+    update_mask text not null default '',
+    data        text not null,
+    create_time timestamp not null default current_timestamp
+);`); err != nil {
+		t.Fatal(err)
+	}
+
+	const pattern Pattern = "things/{thingID}"
+	const allFields = "id, title, create_time"
+	return Dao[thing]{
+		DB:        db,
+		Pattern:   pattern,
+		Table:     "thing",
+		Keys:      []string{"id"},
+		Updatable: []string{"title"},
+		SqlCreate: "insert into thing (title) values (?)",
+		SqlGet:    "select " + allFields + " from thing where id = ? limit 1",
+		SqlList:   "select " + allFields + " from thing where id > ?",
+		SqlDelete: "delete from thing where id = ?",
+		ScanAllFields: func(row Scanner) (e thing, err error) {
+			if err = row.Scan(&e.ID, &e.Title, &e.CreateTime); err == nil {
+				e.Name = pattern.Format(e.GetID())
+			}
+			return
+		},
+	}
+}
+
+func TestDaoUpdateMask(t *testing.T) {
+	var (
+		dao = newThingDao(t)
+		ctx = context.Background()
+	)
+	created, err := dao.Create(ctx, "", thing{Title: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(title string, paths ...string) (thing, error) {
+		return dao.Update(ctx, UpdateRequest[thing]{
+			UpdateRequestFragment: UpdateRequestFragment{UpdateMask: FieldMask{Paths: paths}},
+			Name:                  created.Name,
+			Entity:                thing{ID: 99, Name: "things/99", Title: title, CreateTime: time.Unix(0, 0)},
+		})
+	}
+
+	res, err := update("b", "title")
+	if err != nil || res.Title != "b" {
+		t.Fatalf("update title = %+v, %v", res, err)
+	}
+	// without a mask, only updatable fields are set
+	res, err = update("c")
+	if err != nil || res.Title != "c" || res.ID != created.ID || !res.CreateTime.Equal(created.CreateTime) {
+		t.Fatalf("update without mask = %+v, %v, want title c of %+v", res, err, created)
+	}
+
+	for _, path := range []string{"id", "name", "createTime", "create_time", "unknown"} {
+		_, err = update("d", "title", path)
+		if !violates(err, "updateMask") {
+			t.Errorf("update %q: got %v, want a violation of updateMask", path, err)
+		}
+	}
+	if res, err = dao.Get(ctx, created.Name); err != nil || res.Title != "c" {
+		t.Errorf("got %+v, %v after rejected updates, want title c", res, err)
+	}
+}
+
+// violates reports whether err is InvalidArgument with a violation of field.
+func violates(err error, field string) bool {
+	if errors.Code(err) != errors.InvalidArgument {
+		return false
+	}
+	for _, detail := range errors.Details(err) {
+		if br, ok := detail.(errors.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				if v.Field == field {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func TestDaoGetDelete(t *testing.T) {
+	var (
+		dao = newThingDao(t)
+		ctx = context.Background()
+	)
+	created, err := dao.Create(ctx, "", thing{Title: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Name != "things/"+created.GetID() {
+		t.Fatalf("created %+v, want a name of its id", created)
+	}
+
+	if _, err = dao.Get(ctx, "items/"+created.GetID()); !violates(err, "name") {
+		t.Errorf("get of another pattern: got %v, want a violation of name", err)
+	}
+	if err = dao.Delete(ctx, created.Name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dao.Get(ctx, created.Name); errors.Code(err) != errors.NotFound {
+		t.Errorf("get after delete: got %v, want NotFound", err)
+	}
+}
+
+func TestDaoStreamPages(t *testing.T) {
+	dao := newThingDao(t)
+	db := dao.DB.(*sql.DB)
+
+	if _, err := db.Exec(`with recursive n(i) as (select 1 union all select i + 1 from n where i < 250)
+		insert into thing (title) select 'thing ' || i from n`); err != nil {
+		t.Fatal(err)
+	}
+
+	var last int64
+	err := dao.Stream(context.Background(), "", filterRequest{}, func(e thing) error {
+		if e.ID != last+1 {
+			return errors.New("out of order: " + e.Name)
+		}
+		last = e.ID
+
+		// Rows are closed while fn runs, so the only connection is free
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		var n int
+		return db.QueryRowContext(ctx, "select count(*) from thing").Scan(&n)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last != 250 {
+		t.Errorf("streamed up to %d, want 250", last)
+	}
+}
+
+func TestDaoCheck(t *testing.T) {
+	ctx := context.Background()
+	dao := newThingDao(t)
+
+	if _, err := dao.DB.ExecContext(ctx, "drop table outbox"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dao.Check(ctx); err != nil {
+		t.Errorf("check of thing = %v, want nil without shared tables", err)
+	}
+	if err := CheckTables(dao.DB, "revision", "outbox")(ctx); err == nil {
+		t.Error("check of shared tables passed without outbox")
+	}
+	dao.Table = "missing"
+	if err := dao.Check(ctx); err == nil {
+		t.Error("check passed without the table of Dao")
+	}
+}
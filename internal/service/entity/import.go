@@ -0,0 +1,414 @@
+package entity
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gota33/errors"
+)
+
+const (
+	ImportCSV    = "csv"
+	ImportNDJSON = "ndjson"
+
+	// importChunk is how many rows are written per transaction
+	importChunk = 500
+	// maxImportLine bounds a line of NDJSON, longer ones fail the import
+	maxImportLine = 1 << 20
+	// MaxImportSize bounds uploaded files, they're kept base64 encoded in the
+	// request of their operation until it's done.
+	MaxImportSize = 8 << 20
+)
+
+var importFormats = map[string]string{
+	".csv":                 ImportCSV,
+	".ndjson":              ImportNDJSON,
+	".jsonl":               ImportNDJSON,
+	"text/csv":             ImportCSV,
+	"application/x-ndjson": ImportNDJSON,
+	"application/jsonl":    ImportNDJSON,
+}
+
+// ImportRequestFragment uploads a file of resources created by Dao.Import.
+type ImportRequestFragment struct {
+	// File is up to MaxImportSize bytes
+	File *multipart.FileHeader `form:"file" validate:"required"`
+	// Format is "csv" or "ndjson", detected from the file name or content type if empty
+	Format string `query:"format" validate:"omitempty,oneof=csv ndjson"`
+	// DryRun validates and writes every row, then rolls back
+	DryRun bool `query:"dryRun"`
+}
+
+// GetFormat returns Format, or the one detected from the uploaded file.
+func (r ImportRequestFragment) GetFormat() (string, error) {
+	if r.Format != "" {
+		return r.Format, nil
+	}
+	return ImportFormat(r.File.Filename, r.File.Header.Get("Content-Type"))
+}
+
+// ReadFile reads the uploaded file, files larger than MaxImportSize are rejected.
+func (r ImportRequestFragment) ReadFile() (data []byte, err error) {
+	if r.File.Size > MaxImportSize {
+		return nil, fileTooLarge()
+	}
+
+	var f multipart.File
+	if f, err = r.File.Open(); err != nil {
+		return
+	}
+
+	defer func() { _ = f.Close() }()
+
+	if data, err = io.ReadAll(io.LimitReader(f, MaxImportSize+1)); err == nil && len(data) > MaxImportSize {
+		return nil, fileTooLarge()
+	}
+	return
+}
+
+func fileTooLarge() error {
+	cause := fmt.Errorf("file is larger than %d bytes", MaxImportSize)
+	return errors.WithBadRequest(cause, errors.BadRequest{
+		FieldViolations: []errors.FieldViolation{{Field: "file", Description: cause.Error()}},
+	})
+}
+
+// ImportFormat detects the format by the extension of filename, then by contentType.
+func ImportFormat(filename, contentType string) (format string, err error) {
+	if format = importFormats[strings.ToLower(filepath.Ext(filename))]; format != "" {
+		return
+	}
+	if mediaType, _, parseErr := mime.ParseMediaType(contentType); parseErr == nil {
+		if format = importFormats[mediaType]; format != "" {
+			return
+		}
+	}
+
+	cause := fmt.Errorf("unknown format of %q, expect %s or %s", filename, ImportCSV, ImportNDJSON)
+	return "", errors.WithBadRequest(cause, errors.BadRequest{
+		FieldViolations: []errors.FieldViolation{{Field: "format", Description: cause.Error()}},
+	})
+}
+
+// ImportReport tells the outcome of every row, rows are numbered by lines of the file.
+type ImportReport struct {
+	DryRun    bool        `json:"dryRun"`
+	Total     int         `json:"total"`
+	Succeeded int         `json:"succeeded"`
+	Failed    int         `json:"failed"`
+	Rows      []ImportRow `json:"rows,omitempty"`
+}
+
+type ImportRow struct {
+	Row int `json:"row"`
+	// Name is the created resource, it's empty on failures and dry runs.
+	Name       string                  `json:"name,omitempty"`
+	Violations []errors.FieldViolation `json:"violations,omitempty"`
+}
+
+func (r *ImportReport) add(row ImportRow) {
+	r.Total++
+	if len(row.Violations) > 0 {
+		r.Failed++
+	} else {
+		r.Succeeded++
+	}
+	r.Rows = append(r.Rows, row)
+}
+
+// Import creates a resource of every row read from r, rows failing validation or
+// constraints are reported and skipped. Rows are written in chunks, each in a
+// transaction, and progress is called with the counts after every chunk.
+// A dry run rolls every chunk back.
+func (d Dao[Entity]) Import(ctx context.Context, parent string, r io.Reader, format string, dryRun bool, progress func(ImportReport)) (report ImportReport, err error) {
+	ctx, end := d.start(ctx, "import")
+	defer func() { end(err) }()
+
+	report.DryRun = dryRun
+	w := importWriter[Entity]{dao: d, parent: parent, dryRun: dryRun}
+	defer func() { err = w.finish(err) }()
+
+	flushed := func() {
+		if progress != nil {
+			summary := report
+			summary.Rows = nil
+			progress(summary)
+		}
+	}
+
+	err = decodeRows(r, format, func(row int, e Entity, rowErr error) (err error) {
+		result := ImportRow{Row: row}
+		if rowErr == nil {
+			rowErr = Validate.Struct(e)
+		}
+		if rowErr == nil {
+			if result.Name, rowErr, err = w.create(ctx, e); err != nil {
+				return
+			}
+		}
+		if rowErr != nil {
+			result.Violations = importViolations(rowErr)
+		}
+		report.add(result)
+
+		if w.pending >= importChunk {
+			if err = w.finish(nil); err == nil {
+				flushed()
+			}
+		}
+		return
+	})
+	if err == nil {
+		if err = w.finish(nil); err == nil {
+			flushed()
+		}
+	}
+	return
+}
+
+// importWriter creates rows in the transaction of the current chunk,
+// each in a savepoint, so a failed row doesn't leave partial writes.
+type importWriter[E Entity] struct {
+	dao     Dao[E]
+	parent  string
+	dryRun  bool
+	tx      SQLCmd
+	end     func(error) error
+	pending int
+}
+
+var errDryRun = errors.New("dry run")
+
+// create returns rowErr if the row is rejected, e.g. by constraints, and err if
+// the chunk can't go on.
+func (w *importWriter[Entity]) create(ctx context.Context, e Entity) (name string, rowErr, err error) {
+	if w.tx == nil {
+		if w.tx, w.end, err = BeginTx(ctx, w.dao.DB, nil); err != nil {
+			return
+		}
+	}
+	w.pending++
+
+	if _, err = w.tx.ExecContext(ctx, "savepoint import_row"); err != nil {
+		return
+	}
+	var next Entity
+	if next, rowErr = w.dao.WithDB(w.tx).Create(ctx, w.parent, e); rowErr != nil {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if _, err = w.tx.ExecContext(ctx, "rollback to savepoint import_row"); err != nil {
+			return
+		}
+	} else if !w.dryRun {
+		name = next.GetName()
+	}
+	_, err = w.tx.ExecContext(ctx, "release savepoint import_row")
+	return
+}
+
+// finish commits the chunk, or rolls it back on errors and dry runs.
+func (w *importWriter[Entity]) finish(cause error) (err error) {
+	if w.tx == nil {
+		return cause
+	}
+	end := w.end
+	w.tx, w.end, w.pending = nil, nil, 0
+
+	if cause == nil && w.dryRun {
+		if err = end(errDryRun); err == errDryRun {
+			err = nil
+		}
+		return
+	}
+	return end(cause)
+}
+
+// importViolations reports validation errors by field, others as violations of the row.
+func importViolations(cause error) (violations []errors.FieldViolation) {
+	var (
+		validateErrs validator.ValidationErrors
+		typeErr      *json.UnmarshalTypeError
+	)
+	for _, detail := range errors.Details(cause) {
+		if badRequest, ok := detail.(errors.BadRequest); ok {
+			return badRequest.FieldViolations
+		}
+	}
+
+	switch {
+	case errors.As(cause, &validateErrs):
+		for _, subErr := range validateErrs {
+			violations = append(violations, errors.FieldViolation{
+				Field:       subErr.Field(),
+				Description: subErr.Error(),
+			})
+		}
+	case errors.As(cause, &typeErr) && typeErr.Field != "":
+		violations = []errors.FieldViolation{{Field: typeErr.Field, Description: cause.Error()}}
+	default:
+		violations = []errors.FieldViolation{{Field: "row", Description: cause.Error()}}
+	}
+	return
+}
+
+// decodeRows calls fn with every row of r, rows that can't be decoded are passed
+// with their error, so they're reported rather than failing the whole file.
+func decodeRows[E any](r io.Reader, format string, fn func(row int, e E, err error) error) error {
+	switch format {
+	case ImportCSV:
+		return decodeCSV(r, fn)
+	case ImportNDJSON:
+		return decodeNDJSON(r, fn)
+	}
+	return errors.WithBadRequest(fmt.Errorf("unknown import format %q", format), errors.BadRequest{
+		FieldViolations: []errors.FieldViolation{{Field: "format", Description: "expect csv or ndjson"}},
+	})
+}
+
+func decodeNDJSON[E any](r io.Reader, fn func(row int, e E, err error) error) (err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLine)
+
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var e E
+		if err = fn(line, e, json.Unmarshal(data, &e)); err != nil {
+			return
+		}
+	}
+	return scanner.Err()
+}
+
+// decodeCSV reads a header row of JSON field names, e.g. the one of CSV exports.
+// Cells of string fields are taken as is, except quotes added by EscapeCSVCell, and
+// others as JSON values, e.g. 12.5 or ["a","b"].
+// Unknown columns are ignored, and so are id and name, which aren't writable.
+func decodeCSV[E any](r io.Reader, fn func(row int, e E, err error) error) (err error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	var header []string
+	if header, err = reader.Read(); err != nil {
+		if err == io.EOF {
+			err = nil
+		}
+		return
+	}
+	header = append([]string(nil), header...)
+
+	var zero E
+	fields, err := toFields(zero)
+	if err != nil {
+		return
+	}
+
+	for {
+		record, readErr := reader.Read()
+		if readErr == io.EOF {
+			return
+		}
+
+		var parseErr *csv.ParseError
+		if readErr != nil && !errors.As(readErr, &parseErr) {
+			return readErr
+		}
+
+		var (
+			e    E
+			line int
+		)
+		if parseErr != nil {
+			line = parseErr.Line
+		} else {
+			line, _ = reader.FieldPos(0)
+			var data []byte
+			if data, readErr = csvObject(header, record, fields); readErr == nil {
+				readErr = json.Unmarshal(data, &e)
+			}
+		}
+		if err = fn(line, e, readErr); err != nil {
+			return
+		}
+	}
+}
+
+// csvObject converts a record to a JSON object by the header, cells of non-string
+// fields that aren't valid JSON are reported by column.
+func csvObject(header, record []string, fields map[string]any) (data []byte, err error) {
+	var (
+		buf        bytes.Buffer
+		violations []errors.FieldViolation
+	)
+	buf.WriteByte('{')
+	for i, column := range header {
+		value, ok := fields[column]
+		if !ok || column == "id" || column == "name" || i >= len(record) {
+			continue
+		}
+
+		var cell []byte
+		if _, isString := value.(string); isString {
+			cell, _ = json.Marshal(unescapeCSVCell(record[i]))
+		} else if cell = []byte(strings.TrimSpace(record[i])); len(cell) == 0 {
+			continue
+		} else if !json.Valid(cell) {
+			violations = append(violations, errors.FieldViolation{
+				Field:       column,
+				Description: fmt.Sprintf("invalid value %q", record[i]),
+			})
+			continue
+		}
+
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(column)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(cell)
+	}
+	buf.WriteByte('}')
+
+	if len(violations) > 0 {
+		return nil, errors.WithBadRequest(fmt.Errorf("invalid row: %s", violations[0].Description),
+			errors.BadRequest{FieldViolations: violations})
+	}
+	return buf.Bytes(), nil
+}
+
+// EscapeCSVCell prefixes a quote to cells spreadsheets would run as formulas, e.g.
+// "=HYPERLINK(...)". Cells quoted this way before get another quote, so decodeCSV
+// restores every exported cell.
+func EscapeCSVCell(s string) string {
+	if isFormula(s) {
+		return "'" + s
+	}
+	return s
+}
+
+func unescapeCSVCell(s string) string {
+	if strings.HasPrefix(s, "'") && isFormula(s) {
+		return s[1:]
+	}
+	return s
+}
+
+// isFormula reports whether s starts with a formula trigger after any quotes.
+func isFormula(s string) bool {
+	s = strings.TrimLeft(s, "'")
+	return s != "" && strings.IndexByte("=+-@\t\r", s[0]) >= 0
+}
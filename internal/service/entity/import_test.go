@@ -0,0 +1,211 @@
+package entity
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gota33/errors"
+)
+
+type gadget struct {
+	ID    int64  `json:"id,string"`
+	Name  string `json:"name"`
+	Title string `json:"title" validate:"required"`
+	Num   int64  `json:"num"`
+}
+
+func (e gadget) GetID() string       { return strconv.FormatInt(e.ID, 10) }
+func (e gadget) GetName() string     { return e.Name }
+func (e gadget) InsertValues() []any { return []any{e.Title, e.Num} }
+
+func newGadgetDao(t *testing.T) Dao[gadget] {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err = db.Exec(`
+create table gadget
+(
+    id    integer primary key autoincrement,
+    title text    not null,
+    num   integer not null check (num >= 0)
+);
+create table revision
+(
+    id          integer primary key autoincrement,
+    resource    text not null,
+    operation   text not null,
+    actor       text not null default '',
+    update_mask text not null default '',
+    before_json text null,
+    after_json  text null,
+    create_time timestamp not null default current_timestamp
+);
+create table outbox
+(
+    id          integer primary key autoincrement,
+    type        text not null,
+    resource    text not null,
+    actor       text not null default '',
+    update_mask text not null default '',
+    data        text not null,
+    create_time timestamp not null default current_timestamp
+);`); err != nil {
+		t.Fatal(err)
+	}
+
+	const pattern Pattern = "gadgets/{gadgetID}"
+	return Dao[gadget]{
+		DB:        db,
+		Pattern:   pattern,
+		Table:     "gadget",
+		Keys:      []string{"id"},
+		SqlCreate: "insert into gadget (title, num) values (?, ?)",
+		SqlGet:    "select id, title, num from gadget where id = ? limit 1",
+		SqlList:   "select id, title, num from gadget where id > ?",
+		ScanAllFields: func(row Scanner) (e gadget, err error) {
+			if err = row.Scan(&e.ID, &e.Title, &e.Num); err == nil {
+				e.Name = pattern.Format(e.GetID())
+			}
+			return
+		},
+	}
+}
+
+func TestDaoImportReportsRows(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		data   string
+	}{
+		{"csv", ImportCSV, "title,num,unknown\n" +
+			"a,1,x\n" +
+			",2,x\n" +
+			"b,two,x\n" +
+			"c,-1,x\n" +
+			"'=d,4,x\n"},
+		{"ndjson", ImportNDJSON, `{"title":"a","num":1}` + "\n" +
+			`{"num":2}` + "\n" +
+			`{"title":"b","num":"two"}` + "\n" +
+			`{"title":"c","num":-1}` + "\n" +
+			`{"title":"=d","num":4}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dao := newGadgetDao(t)
+			report, err := dao.Import(context.Background(), "", strings.NewReader(tt.data), tt.format, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Total != 5 || report.Succeeded != 2 || report.Failed != 3 {
+				t.Errorf("got %d total, %d succeeded, %d failed, want 5, 2, 3", report.Total, report.Succeeded, report.Failed)
+			}
+
+			// Rows are numbered by lines, the header of CSV is line 1
+			first := 1
+			if tt.format == ImportCSV {
+				first = 2
+			}
+			wantFields := []string{"", "Title", "num", "row", ""}
+			for i, row := range report.Rows {
+				if row.Row != first+i {
+					t.Errorf("row #%d numbered %d, want %d", i, row.Row, first+i)
+				}
+				var field string
+				if len(row.Violations) > 0 {
+					field = row.Violations[0].Field
+				}
+				if field != wantFields[i] {
+					t.Errorf("row %d violations %+v, want field %q", row.Row, row.Violations, wantFields[i])
+				}
+				if ok := len(row.Violations) == 0; ok != (row.Name != "") {
+					t.Errorf("row %d named %q with violations %+v", row.Row, row.Name, row.Violations)
+				}
+			}
+
+			var titles []string
+			err = dao.Stream(context.Background(), "", filterRequest{}, func(e gadget) error {
+				titles = append(titles, e.Title)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"a", "=d"}; !reflect.DeepEqual(titles, want) {
+				t.Errorf("imported %q, want %q", titles, want)
+			}
+		})
+	}
+}
+
+func TestDaoImportDryRun(t *testing.T) {
+	dao := newGadgetDao(t)
+	data := "title,num\na,1\n,2\n"
+
+	var progress []ImportReport
+	report, err := dao.Import(context.Background(), "", strings.NewReader(data), ImportCSV, true,
+		func(r ImportReport) { progress = append(progress, r) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || report.Succeeded != 1 || report.Failed != 1 || report.Rows[0].Name != "" {
+		t.Errorf("got report %+v, want a dry run of 1 succeeded and 1 failed row without names", report)
+	}
+	if len(progress) != 1 || progress[0].Total != 2 || progress[0].Rows != nil {
+		t.Errorf("got progress %+v, want one summary without rows", progress)
+	}
+
+	var count int
+	if err = dao.DB.QueryRowContext(context.Background(), "select count(*) from gadget").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("dry run left %d gadgets", count)
+	}
+}
+
+func TestImportRequestReadFile(t *testing.T) {
+	upload := func(size int) *multipart.FileHeader {
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		part, _ := w.CreateFormFile("file", "items.csv")
+		_, _ = part.Write(bytes.Repeat([]byte("a"), size))
+		_ = w.Close()
+
+		form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = form.RemoveAll() })
+		return form.File["file"][0]
+	}
+
+	if data, err := (ImportRequestFragment{File: upload(10)}).ReadFile(); err != nil || len(data) != 10 {
+		t.Errorf("read %d bytes, %v, want 10", len(data), err)
+	}
+	if _, err := (ImportRequestFragment{File: upload(MaxImportSize + 1)}).ReadFile(); errors.Code(err) != errors.InvalidArgument {
+		t.Errorf("read a file over the limit: %v, want InvalidArgument", err)
+	}
+}
+
+func TestEscapeCSVCellRoundTrip(t *testing.T) {
+	for _, s := range []string{"plain", "=1+1", "+1", "-1", "@A1", "\t=1", "'=1", "''=1", "'quoted", ""} {
+		if got := unescapeCSVCell(EscapeCSVCell(s)); got != s {
+			t.Errorf("round trip of %q = %q", s, got)
+		}
+	}
+	if got := unescapeCSVCell("'tis"); got != "'tis" {
+		t.Errorf("unescape of %q = %q, want it unchanged", "'tis", got)
+	}
+}
@@ -0,0 +1,39 @@
+package entity
+
+import (
+	"context"
+	"time"
+
+	"github.com/gota33/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"server/internal/service/trace"
+)
+
+var daoDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "dao_operation_duration_seconds",
+	Help:    "Latency of Dao operations by resource type, operation and error code.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"resource", "operation", "code"})
+
+// start traces a Dao operation and observes its latency when the returned func is called,
+// e.g. `defer func() { end(err) }()`.
+func (d Dao[Entity]) start(ctx context.Context, op string) (context.Context, func(error)) {
+	var (
+		resource  = d.Pattern.Collection()
+		startTime = time.Now()
+	)
+	ctx, span := trace.Start(ctx, resource+"."+op)
+
+	return ctx, func(err error) {
+		trace.End(span, err)
+
+		code := errors.OK
+		if err != nil {
+			code = errors.Code(err)
+		}
+		daoDuration.
+			WithLabelValues(resource, op, string(code.Name())).
+			Observe(time.Since(startTime).Seconds())
+	}
+}
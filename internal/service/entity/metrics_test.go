@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestDaoObserve(t *testing.T) {
+	var (
+		dao = newThingDao(t)
+		ctx = context.Background()
+	)
+	observed := func(op, code string) uint64 {
+		var m dto.Metric
+		if err := daoDuration.WithLabelValues("things", op, code).(prometheus.Metric).Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetHistogram().GetSampleCount()
+	}
+	var (
+		creates = observed("create", "OK")
+		gets    = observed("get", "OK")
+		missing = observed("get", "NOT_FOUND")
+	)
+
+	created, err := dao.Create(ctx, "", thing{Title: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dao.Get(ctx, created.Name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dao.Get(ctx, "things/404"); err == nil {
+		t.Fatal("got a missing thing")
+	}
+
+	if n := observed("create", "OK") - creates; n != 1 {
+		t.Errorf("creates observed %d times, want 1", n)
+	}
+	// Create gets what it inserted
+	if n := observed("get", "OK") - gets; n != 2 {
+		t.Errorf("gets observed %d times, want 2", n)
+	}
+	if n := observed("get", "NOT_FOUND") - missing; n != 1 {
+		t.Errorf("gets of missing things observed %d times, want 1", n)
+	}
+}
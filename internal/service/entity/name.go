@@ -0,0 +1,117 @@
+package entity
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gota33/errors"
+)
+
+// Pattern is a resource name template in AIP-122 style,
+// e.g. "customers/{customerID}/carts/{cartID}".
+type Pattern string
+
+func (p Pattern) segments() []string {
+	return strings.Split(string(p), "/")
+}
+
+func isVar(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// Vars returns variable names in order, e.g. ["customerID", "cartID"].
+func (p Pattern) Vars() (vars []string) {
+	for _, segment := range p.segments() {
+		if isVar(segment) {
+			vars = append(vars, segment[1:len(segment)-1])
+		}
+	}
+	return
+}
+
+// Collection returns the last collection identifier, e.g. "carts".
+func (p Pattern) Collection() string {
+	segments := p.segments()
+	if size := len(segments); size > 1 {
+		return segments[size-2]
+	}
+	return string(p)
+}
+
+// Parent returns the pattern of parent resource, empty for top level resources.
+func (p Pattern) Parent() Pattern {
+	segments := p.segments()
+	if size := len(segments); size > 2 {
+		return Pattern(strings.Join(segments[:size-2], "/"))
+	}
+	return ""
+}
+
+// Route converts pattern to fiber route, e.g. "customers/:customerID/carts/:cartID".
+func (p Pattern) Route() string {
+	segments := p.segments()
+	for i, segment := range segments {
+		if isVar(segment) {
+			segments[i] = ":" + segment[1:len(segment)-1]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// CollectionRoute returns the route of collection, e.g. "customers/:customerID/carts".
+func (p Pattern) CollectionRoute() string {
+	if parent := p.Parent(); parent != "" {
+		return parent.Route() + "/" + p.Collection()
+	}
+	return p.Collection()
+}
+
+func (p Pattern) Format(ids ...string) string {
+	var (
+		segments = p.segments()
+		i        int
+	)
+	for j, segment := range segments {
+		if isVar(segment) && i < len(ids) {
+			segments[j] = ids[i]
+			i++
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func (p Pattern) Parse(name string) (ids []string, err error) {
+	return p.ParseField("name", name)
+}
+
+// ParseField parses a resource name carried by the given request field,
+// e.g. a reference to another resource.
+func (p Pattern) ParseField(field, name string) (ids []string, err error) {
+	var (
+		segments = p.segments()
+		parts    = strings.Split(name, "/")
+	)
+	if len(segments) != len(parts) {
+		return nil, p.invalid(field, name)
+	}
+
+	for i, segment := range segments {
+		switch {
+		case isVar(segment) && parts[i] != "":
+			ids = append(ids, parts[i])
+		case segment != parts[i]:
+			return nil, p.invalid(field, name)
+		}
+	}
+	return
+}
+
+func (p Pattern) invalid(field, name string) error {
+	cause := fmt.Errorf("invalid resource name %q, expect %q", name, p)
+	return errors.WithBadRequest(cause, errors.BadRequest{
+		FieldViolations: []errors.FieldViolation{{
+			Field:       field,
+			Description: cause.Error(),
+		}},
+	})
+}
@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPattern(t *testing.T) {
+	const p Pattern = "customers/{customerID}/carts/{cartID}"
+
+	if vars := p.Vars(); !reflect.DeepEqual(vars, []string{"customerID", "cartID"}) {
+		t.Errorf("Vars() = %v", vars)
+	}
+	if got := p.Collection(); got != "carts" {
+		t.Errorf("Collection() = %q", got)
+	}
+	if got := p.Parent(); got != "customers/{customerID}" {
+		t.Errorf("Parent() = %q", got)
+	}
+	if got := p.Parent().Parent(); got != "" {
+		t.Errorf("Parent() of top level = %q", got)
+	}
+	if got := p.Route(); got != "customers/:customerID/carts/:cartID" {
+		t.Errorf("Route() = %q", got)
+	}
+	if got := p.CollectionRoute(); got != "customers/:customerID/carts" {
+		t.Errorf("CollectionRoute() = %q", got)
+	}
+	if got := p.Parent().CollectionRoute(); got != "customers" {
+		t.Errorf("CollectionRoute() of top level = %q", got)
+	}
+	if got := p.Format("5", "9"); got != "customers/5/carts/9" {
+		t.Errorf("Format() = %q", got)
+	}
+}
+
+func TestPatternParse(t *testing.T) {
+	const p Pattern = "customers/{customerID}/carts/{cartID}"
+
+	ids, err := p.Parse("customers/5/carts/9")
+	if err != nil || !reflect.DeepEqual(ids, []string{"5", "9"}) {
+		t.Errorf("Parse() = %v, %v", ids, err)
+	}
+
+	for _, name := range []string{"", "customers/5", "customers/5/carts/", "items/5/carts/9", "customers/5/carts/9/x"} {
+		if _, err = p.ParseField("cart", name); !violates(err, "cart") {
+			t.Errorf("ParseField(%q) = %v, want a violation of cart", name, err)
+		}
+	}
+}
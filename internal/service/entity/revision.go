@@ -0,0 +1,310 @@
+package entity
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gota33/errors"
+	"server/internal/service/auth"
+)
+
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+const revisionFields = "id, resource, operation, actor, update_mask, before_json, after_json, create_time"
+
+// Revision is an audit row written by Dao in the same transaction as the change,
+// Before and After only contain fields that changed.
+type Revision struct {
+	ID         int64           `json:"id,string"`
+	Name       string          `json:"name"`
+	Resource   string          `json:"resource"`
+	Operation  string          `json:"operation"`
+	Actor      string          `json:"actor,omitempty"`
+	UpdateMask FieldMask       `json:"updateMask"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	CreateTime time.Time       `json:"createTime"`
+}
+
+func (r Revision) GetID() string {
+	return strconv.FormatInt(r.ID, 10)
+}
+
+func (r Revision) GetName() string {
+	return r.Name
+}
+
+func (r Revision) InsertValues() []any {
+	return []any{
+		r.Resource,
+		r.Operation,
+		r.Actor,
+		strings.Join(r.UpdateMask.Paths, ","),
+		nullJSON(r.Before),
+		nullJSON(r.After),
+	}
+}
+
+func revisionName(resource, id string) string {
+	return resource + "/revisions/" + id
+}
+
+func scanRevision(row Scanner) (r Revision, err error) {
+	var (
+		mask          string
+		before, after sql.NullString
+	)
+	if err = row.Scan(&r.ID, &r.Resource, &r.Operation, &r.Actor,
+		&mask, &before, &after, &r.CreateTime); err != nil {
+		return
+	}
+	r.Name = revisionName(r.Resource, r.GetID())
+	if mask != "" {
+		r.UpdateMask.Paths = strings.Split(mask, ",")
+	}
+	if before.Valid {
+		r.Before = json.RawMessage(before.String)
+	}
+	if after.Valid {
+		r.After = json.RawMessage(after.String)
+	}
+	return
+}
+
+func writeRevision(ctx context.Context, tx SQLCmd, name, op string, mask FieldMask, before, after any) (err error) {
+	rev := Revision{
+		Resource:   name,
+		Operation:  op,
+		UpdateMask: mask,
+	}
+
+	var user auth.User
+	if user.FromContext(ctx) == nil {
+		rev.Actor = user.Subject
+	}
+
+	var mBefore, mAfter map[string]any
+	if mBefore, mAfter, err = diff(before, after); err != nil {
+		return
+	}
+	if rev.Before, err = marshalFields(mBefore); err != nil {
+		return
+	}
+	if rev.After, err = marshalFields(mAfter); err != nil {
+		return
+	}
+
+	const script = "insert into revision (resource, operation, actor, update_mask, before_json, after_json) values (?, ?, ?, ?, ?, ?)"
+	_, err = tx.ExecContext(ctx, script, rev.InsertValues()...)
+	return
+}
+
+func (d Dao[Entity]) ListRevisions(ctx context.Context, name string, req ListRequest) (res ListResponse[Revision], err error) {
+	ctx, end := d.start(ctx, "listRevisions")
+	defer func() { end(err) }()
+
+	if _, err = d.Pattern.Parse(name); err != nil {
+		return
+	}
+
+	const script = "select " + revisionFields + " from revision where resource = ? and id > ? order by id limit ?"
+
+	var rows *sql.Rows
+	if rows, err = Traced(d.DB).QueryContext(ctx, script, name, req.GetPageToken(), req.GetPageSize()); err != nil {
+		return
+	}
+
+	defer CloseRows(rows)
+
+	for rows.Next() {
+		var r Revision
+		if r, err = scanRevision(rows); err != nil {
+			return
+		}
+		res.Items = append(res.Items, r)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	if size := len(res.Items); size == req.GetPageSize() {
+		res.NextPageToken = res.Items[size-1].GetID()
+	}
+	return
+}
+
+// Restore brings the resource back to the state right after the given revision,
+// by reverting every later change. The restore itself is recorded as an update.
+func (d Dao[Entity]) Restore(ctx context.Context, name string, revisionID string) (res Entity, err error) {
+	ctx, end := d.start(ctx, "restore")
+	defer func() { end(err) }()
+
+	if _, err = d.Pattern.Parse(name); err != nil {
+		return
+	}
+
+	var (
+		tx     SQLCmd
+		finish func(error) error
+	)
+	if tx, finish, err = BeginTx(ctx, d.DB, nil); err != nil {
+		return
+	}
+	defer func() { err = finish(err) }()
+
+	var (
+		rev     Revision
+		revName = revisionName(name, revisionID)
+		script  = "select " + revisionFields + " from revision where resource = ? and id = ? limit 1"
+	)
+	if rev, err = scanRevision(tx.QueryRowContext(ctx, script, name, revisionID)); err != nil {
+		return res, errors.WithNotFound(err, errors.ResourceInfo{
+			ResourceType: "revisions",
+			ResourceName: revName,
+		})
+	}
+	if rev.Operation == OperationDelete {
+		return res, errors.WithFailedPrecondition(fmt.Errorf("revision %q deleted the resource", revName),
+			errors.PreconditionFailure{Violations: []errors.TypedViolation{{
+				Type:        "REVISION",
+				Subject:     revName,
+				Description: "can't restore to a deleted state",
+			}}})
+	}
+
+	sub := d.WithDB(tx)
+
+	var current Entity
+	if current, err = sub.Get(ctx, name); err != nil {
+		return
+	}
+
+	var state, fields map[string]any
+	if state, err = toFields(current); err != nil {
+		return
+	}
+	if fields, err = toFields(current); err != nil {
+		return
+	}
+	if err = revertAfter(ctx, tx, name, rev.ID, state); err != nil {
+		return
+	}
+
+	var paths []string
+	for key, value := range state {
+		if !d.updatable(key) {
+			continue
+		}
+		if !reflect.DeepEqual(value, fields[key]) {
+			paths = append(paths, key)
+		}
+	}
+	if len(paths) == 0 {
+		return current, nil
+	}
+	sort.Strings(paths)
+
+	var data []byte
+	if data, err = json.Marshal(state); err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return
+	}
+
+	return sub.Update(ctx, UpdateRequest[Entity]{
+		UpdateRequestFragment: UpdateRequestFragment{UpdateMask: FieldMask{Paths: paths}},
+		Name:                  name,
+		Entity:                res,
+	})
+}
+
+// revertAfter applies "before" values of revisions newer than id, newest first.
+func revertAfter(ctx context.Context, tx SQLCmd, name string, id int64, state map[string]any) (err error) {
+	const script = "select before_json from revision where resource = ? and id > ? order by id desc"
+
+	var rows *sql.Rows
+	if rows, err = tx.QueryContext(ctx, script, name, id); err != nil {
+		return
+	}
+
+	defer CloseRows(rows)
+
+	for rows.Next() {
+		var (
+			raw    sql.NullString
+			before map[string]any
+		)
+		if err = rows.Scan(&raw); err != nil {
+			return
+		}
+		if !raw.Valid {
+			continue
+		}
+		if err = json.Unmarshal([]byte(raw.String), &before); err != nil {
+			return
+		}
+		for key, value := range before {
+			state[key] = value
+		}
+	}
+	return rows.Err()
+}
+
+func diff(before, after any) (mBefore, mAfter map[string]any, err error) {
+	if mBefore, err = toFields(before); err != nil {
+		return
+	}
+	if mAfter, err = toFields(after); err != nil {
+		return
+	}
+	if mBefore == nil || mAfter == nil {
+		return
+	}
+
+	for key, value := range mBefore {
+		if reflect.DeepEqual(value, mAfter[key]) {
+			delete(mBefore, key)
+			delete(mAfter, key)
+		}
+	}
+	return
+}
+
+func toFields(e any) (m map[string]any, err error) {
+	if e == nil {
+		return
+	}
+
+	var data []byte
+	if data, err = json.Marshal(e); err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &m)
+	return
+}
+
+func marshalFields(m map[string]any) (raw json.RawMessage, err error) {
+	if m == nil {
+		return
+	}
+	return json.Marshal(m)
+}
+
+func nullJSON(raw json.RawMessage) any {
+	if raw == nil {
+		return nil
+	}
+	return string(raw)
+}
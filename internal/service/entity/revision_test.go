@@ -0,0 +1,94 @@
+package entity
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/gota33/errors"
+	"server/internal/service/auth"
+)
+
+func TestDaoRevisions(t *testing.T) {
+	var (
+		dao  = newThingDao(t)
+		user = auth.User{}
+	)
+	user.Subject = "alice"
+	ctx := user.WithContext(context.Background())
+
+	created, err := dao.Create(ctx, "", thing{Title: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"b", "c"} {
+		if _, err = dao.Update(ctx, UpdateRequest[thing]{
+			UpdateRequestFragment: UpdateRequestFragment{UpdateMask: FieldMask{Paths: []string{"title"}}},
+			Name:                  created.Name,
+			Entity:                thing{Title: title},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := dao.ListRevisions(ctx, created.Name, ListRequestFragment{})
+	if err != nil || len(list.Items) != 3 {
+		t.Fatalf("revisions = %+v, %v, want 3", list, err)
+	}
+	first, update := list.Items[0], list.Items[1]
+	if first.Operation != OperationCreate || first.Before != nil || first.Actor != "alice" {
+		t.Errorf("revision of create = %+v", first)
+	}
+	if update.Operation != OperationUpdate || update.Name != created.Name+"/revisions/"+update.GetID() ||
+		len(update.UpdateMask.Paths) != 1 || update.UpdateMask.Paths[0] != "title" {
+		t.Errorf("revision of update = %+v", update)
+	}
+	// only fields that changed are recorded
+	var before, after map[string]any
+	if err = json.Unmarshal(update.Before, &before); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(update.After, &after); err != nil {
+		t.Fatal(err)
+	}
+	if len(before) != 1 || before["title"] != "a" || len(after) != 1 || after["title"] != "b" {
+		t.Errorf("diff of update = %s -> %s, want title a -> b", update.Before, update.After)
+	}
+
+	restored, err := dao.Restore(ctx, created.Name, update.GetID())
+	if err != nil || restored.Title != "b" {
+		t.Fatalf("restore = %+v, %v, want title b", restored, err)
+	}
+	if list, err = dao.ListRevisions(ctx, created.Name, ListRequestFragment{}); err != nil || len(list.Items) != 4 {
+		t.Fatalf("revisions after restore = %+v, %v, want 4", list, err)
+	}
+	if last := list.Items[3]; last.Operation != OperationUpdate {
+		t.Errorf("revision of restore = %+v, want an update", last)
+	}
+
+	if _, err = dao.Restore(ctx, created.Name, "404"); errors.Code(err) != errors.NotFound {
+		t.Errorf("restore to a missing revision: got %v, want NotFound", err)
+	}
+}
+
+func TestDaoRestoreDeleted(t *testing.T) {
+	var (
+		dao = newThingDao(t)
+		ctx = context.Background()
+	)
+	created, err := dao.Create(ctx, "", thing{Title: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dao.Delete(ctx, created.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := dao.ListRevisions(ctx, created.Name, ListRequestFragment{})
+	if err != nil || len(list.Items) != 2 || list.Items[1].Operation != OperationDelete || list.Items[1].After != nil {
+		t.Fatalf("revisions = %+v, %v, want create and delete", list, err)
+	}
+	if _, err = dao.Restore(ctx, created.Name, list.Items[1].GetID()); errors.Code(err) != errors.FailedPrecondition {
+		t.Errorf("restore to a delete: got %v, want FailedPrecondition", err)
+	}
+}
@@ -0,0 +1,208 @@
+package event
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"server/internal/service/entity"
+	"server/internal/service/trace"
+)
+
+const (
+	statusDelivered = "delivered"
+	statusDead      = "dead"
+	eventFields     = "id, type, resource, actor, update_mask, data, create_time"
+
+	// claimTimeout bounds the delivery of an event to all sinks, e.g. webhooks timing out
+	claimTimeout = 5 * time.Minute
+)
+
+// Dispatcher polls outbox and delivers pending events to every sink.
+// Delivery is at-least-once: a failed event is retried with exponential backoff
+// against sinks that failed, until MaxAttempts is reached and it's marked dead.
+// Replicas claim events before delivering, so each is delivered by one of them.
+type Dispatcher struct {
+	DB          *sql.DB
+	Sinks       []Sink
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+	MaxBackoff  time.Duration
+}
+
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.dispatch(ctx); err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Warn("Dispatch events error")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context) (err error) {
+	var events []entity.Event
+	if events, err = d.pending(ctx); err != nil {
+		return
+	}
+
+	for _, e := range events {
+		var claimed bool
+		if claimed, err = d.claim(ctx, e); err != nil {
+			return
+		}
+		if !claimed {
+			continue
+		}
+		if err = d.deliver(ctx, e); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (d *Dispatcher) pending(ctx context.Context) (events []entity.Event, err error) {
+	const script = "select " + eventFields + " from outbox where status = 'pending' and next_time <= ? order by id limit ?"
+
+	var rows *sql.Rows
+	if rows, err = d.DB.QueryContext(ctx, script, time.Now().UTC(), d.BatchSize); err != nil {
+		return
+	}
+
+	defer entity.CloseRows(rows)
+
+	for rows.Next() {
+		var e entity.Event
+		if e, err = entity.ScanEvent(rows); err != nil {
+			return
+		}
+		events = append(events, e)
+	}
+	err = rows.Err()
+	return
+}
+
+// claim postpones the event by claimTimeout, so other replicas polling the outbox skip it
+// while it's delivered. Events of a replica crashing while delivering are retried after that.
+func (d *Dispatcher) claim(ctx context.Context, e entity.Event) (claimed bool, err error) {
+	const script = "update outbox set next_time = ? where id = ? and status = 'pending' and next_time <= ?"
+
+	var (
+		now = time.Now().UTC()
+		sr  sql.Result
+		num int64
+	)
+	if sr, err = d.DB.ExecContext(ctx, script, now.Add(claimTimeout), e.ID, now); err != nil {
+		return
+	}
+	num, err = sr.RowsAffected()
+	return num > 0, err
+}
+
+// deliver sends the event to sinks it wasn't delivered to yet, sinks succeeded are
+// recorded in outbox_sink, so a retry doesn't duplicate their deliveries.
+func (d *Dispatcher) deliver(ctx context.Context, e entity.Event) (err error) {
+	ctx, span := trace.Start(ctx, "event.deliver")
+	defer func() { trace.End(span, err) }()
+
+	var delivered map[string]bool
+	if delivered, err = d.delivered(ctx, e.ID); err != nil {
+		return
+	}
+
+	var cause error
+	for _, sink := range d.Sinks {
+		name := sink.Name()
+		if delivered[name] {
+			continue
+		}
+		if sinkErr := sink.Deliver(ctx, e); sinkErr != nil {
+			span.RecordError(sinkErr)
+			if cause == nil {
+				cause = fmt.Errorf("%s: %w", name, sinkErr)
+			}
+			continue
+		}
+		if _, err = d.DB.ExecContext(ctx, "insert into outbox_sink (event_id, sink) values (?, ?)", e.ID, name); err != nil {
+			return
+		}
+	}
+
+	if cause == nil {
+		if _, err = d.DB.ExecContext(ctx,
+			"update outbox set status = ?, attempts = attempts + 1, last_error = '' where id = ?",
+			statusDelivered, e.ID); err != nil {
+			return
+		}
+		return d.forget(ctx, e.ID)
+	}
+
+	var attempts int
+	if err = d.DB.QueryRowContext(ctx, "select attempts + 1 from outbox where id = ?", e.ID).Scan(&attempts); err != nil {
+		return
+	}
+
+	log := trace.Logger(ctx).WithError(cause).WithField("event", e.ID)
+	if attempts >= d.MaxAttempts {
+		log.Error("Event dead after max attempts")
+		if _, err = d.DB.ExecContext(ctx,
+			"update outbox set status = ?, attempts = ?, last_error = ? where id = ?",
+			statusDead, attempts, cause.Error(), e.ID); err != nil {
+			return
+		}
+		return d.forget(ctx, e.ID)
+	}
+
+	log.Warn("Deliver event error, will retry")
+	_, err = d.DB.ExecContext(ctx,
+		"update outbox set attempts = ?, last_error = ?, next_time = ? where id = ?",
+		attempts, cause.Error(), time.Now().UTC().Add(d.backoff(attempts)), e.ID)
+	return
+}
+
+func (d *Dispatcher) delivered(ctx context.Context, id int64) (sinks map[string]bool, err error) {
+	var rows *sql.Rows
+	if rows, err = d.DB.QueryContext(ctx, "select sink from outbox_sink where event_id = ?", id); err != nil {
+		return
+	}
+
+	defer entity.CloseRows(rows)
+
+	sinks = make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return
+		}
+		sinks[name] = true
+	}
+	err = rows.Err()
+	return
+}
+
+// forget drops records of sinks once the event is done.
+func (d *Dispatcher) forget(ctx context.Context, id int64) (err error) {
+	_, err = d.DB.ExecContext(ctx, "delete from outbox_sink where event_id = ?", id)
+	return
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.Interval
+	for i := 1; i < attempts && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxBackoff {
+		delay = d.MaxBackoff
+	}
+	return delay
+}
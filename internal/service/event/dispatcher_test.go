@@ -0,0 +1,131 @@
+package event
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"server/internal/service/entity"
+)
+
+const schema = `
+create table outbox
+(
+    id          integer primary key autoincrement,
+    type        text      not null,
+    resource    text      not null,
+    actor       text      not null default '',
+    update_mask text      not null default '',
+    data        text      not null,
+    status      text      not null default 'pending',
+    attempts    integer   not null default 0,
+    last_error  text      not null default '',
+    next_time   timestamp not null default current_timestamp,
+    create_time timestamp not null default current_timestamp
+);
+create table outbox_sink
+(
+    event_id integer not null,
+    sink     text    not null,
+    primary key (event_id, sink)
+);`
+
+type countSink struct {
+	name  string
+	fails int
+	calls int
+}
+
+func (s *countSink) Name() string { return s.name }
+
+func (s *countSink) Deliver(context.Context, entity.Event) error {
+	s.calls++
+	if s.calls <= s.fails {
+		return errors.New("unavailable")
+	}
+	return nil
+}
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err = db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("insert into outbox (type, resource, data) values ('item.created', 'items/1', '{}')"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestDispatcherRetriesFailedSinksOnly(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		db    = openDB(t)
+		ok    = &countSink{name: "ok"}
+		flaky = &countSink{name: "flaky", fails: 1}
+		d     = &Dispatcher{DB: db, Sinks: []Sink{ok, flaky}, Interval: time.Millisecond,
+			MaxBackoff: time.Millisecond, BatchSize: 10, MaxAttempts: 3}
+	)
+
+	if err := d.dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := d.dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok.calls != 1 {
+		t.Errorf("sink ok delivered %d times, want 1", ok.calls)
+	}
+	if flaky.calls != 2 {
+		t.Errorf("sink flaky delivered %d times, want 2", flaky.calls)
+	}
+
+	var status string
+	var sinks int
+	if err := db.QueryRow("select status, (select count(*) from outbox_sink) from outbox").Scan(&status, &sinks); err != nil {
+		t.Fatal(err)
+	}
+	if status != statusDelivered || sinks != 0 {
+		t.Errorf("got status %q with %d sink records, want %q without records", status, sinks, statusDelivered)
+	}
+}
+
+func TestDispatcherClaim(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = openDB(t)
+		d   = &Dispatcher{DB: db, BatchSize: 10}
+	)
+
+	events, err := d.pending(ctx)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("pending = %v, %v, want 1 event", events, err)
+	}
+
+	for i, want := range []bool{true, false} {
+		claimed, claimErr := d.claim(ctx, events[0])
+		if claimErr != nil {
+			t.Fatal(claimErr)
+		}
+		if claimed != want {
+			t.Errorf("claim #%d = %v, want %v", i+1, claimed, want)
+		}
+	}
+
+	if events, err = d.pending(ctx); err != nil || len(events) != 0 {
+		t.Errorf("pending after claim = %v, %v, want none", events, err)
+	}
+}
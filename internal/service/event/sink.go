@@ -0,0 +1,128 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/gota33/errors"
+	"server/internal/service/entity"
+)
+
+// Sink receives events of the outbox. Name identifies the sink in delivery records,
+// so an event failed by one sink isn't redelivered to others.
+type Sink interface {
+	Name() string
+	Deliver(ctx context.Context, e entity.Event) error
+}
+
+type Handler func(ctx context.Context, e entity.Event) error
+
+// Bus delivers events to in-process subscribers.
+type Bus struct {
+	mu   sync.RWMutex
+	next int
+	subs map[int]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[int]Handler)}
+}
+
+func (b *Bus) Subscribe(h Handler) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.next
+	b.next++
+	b.subs[id] = h
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs, id)
+	}
+}
+
+func (b *Bus) Name() string {
+	return "bus"
+}
+
+func (b *Bus) Deliver(ctx context.Context, e entity.Event) (err error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, h := range b.subs {
+		if subErr := h(ctx, e); subErr != nil && err == nil {
+			err = subErr
+		}
+	}
+	return
+}
+
+// Webhook posts each event as JSON, non-2xx responses are decoded as errors.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhook(url string) Webhook {
+	return Webhook{
+		URL:    url,
+		Client: &http.Client{Transport: &errors.RoundTripper{}},
+	}
+}
+
+func (w Webhook) Name() string {
+	return "webhook " + w.URL
+}
+
+func (w Webhook) Deliver(ctx context.Context, e entity.Event) (err error) {
+	var (
+		data []byte
+		req  *http.Request
+		resp *http.Response
+	)
+	if data, err = json.Marshal(e); err != nil {
+		return
+	}
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(data)); err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if resp, err = w.Client.Do(req); err != nil {
+		return
+	}
+	return resp.Body.Close()
+}
+
+// File appends each event as a line of NDJSON.
+type File struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (f *File) Name() string {
+	return "file " + f.Path
+}
+
+func (f *File) Deliver(_ context.Context, e entity.Event) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var file *os.File
+	if file, err = os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644); err != nil {
+		return
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	return json.NewEncoder(file).Encode(e)
+}
@@ -0,0 +1,144 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/gota33/errors"
+)
+
+// MaxKeyLength bounds keys chosen by clients, e.g. UUIDs.
+const MaxKeyLength = 255
+
+var (
+	errInProgress = errors.New("request with the idempotency key is in progress")
+	errMismatch   = errors.New("idempotency key is reused with another request")
+)
+
+// Key scopes keys of clients to their actor, so responses are only replayed to their owners.
+type Key struct {
+	Actor string
+	Key   string
+}
+
+// Response is stored for the key and replayed on retries.
+type Response struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// Fingerprint identifies a request by its method, URL and body.
+func Fingerprint(method, url string, body []byte) string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s %s\n", method, url)
+	_, _ = h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Store keeps responses of requests by key in the idempotency table. A key is claimed by
+// the first request, which saves its response or releases the key if it failed.
+// Claims of requests never finishing, e.g. on crashes, expire after LockTTL.
+type Store struct {
+	DB *sql.DB
+	// TTL keeps responses for retries, expired keys may be reused.
+	TTL     time.Duration
+	LockTTL time.Duration
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{DB: db, TTL: 24 * time.Hour, LockTTL: time.Minute}
+}
+
+// Claim claims the key for the request, or returns the response saved for it.
+// A request with the key in progress fails with Aborted, another request reusing
+// the key fails with InvalidArgument.
+func (s *Store) Claim(ctx context.Context, key Key, fingerprint string) (saved *Response, err error) {
+	t := now()
+
+	const insert = "insert into idempotency (actor, idempotency_key, fingerprint, expire_time) values (?, ?, ?, ?)"
+	_, insertErr := s.DB.ExecContext(ctx, insert, key.Actor, key.Key, fingerprint, t.Add(s.LockTTL))
+	if insertErr == nil {
+		return
+	}
+
+	var (
+		prevFingerprint string
+		status          sql.NullInt64
+		res             Response
+		expire          time.Time
+	)
+	const query = "select fingerprint, status, content_type, body, expire_time from idempotency " +
+		"where actor = ? and idempotency_key = ? limit 1"
+	if err = s.DB.QueryRowContext(ctx, query, key.Actor, key.Key).
+		Scan(&prevFingerprint, &status, &res.ContentType, &res.Body, &expire); err != nil {
+		if err == sql.ErrNoRows {
+			err = insertErr
+		}
+		return
+	}
+
+	switch {
+	case expire.Before(t):
+		return nil, s.reclaim(ctx, key, fingerprint, expire)
+	case prevFingerprint != fingerprint:
+		return nil, errors.WithBadRequest(errMismatch, errors.BadRequest{
+			FieldViolations: []errors.FieldViolation{{Field: "Idempotency-Key", Description: errMismatch.Error()}},
+		})
+	case !status.Valid:
+		return nil, inProgress()
+	default:
+		res.Status = int(status.Int64)
+		return &res, nil
+	}
+}
+
+// reclaim takes an expired key over, unless another request did so first.
+func (s *Store) reclaim(ctx context.Context, key Key, fingerprint string, expire time.Time) (err error) {
+	const script = "update idempotency set fingerprint = ?, status = null, content_type = '', body = null, " +
+		"create_time = ?, expire_time = ? where actor = ? and idempotency_key = ? and expire_time = ?"
+
+	t := now()
+	var sr sql.Result
+	if sr, err = s.DB.ExecContext(ctx, script, fingerprint, t, t.Add(s.LockTTL), key.Actor, key.Key, expire); err != nil {
+		return
+	}
+	if num, _ := sr.RowsAffected(); num == 0 {
+		return inProgress()
+	}
+	return
+}
+
+// Save stores the response of the claimed key until TTL.
+func (s *Store) Save(ctx context.Context, key Key, res Response) (err error) {
+	const script = "update idempotency set status = ?, content_type = ?, body = ?, expire_time = ? " +
+		"where actor = ? and idempotency_key = ?"
+	_, err = s.DB.ExecContext(ctx, script, res.Status, res.ContentType, res.Body, now().Add(s.TTL), key.Actor, key.Key)
+	return
+}
+
+// Release deletes the claim of a failed request, so it may be retried by the key.
+func (s *Store) Release(ctx context.Context, key Key) (err error) {
+	const script = "delete from idempotency where actor = ? and idempotency_key = ? and status is null"
+	_, err = s.DB.ExecContext(ctx, script, key.Actor, key.Key)
+	return
+}
+
+// Purge deletes expired keys, it's run as the job "idempotency.purge".
+func (s *Store) Purge(ctx context.Context) (err error) {
+	_, err = s.DB.ExecContext(ctx, "delete from idempotency where expire_time < ?", now())
+	return
+}
+
+func inProgress() error {
+	return errors.WithAborted(errInProgress, errors.ErrorInfo{Reason: "IDEMPOTENCY_KEY_IN_USE"})
+}
+
+// now is truncated to seconds, so expire times read back compare equal when reclaiming.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
@@ -8,8 +8,11 @@ import (
 	"server/internal/service/entity"
 )
 
+const Pattern entity.Pattern = "items/{itemID}"
+
 type Entity struct {
 	ID         int64     `json:"id,string"`
+	Name       string    `json:"name"`
 	Title      string    `json:"title" validate:"required"`
 	Price      float64   `json:"price" validate:"required,min=0"`
 	Num        int64     `json:"num" validate:"required,min=0"`
@@ -20,6 +23,10 @@ func (e Entity) GetID() string {
 	return strconv.FormatInt(e.ID, 10)
 }
 
+func (e Entity) GetName() string {
+	return e.Name
+}
+
 func (e Entity) InsertValues() []any {
 	return []any{e.Title, e.Price, e.Num}
 }
@@ -27,15 +34,19 @@ func (e Entity) InsertValues() []any {
 func newDao(db *sql.DB) entity.Dao[Entity] {
 	const allFields = "id, title, price, num, create_time"
 	return entity.Dao[Entity]{
-		DB:           db,
-		ResourceType: "items",
-		Table:        "item",
-		SqlCreate:    "insert into item (title, price, num) values (?, ?, ?)",
-		SqlGet:       "select " + allFields + " from item where id = ? limit 1",
-		SqlList:      "select " + allFields + " from item where id > ? limit ?",
-		SqlDelete:    "delete from item where id = ?",
+		DB:        db,
+		Pattern:   Pattern,
+		Table:     "item",
+		Keys:      []string{"id"},
+		Updatable: []string{"title", "price", "num"},
+		SqlCreate: "insert into item (title, price, num) values (?, ?, ?)",
+		SqlGet:    "select " + allFields + " from item where id = ? limit 1",
+		SqlList:   "select " + allFields + " from item where id > ?",
+		SqlDelete: "delete from item where id = ?",
 		ScanAllFields: func(row entity.Scanner) (e Entity, err error) {
-			err = row.Scan(&e.ID, &e.Title, &e.Price, &e.Num, &e.CreateTime)
+			if err = row.Scan(&e.ID, &e.Title, &e.Price, &e.Num, &e.CreateTime); err == nil {
+				e.Name = Pattern.Format(e.GetID())
+			}
 			return
 		},
 	}
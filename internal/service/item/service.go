@@ -1,19 +1,38 @@
 package item
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"io"
 	"net/http"
 
 	"server/internal/service/entity"
+	"server/internal/service/operation"
+)
+
+const (
+	// importSyncSize is the largest file imported while the request waits,
+	// larger ones are imported in the background.
+	importSyncSize = 1 << 20
+	typeImport     = "item.import"
 )
 
 type Service struct {
-	dao entity.Dao[Entity]
+	dao        entity.Dao[Entity]
+	operations *operation.Runner
+}
+
+func New(db *sql.DB, operations *operation.Runner) Service {
+	srv := Service{dao: newDao(db), operations: operations}
+	if operations != nil {
+		operation.Register(operations, typeImport, srv.runImport)
+	}
+	return srv
 }
 
-func New(db *sql.DB) Service {
-	return Service{dao: newDao(db)}
+func (srv Service) Check(ctx context.Context) error {
+	return srv.dao.Check(ctx)
 }
 
 type GetRequest struct {
@@ -21,11 +40,11 @@ type GetRequest struct {
 }
 
 func (srv Service) Get(ctx context.Context, req GetRequest) (res Entity, err error) {
-	return srv.dao.Get(ctx, req.ItemID)
+	return srv.dao.Get(ctx, Pattern.Format(req.ItemID))
 }
 
 func (srv Service) Create(ctx context.Context, entity Entity) (res Entity, err error) {
-	return srv.dao.Create(ctx, entity)
+	return srv.dao.Create(ctx, "", entity)
 }
 
 type ListRequest struct {
@@ -42,7 +61,7 @@ func (srv Service) List(ctx context.Context, req ListRequest) (res ListResponse,
 	// req.FallbackPageSize = 10
 
 	var raw entity.ListResponse[Entity]
-	if raw, err = srv.dao.List(ctx, req); err != nil {
+	if raw, err = srv.dao.List(ctx, "", req); err != nil {
 		return
 	}
 
@@ -51,6 +70,55 @@ func (srv Service) List(ctx context.Context, req ListRequest) (res ListResponse,
 	return
 }
 
+type ExportRequest struct {
+	entity.ExportRequestFragment
+}
+
+// Export sends every item matching the filter, for exports too large to page through.
+func (srv Service) Export(ctx context.Context, req ExportRequest, send func(Entity) error) error {
+	return srv.dao.Stream(ctx, "", req, send)
+}
+
+type ImportRequest struct {
+	entity.ImportRequestFragment
+}
+
+// Import creates items of a CSV or NDJSON file, the operation responds with an
+// entity.ImportReport. Small files are done on return, clients poll larger ones.
+func (srv Service) Import(ctx context.Context, req ImportRequest) (res operation.Entity, err error) {
+	var op importOperation
+	if op.Format, err = req.GetFormat(); err != nil {
+		return
+	}
+	// Read the upload at once, it's released with the request
+	if op.Data, err = req.ReadFile(); err != nil {
+		return
+	}
+	op.DryRun = req.DryRun
+
+	if req.File.Size > importSyncSize {
+		return srv.operations.Start(ctx, typeImport, op)
+	}
+	return srv.operations.Execute(ctx, typeImport, op)
+}
+
+// importOperation is the request of import operations.
+type importOperation struct {
+	Format string `json:"format"`
+	DryRun bool   `json:"dryRun"`
+	Data   []byte `json:"data"`
+}
+
+func (srv Service) runImport(ctx context.Context, op importOperation, progress func(any)) (any, error) {
+	return srv.dao.Import(ctx, "", bytes.NewReader(op.Data), op.Format, op.DryRun,
+		func(report entity.ImportReport) { progress(report) })
+}
+
+// ImportFrom creates items read from r without an operation, e.g. of the import command.
+func (srv Service) ImportFrom(ctx context.Context, r io.Reader, format string, dryRun bool) (entity.ImportReport, error) {
+	return srv.dao.Import(ctx, "", r, format, dryRun, nil)
+}
+
 type UpdateRequest struct {
 	entity.UpdateRequestFragment
 	ItemID string `param:"itemID"`
@@ -60,7 +128,7 @@ type UpdateRequest struct {
 func (srv Service) Update(ctx context.Context, req UpdateRequest) (res Entity, err error) {
 	uReq := entity.UpdateRequest[Entity]{
 		UpdateRequestFragment: req.UpdateRequestFragment,
-		ID:                    req.ItemID,
+		Name:                  Pattern.Format(req.ItemID),
 		Entity:                req.Item,
 	}
 	return srv.dao.Update(ctx, uReq)
@@ -71,8 +139,38 @@ type DeleteRequest struct {
 }
 
 func (srv Service) Delete(ctx context.Context, req DeleteRequest) (code int, err error) {
-	if err = srv.dao.Delete(ctx, req.ItemID); err == nil {
+	if err = srv.dao.Delete(ctx, Pattern.Format(req.ItemID)); err == nil {
 		code = http.StatusNoContent
 	}
 	return
 }
+
+type ListRevisionsRequest struct {
+	entity.ListRequestFragment
+	ItemID string `param:"itemID"`
+}
+
+type ListRevisionsResponse struct {
+	entity.ListResponseFragment
+	Revisions []entity.Revision `json:"revisions"`
+}
+
+func (srv Service) ListRevisions(ctx context.Context, req ListRevisionsRequest) (res ListRevisionsResponse, err error) {
+	var raw entity.ListResponse[entity.Revision]
+	if raw, err = srv.dao.ListRevisions(ctx, Pattern.Format(req.ItemID), req); err != nil {
+		return
+	}
+
+	res.Revisions = raw.Items
+	res.ListResponseFragment = raw.ListResponseFragment
+	return
+}
+
+type RestoreRequest struct {
+	ItemID     string `param:"itemID"`
+	RevisionID string `json:"revisionId" validate:"required"`
+}
+
+func (srv Service) Restore(ctx context.Context, req RestoreRequest) (res Entity, err error) {
+	return srv.dao.Restore(ctx, Pattern.Format(req.ItemID), req.RevisionID)
+}
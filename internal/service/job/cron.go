@@ -0,0 +1,167 @@
+package job
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells when a job runs next, times are in UTC so replicas agree on them.
+type Schedule interface {
+	// Next returns the first time after t, or the zero time if there's none.
+	Next(t time.Time) time.Time
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron spec of 5 fields: minute, hour, day of month, month and day of week,
+// e.g. "*/15 9-17 * * 1-5". Fields are "*", numbers, ranges like "1-5", lists like "1,15",
+// and steps like "*/10" or "0-30/5". Descriptors like "@daily" and "@every 90s" are
+// supported, the latter runs at multiples of the duration since the Unix epoch.
+func Parse(spec string) (s Schedule, err error) {
+	spec = strings.TrimSpace(spec)
+	if every := strings.TrimPrefix(spec, "@every "); every != spec {
+		var d time.Duration
+		if d, err = time.ParseDuration(strings.TrimSpace(every)); err != nil {
+			return nil, fmt.Errorf("invalid cron spec %q: %w", spec, err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("invalid cron spec %q: interval below 1s", spec)
+		}
+		return everySchedule(d), nil
+	}
+	if expanded, ok := descriptors[spec]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron spec %q: expect 5 fields, got %d", spec, len(fields))
+	}
+
+	var c cronSchedule
+	bounds := []struct {
+		bits     *uint64
+		min, max int
+	}{
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 7},
+	}
+	for i, b := range bounds {
+		if *b.bits, err = parseField(fields[i], b.min, b.max); err != nil {
+			return nil, fmt.Errorf("invalid cron spec %q: %w", spec, err)
+		}
+	}
+	// Sunday is both 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.anyDom, c.anyDow = strings.HasPrefix(fields[2], "*"), strings.HasPrefix(fields[4], "*")
+	// Days missing from some months only, e.g. Feb 29, match within the 5 years Next searches
+	if c.Next(time.Unix(0, 0)).IsZero() {
+		return nil, fmt.Errorf("invalid cron spec %q: never matches", spec)
+	}
+	return c, nil
+}
+
+func parseField(field string, min, max int) (bits uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		var (
+			rng        = part
+			step       = 1
+			start, end = min, max
+		)
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step of %q", part)
+			}
+		}
+
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			lo, hi, _ := strings.Cut(rng, "-")
+			if start, err = strconv.Atoi(lo); err != nil {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+			if end, err = strconv.Atoi(hi); err != nil {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			if start, err = strconv.Atoi(rng); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			// A step after a single value runs to the maximum, e.g. "5/15"
+			end = start
+			if step > 1 {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+	return
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	anyDom, anyDow                bool
+}
+
+// Next searches forward by the largest unit not matching, giving up after 5 years,
+// e.g. for "0 0 30 2 *" that never matches and is rejected by Parse.
+func (c cronSchedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchDay follows cron, if both day fields are restricted either one matches.
+func (c cronSchedule) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.anyDom || c.anyDow {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+type everySchedule time.Duration
+
+func (e everySchedule) Next(t time.Time) time.Time {
+	n, d := t.UnixNano(), int64(e)
+	return time.Unix(0, n-n%d+d).UTC()
+}
@@ -0,0 +1,122 @@
+package job
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInvalid(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@every 500ms",
+		"@every x",
+		"0 0 30 2 *",
+		"0 0 31 4,6,9,11 *",
+	}
+	for _, spec := range specs {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// Monday
+	from := time.Date(2024, 1, 1, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"0-30/10 * * * *", time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 9-17 * * 1-5", time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"0 9 * * 6,7", time.Date(2024, 1, 6, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Unix(from.Unix()-from.Unix()%90+90, 0).UTC()},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.spec, err)
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Next of %q = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestNextInUTC(t *testing.T) {
+	s, err := Parse("0 0 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2024, 1, 1, 23, 30, 0, 0, time.FixedZone("UTC+8", 8*3600))
+	if got, want := s.Next(from), time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC); !got.Equal(want) || got.Location() != time.UTC {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+}
+
+func TestNextDayFields(t *testing.T) {
+	days := func(spec string, from time.Time, n int) (got []int) {
+		s, err := Parse(spec)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", spec, err)
+		}
+		for t := from; len(got) < n; {
+			t = s.Next(t)
+			got = append(got, t.Day())
+		}
+		return
+	}
+	equal := func(a, b []int) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	// January 2024 starts on a Monday, Mondays are 1, 8, 15, 22 and 29
+	from := time.Date(2023, 12, 31, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want []int
+	}{
+		// both restricted, either one matches
+		{"0 0 10 * 1", []int{1, 8, 10, 15, 22, 29}},
+		// one restricted, both must match
+		{"0 0 * * 1", []int{1, 8, 15, 22, 29}},
+		{"0 0 10 * *", []int{10, 10}},
+		{"0 0 */10 * *", []int{1, 11, 21, 31}},
+		// a step on "*" counts as unrestricted, so both match: Jan 1 and Mar 11
+		{"0 0 */10 * 1", []int{1, 11}},
+	}
+	for _, tt := range tests {
+		if got := days(tt.spec, from, len(tt.want)); !equal(got, tt.want) {
+			t.Errorf("days of %q = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package job
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	jobRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "job_runs_total",
+		Help: "Number of job runs on this replica by job and result, success or failure.",
+	}, []string{"job", "result"})
+
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "job_run_duration_seconds",
+		Help:    "Duration of job runs on this replica by job.",
+		Buckets: []float64{.1, .5, 1, 5, 10, 30, 60, 300, 900, 3600},
+	}, []string{"job"})
+
+	jobLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "job_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful run on this replica by job.",
+	}, []string{"job"})
+)
+
+func observe(name string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	} else {
+		jobLastSuccess.WithLabelValues(name).SetToCurrentTime()
+	}
+	jobRuns.WithLabelValues(name, result).Inc()
+	jobDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+}
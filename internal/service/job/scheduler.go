@@ -0,0 +1,290 @@
+package job
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"server/internal/service/trace"
+)
+
+// Disabled as the spec of a job in Scheduler.Specs keeps it from running.
+const Disabled = "-"
+
+// Func does the work of a job, ctx is cancelled on shutdown or if the lease is lost.
+type Func func(ctx context.Context) error
+
+type job struct {
+	name     string
+	schedule Schedule
+	fn       Func
+	next     time.Time
+	running  int32
+}
+
+// Scheduler runs jobs registered by services on their schedules. A job runs on one
+// replica at a time: the replica taking its lease in job_lease for a scheduled time
+// runs it, while others skip that time. Leases of running jobs are renewed, so a
+// crashed replica holds a job for LeaseTTL at most. Runs are recorded in job_run.
+//
+// A time missed, e.g. while the job still runs or the server is down, is skipped.
+type Scheduler struct {
+	DB *sql.DB
+	// Owner identifies the replica holding leases, the host name and pid by default
+	Owner string
+	// Interval checks due jobs, schedules have a resolution of a minute except "@every"
+	Interval time.Duration
+	LeaseTTL time.Duration
+	// History keeps runs for the duration, older ones are deleted after a job runs.
+	History time.Duration
+	// Specs override schedules of jobs by name, e.g. {"cart.expire": "@daily"}, see Disabled.
+	Specs map[string]string
+
+	mu   sync.Mutex
+	jobs []*job
+	wg   sync.WaitGroup
+}
+
+func NewScheduler(db *sql.DB) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		DB:       db,
+		Owner:    fmt.Sprintf("%s-%d", host, os.Getpid()),
+		Interval: time.Second,
+		LeaseTTL: time.Minute,
+		History:  7 * 24 * time.Hour,
+	}
+}
+
+// Register schedules fn by a cron spec, see Parse. Jobs registered after Run
+// are picked up by the next check.
+func (s *Scheduler) Register(name, spec string, fn Func) (err error) {
+	if override, ok := s.Specs[name]; ok {
+		spec = override
+	}
+	if spec == Disabled {
+		logrus.WithField("job", name).Info("Job disabled")
+		return
+	}
+
+	var schedule Schedule
+	if schedule, err = Parse(spec); err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs = append(s.jobs, &job{name: name, schedule: schedule, fn: fn, next: schedule.Next(time.Now())})
+	return
+}
+
+// Run checks due jobs until ctx is done, then cancels running ones and waits for them.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.wg.Wait()
+			return
+		case now := <-ticker.C:
+			if ctx.Err() == nil {
+				s.dispatch(ctx, now)
+			}
+		}
+	}
+}
+
+// dispatch starts due jobs not running on this replica.
+func (s *Scheduler) dispatch(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, j := range s.jobs {
+		if j.next.IsZero() || now.Before(j.next) {
+			continue
+		}
+		scheduled := j.next
+		j.next = j.schedule.Next(now)
+
+		if !atomic.CompareAndSwapInt32(&j.running, 0, 1) {
+			continue
+		}
+		s.wg.Add(1)
+		go func(j *job) {
+			defer func() {
+				atomic.StoreInt32(&j.running, 0)
+				s.wg.Done()
+			}()
+			s.run(ctx, j, scheduled)
+		}(j)
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, j *job, scheduled time.Time) {
+	log := logrus.WithFields(logrus.Fields{"job": j.name, "scheduled": scheduled})
+
+	acquired, err := s.acquire(ctx, j.name, scheduled)
+	if err != nil {
+		log.WithError(err).Warn("Acquire job lease error")
+		return
+	}
+	if !acquired {
+		log.Debug("Job taken by another replica")
+		return
+	}
+
+	// Records are written even if ctx is cancelled, e.g. on shutdown
+	var (
+		recordCtx = context.Background()
+		runID     int64
+		start     = time.Now()
+	)
+	if runID, err = s.startRun(recordCtx, j.name, scheduled, start); err != nil {
+		log.WithError(err).Warn("Record job run error")
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		s.renew(jobCtx, cancel, j.name, log)
+	}()
+
+	jobCtx, span := trace.Start(jobCtx, "job."+j.name)
+	log = trace.Logger(jobCtx).WithFields(logrus.Fields{"job": j.name, "scheduled": scheduled})
+	log.Debug("Job started")
+
+	runErr := s.call(jobCtx, j.fn)
+	trace.End(span, runErr)
+	cancel()
+	<-renewed
+
+	observe(j.name, start, runErr)
+	if runErr != nil {
+		log.WithError(runErr).Error("Job failed")
+	} else {
+		log.WithField("latencyMs", time.Since(start).Milliseconds()).Info("Job finished")
+	}
+
+	if err = s.finishRun(recordCtx, j.name, runID, runErr); err != nil {
+		log.WithError(err).Warn("Record job run error")
+	}
+	if err = s.release(recordCtx, j.name); err != nil {
+		log.WithError(err).Warn("Release job lease error")
+	}
+}
+
+// call turns panics of jobs into errors, so they're recorded rather than crashing the server.
+func (s *Scheduler) call(ctx context.Context, fn Func) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("job panic: %v", v)
+		}
+	}()
+	return fn(ctx)
+}
+
+// renew extends the lease until ctx is done, and cancels the job if the lease is lost.
+func (s *Scheduler) renew(ctx context.Context, cancel context.CancelFunc, name string, log *logrus.Entry) {
+	interval := s.LeaseTTL / 3
+	if interval <= 0 {
+		interval = s.LeaseTTL
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		const script = "update job_lease set expire_time = ? where name = ? and owner = ?"
+		sr, err := s.DB.ExecContext(ctx, script, now().Add(s.LeaseTTL), name, s.Owner)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.WithError(err).Warn("Renew job lease error")
+			}
+			continue
+		}
+		if num, _ := sr.RowsAffected(); num == 0 {
+			log.Warn("Job lease lost, cancel job")
+			cancel()
+			return
+		}
+	}
+}
+
+// acquire takes the lease for the scheduled time, if it's free and no replica ran the time yet.
+// Rows of jobs are created on first acquire, a replica losing the race of creation skips the time.
+func (s *Scheduler) acquire(ctx context.Context, name string, scheduled time.Time) (acquired bool, err error) {
+	var (
+		t      = now()
+		expire = t.Add(s.LeaseTTL)
+		sr     sql.Result
+		num    int64
+	)
+	scheduled = scheduled.UTC()
+
+	const update = "update job_lease set owner = ?, last_time = ?, expire_time = ? where name = ? and last_time < ? and expire_time <= ?"
+	if sr, err = s.DB.ExecContext(ctx, update, s.Owner, scheduled, expire, name, scheduled, t); err != nil {
+		return
+	}
+	if num, err = sr.RowsAffected(); err != nil || num > 0 {
+		return num > 0, err
+	}
+
+	const insert = "insert into job_lease (name, owner, last_time, expire_time) values (?, ?, ?, ?)"
+	if _, insertErr := s.DB.ExecContext(ctx, insert, name, s.Owner, scheduled, expire); insertErr == nil {
+		return true, nil
+	} else if err = s.DB.QueryRowContext(ctx, "select 1 from job_lease where name = ?", name).Scan(new(int)); err == sql.ErrNoRows {
+		err = insertErr
+	}
+	return
+}
+
+func (s *Scheduler) release(ctx context.Context, name string) (err error) {
+	const script = "update job_lease set expire_time = ? where name = ? and owner = ?"
+	_, err = s.DB.ExecContext(ctx, script, now(), name, s.Owner)
+	return
+}
+
+func (s *Scheduler) startRun(ctx context.Context, name string, scheduled, start time.Time) (id int64, err error) {
+	const script = "insert into job_run (job, owner, scheduled_time, start_time) values (?, ?, ?, ?)"
+
+	var sr sql.Result
+	if sr, err = s.DB.ExecContext(ctx, script, name, s.Owner, scheduled.UTC(), start.UTC()); err != nil {
+		return
+	}
+	return sr.LastInsertId()
+}
+
+// finishRun records the result and deletes runs older than History.
+func (s *Scheduler) finishRun(ctx context.Context, name string, id int64, runErr error) (err error) {
+	var msg string
+	if runErr != nil {
+		msg = runErr.Error()
+	}
+	if id > 0 {
+		const script = "update job_run set end_time = ?, success = ?, error = ? where id = ?"
+		if _, err = s.DB.ExecContext(ctx, script, now(), runErr == nil, msg, id); err != nil {
+			return
+		}
+	}
+	_, err = s.DB.ExecContext(ctx, "delete from job_run where job = ? and start_time < ?", name, now().Add(-s.History))
+	return
+}
+
+// now is truncated to seconds, so times stored as text by SQLite compare in order.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
@@ -0,0 +1,123 @@
+package job
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+)
+
+func openLeaseDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err = db.Exec("create table job_lease (name text primary key, owner text not null, " +
+		"last_time timestamp not null, expire_time timestamp not null)"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newTestScheduler(db *sql.DB, owner string) *Scheduler {
+	s := NewScheduler(db)
+	s.Owner = owner
+	return s
+}
+
+func TestSchedulerAcquire(t *testing.T) {
+	var (
+		db     = openLeaseDB(t)
+		a      = newTestScheduler(db, "a")
+		b      = newTestScheduler(db, "b")
+		ctx    = context.Background()
+		first  = now().Add(-time.Minute)
+		second = now()
+	)
+	acquire := func(s *Scheduler, scheduled time.Time, want bool) {
+		t.Helper()
+		if got, err := s.acquire(ctx, "purge", scheduled); err != nil || got != want {
+			t.Fatalf("%s acquire %v = %v, %v, want %v", s.Owner, scheduled, got, err, want)
+		}
+	}
+
+	acquire(a, first, true)
+	acquire(b, first, false)
+	// held by a until it expires or is released
+	acquire(b, second, false)
+
+	if err := a.release(ctx, "purge"); err != nil {
+		t.Fatal(err)
+	}
+	// a time runs once, even after the lease is released
+	acquire(b, first, false)
+	acquire(b, second, true)
+	acquire(a, second, false)
+
+	// b crashed, its lease expires
+	if _, err := db.Exec("update job_lease set expire_time = ?", now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	acquire(a, second.Add(time.Minute), true)
+}
+
+func TestSchedulerRenew(t *testing.T) {
+	var (
+		db  = openLeaseDB(t)
+		s   = newTestScheduler(db, "a")
+		log = logrus.NewEntry(logrus.StandardLogger())
+	)
+	s.LeaseTTL = 30 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if ok, err := s.acquire(ctx, "purge", now()); err != nil || !ok {
+		t.Fatalf("acquire = %v, %v", ok, err)
+	}
+	expired := now().Add(-time.Hour)
+	if _, err := db.Exec("update job_lease set expire_time = ?", expired); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.renew(ctx, cancel, "purge", log)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		var expire time.Time
+		if err := db.QueryRow("select expire_time from job_lease").Scan(&expire); err != nil {
+			t.Fatal(err)
+		}
+		if expire.After(expired) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("lease not renewed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// another replica took the lease, the job is cancelled
+	if _, err := db.Exec("update job_lease set owner = 'b'"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("renew kept running after losing the lease")
+	}
+	if ctx.Err() == nil {
+		t.Error("job not cancelled after losing the lease")
+	}
+}
@@ -0,0 +1,76 @@
+package operation
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"server/internal/service/entity"
+)
+
+const Pattern entity.Pattern = "operations/{operationID}"
+
+// Entity is a long-running operation, see google.longrunning.Operation.
+// Once Done, either Response or Error is set, Error is a google.rpc.Status.
+type Entity struct {
+	ID         int64           `json:"id,string"`
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	Done       bool            `json:"done"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+	Response   json.RawMessage `json:"response,omitempty"`
+	Error      json.RawMessage `json:"error,omitempty"`
+	CreateTime time.Time       `json:"createTime"`
+	UpdateTime time.Time       `json:"updateTime"`
+
+	actor     string
+	requestID string
+}
+
+func (e Entity) GetID() string {
+	return strconv.FormatInt(e.ID, 10)
+}
+
+func (e Entity) GetName() string {
+	return e.Name
+}
+
+func (e Entity) InsertValues() []any {
+	return []any{e.Type}
+}
+
+const allFields = "id, type, done, metadata, response, error, create_time, update_time, actor, request_id"
+
+func scanEntity(row entity.Scanner) (e Entity, err error) {
+	var metadata, response, opErr sql.NullString
+	if err = row.Scan(&e.ID, &e.Type, &e.Done, &metadata, &response, &opErr, &e.CreateTime, &e.UpdateTime,
+		&e.actor, &e.requestID); err != nil {
+		return
+	}
+	e.Metadata, e.Response, e.Error = rawJSON(metadata), rawJSON(response), rawJSON(opErr)
+	e.Name = Pattern.Format(e.GetID())
+	return
+}
+
+func rawJSON(s sql.NullString) json.RawMessage {
+	if !s.Valid {
+		return nil
+	}
+	return json.RawMessage(s.String)
+}
+
+// newDao is read-only, operations are written by Runner directly
+// so that they don't emit events themselves.
+func newDao(db *sql.DB) entity.Dao[Entity] {
+	return entity.Dao[Entity]{
+		DB:            db,
+		Pattern:       Pattern,
+		Table:         "operation",
+		Keys:          []string{"id"},
+		Columns:       map[string]string{"actor": "actor"},
+		SqlGet:        "select " + allFields + " from operation where id = ? limit 1",
+		SqlList:       "select " + allFields + " from operation where id > ?",
+		ScanAllFields: scanEntity,
+	}
+}
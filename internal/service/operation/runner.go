@@ -0,0 +1,481 @@
+package operation
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gota33/errors"
+	"github.com/sirupsen/logrus"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"server/internal/service/auth"
+	"server/internal/service/entity"
+	"server/internal/service/trace"
+)
+
+const (
+	statusPending = "pending"
+	statusRunning = "running"
+	statusDone    = "done"
+)
+
+var (
+	errCancelled   = errors.New("operation cancelled")
+	errInterrupted = errors.New("operation interrupted")
+)
+
+// Handler does the work of a registered type of operations, progress saves metadata
+// for clients polling it. The response is saved as JSON once it returns, or the error if any.
+type Handler func(ctx context.Context, request json.RawMessage, progress func(metadata any)) (response any, err error)
+
+// Register adds a type of operations, whose requests are decoded as Request.
+func Register[Request any](r *Runner, typ string, fn func(ctx context.Context, req Request, progress func(metadata any)) (any, error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.handlers[typ] = func(ctx context.Context, data json.RawMessage, progress func(any)) (any, error) {
+		var req Request
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, err
+		}
+		return fn(ctx, req, progress)
+	}
+}
+
+// Runner is a worker pool of operations, saved as pending by Start and run by
+// Workers of Run, or run by Execute while the caller waits.
+//
+// Operations are run at most once: ones interrupted by shutdown or a crash fail
+// with ABORTED rather than being run again, as their work may be partly done.
+// Running operations hold a lease renewed by their runner, so those of a crashed
+// replica are aborted by others once LeaseTTL passes. Cancelled ones fail with CANCELLED.
+type Runner struct {
+	DB *sql.DB
+	// Owner identifies the replica running operations, the host name and pid by default
+	Owner string
+	// Workers run operations concurrently
+	Workers int
+	// Interval polls pending operations and cancellations, e.g. started or cancelled
+	// by other processes. Operations started by the process wake a worker at once.
+	Interval time.Duration
+	LeaseTTL time.Duration
+	// EncodeError encodes errors of operations as google.rpc.Status, errors are encoded as is if nil.
+	EncodeError func(ctx context.Context, err error) (json.RawMessage, error)
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	running  map[int64]context.CancelFunc
+	wake     chan struct{}
+}
+
+func NewRunner(db *sql.DB) *Runner {
+	host, _ := os.Hostname()
+	return &Runner{
+		DB:       db,
+		Owner:    fmt.Sprintf("%s-%d", host, os.Getpid()),
+		Workers:  4,
+		Interval: time.Second,
+		LeaseTTL: time.Minute,
+		handlers: map[string]Handler{},
+		running:  map[int64]context.CancelFunc{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Run runs pending operations until ctx is done, then cancels running ones
+// and waits for them to be saved.
+func (r *Runner) Run(ctx context.Context) {
+	var (
+		wg      sync.WaitGroup
+		workers = make(chan struct{}, r.Workers)
+		ticker  = time.NewTicker(r.Interval)
+	)
+	defer ticker.Stop()
+
+	// Running operations outlive ctx until they're cancelled, so that they're saved
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	for {
+		if err := r.poll(ctx, runCtx, workers, &wg); err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Warn("Poll operations error")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// poll renews leases of running operations and aborts expired ones, then starts
+// pending operations on idle workers, and cancels running ones cancelled by others.
+func (r *Runner) poll(ctx, runCtx context.Context, workers chan struct{}, wg *sync.WaitGroup) (err error) {
+	if err = r.renew(ctx); err != nil {
+		return
+	}
+	if err = r.abortExpired(ctx); err != nil {
+		return
+	}
+	if err = r.cancelRequested(ctx); err != nil {
+		return
+	}
+
+	idle := cap(workers) - len(workers)
+	if idle == 0 {
+		return
+	}
+
+	var ids []int64
+	if ids, err = r.pending(ctx, idle); err != nil {
+		return
+	}
+	for _, id := range ids {
+		var (
+			op      Entity
+			claimed bool
+		)
+		if op, claimed, err = r.claim(ctx, id); err != nil {
+			return
+		}
+		if !claimed {
+			continue
+		}
+
+		workers <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-workers
+				wg.Done()
+				r.notify()
+			}()
+			opCtx := op.context(runCtx)
+			if _, runErr := r.run(opCtx, op); runErr != nil {
+				trace.Logger(opCtx).WithError(runErr).WithField("operation", op.Name).Error("Save operation error")
+			}
+		}()
+	}
+	return
+}
+
+// Start saves the operation as pending, and returns it before it's run by a worker.
+// The actor and request ID of ctx are kept for the operation.
+func (r *Runner) Start(ctx context.Context, typ string, request any) (op Entity, err error) {
+	if op, err = r.create(ctx, typ, request, statusPending); err != nil {
+		return
+	}
+	r.notify()
+	return
+}
+
+// Execute runs the operation and returns it done, for work that fits in a request.
+// Errors of the operation are saved in it rather than returned.
+func (r *Runner) Execute(ctx context.Context, typ string, request any) (op Entity, err error) {
+	if op, err = r.create(ctx, typ, request, statusRunning); err != nil {
+		return
+	}
+	return r.run(ctx, op)
+}
+
+// Cancel requests cancellation of the operation, it's cancelled at once if pending
+// or run by the process, or by the process running it within Interval.
+func (r *Runner) Cancel(ctx context.Context, id int64) (err error) {
+	const script = "update operation set cancel_requested = true, update_time = current_timestamp where id = ? and not done"
+	if _, err = r.DB.ExecContext(ctx, script, id); err != nil {
+		return
+	}
+
+	var data json.RawMessage
+	if data, err = r.encodeError(ctx, errors.WithCancelled(errCancelled)); err != nil {
+		return
+	}
+	if _, err = r.DB.ExecContext(ctx, "update operation set status = ?, done = true, request = null, error = ?, "+
+		"update_time = current_timestamp where id = ? and status = ?", statusDone, string(data), id, statusPending); err != nil {
+		return
+	}
+
+	r.cancel(id)
+	return
+}
+
+func (r *Runner) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Runner) cancel(id int64) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if cancel, ok := r.running[id]; ok {
+		cancel()
+	}
+}
+
+func (r *Runner) create(ctx context.Context, typ string, request any, status string) (op Entity, err error) {
+	r.mu.RLock()
+	_, ok := r.handlers[typ]
+	r.mu.RUnlock()
+	if !ok {
+		return op, fmt.Errorf("unknown operation type %q", typ)
+	}
+
+	var (
+		data   []byte
+		sr     sql.Result
+		id     int64
+		t      trace.Trace
+		owner  string
+		expire any
+	)
+	if data, err = json.Marshal(request); err != nil {
+		return
+	}
+	t.FromContext(ctx)
+	if status == statusRunning {
+		owner, expire = r.Owner, r.expireTime()
+	}
+
+	const script = "insert into operation (type, request, actor, request_id, status, owner, expire_time) " +
+		"values (?, ?, ?, ?, ?, ?, ?)"
+	if sr, err = r.DB.ExecContext(ctx, script, typ, string(data), auth.ActorOf(ctx), t.RequestID, status,
+		owner, expire); err != nil {
+		return
+	}
+	if id, err = sr.LastInsertId(); err != nil {
+		return
+	}
+	return r.get(ctx, id)
+}
+
+func (r *Runner) pending(ctx context.Context, limit int) (ids []int64, err error) {
+	const script = "select id from operation where status = ? and not cancel_requested order by id limit ?"
+
+	var rows *sql.Rows
+	if rows, err = r.DB.QueryContext(ctx, script, statusPending, limit); err != nil {
+		return
+	}
+
+	defer entity.CloseRows(rows)
+
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+	err = rows.Err()
+	return
+}
+
+// claim marks the operation running, claimed is false if another worker did first.
+func (r *Runner) claim(ctx context.Context, id int64) (op Entity, claimed bool, err error) {
+	const script = "update operation set status = ?, owner = ?, expire_time = ?, update_time = current_timestamp " +
+		"where id = ? and status = ?"
+
+	var (
+		sr  sql.Result
+		num int64
+	)
+	if sr, err = r.DB.ExecContext(ctx, script, statusRunning, r.Owner, r.expireTime(), id, statusPending); err != nil {
+		return
+	}
+	if num, err = sr.RowsAffected(); err != nil || num == 0 {
+		return
+	}
+	op, err = r.get(ctx, id)
+	return op, err == nil, err
+}
+
+// cancelRequested cancels operations run by the process and cancelled by others,
+// or aborted by others, e.g. after the process failed to renew their leases.
+func (r *Runner) cancelRequested(ctx context.Context) (err error) {
+	r.mu.RLock()
+	ids := make([]int64, 0, len(r.running))
+	for id := range r.running {
+		ids = append(ids, id)
+	}
+	r.mu.RUnlock()
+
+	for _, id := range ids {
+		var requested bool
+		if err = r.DB.QueryRowContext(ctx, "select cancel_requested or done from operation where id = ?", id).
+			Scan(&requested); err != nil {
+			return
+		}
+		if requested {
+			r.cancel(id)
+		}
+	}
+	return
+}
+
+func (r *Runner) expireTime() time.Time {
+	return time.Now().UTC().Add(r.LeaseTTL)
+}
+
+// renew extends leases of operations run by the process.
+func (r *Runner) renew(ctx context.Context) (err error) {
+	_, err = r.DB.ExecContext(ctx, "update operation set expire_time = ? where owner = ? and status = ?",
+		r.expireTime(), r.Owner, statusRunning)
+	return
+}
+
+// abortExpired fails operations whose runner stopped renewing their leases, e.g. after a crash.
+func (r *Runner) abortExpired(ctx context.Context) (err error) {
+	var data json.RawMessage
+	if data, err = r.encodeError(ctx, interrupted(errInterrupted)); err != nil {
+		return
+	}
+	_, err = r.DB.ExecContext(ctx, "update operation set status = ?, done = true, request = null, error = ?, "+
+		"update_time = current_timestamp where status = ? and expire_time < ?",
+		statusDone, string(data), statusRunning, time.Now().UTC())
+	return
+}
+
+func (r *Runner) run(ctx context.Context, op Entity) (Entity, error) {
+	log := trace.Logger(ctx).WithFields(logrus.Fields{"operation": op.Name, "type": op.Type})
+
+	r.mu.Lock()
+	h := r.handlers[op.Type]
+	runCtx, cancel := context.WithCancel(ctx)
+	r.running[op.ID] = cancel
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.running, op.ID)
+		r.mu.Unlock()
+		cancel()
+	}()
+
+	var (
+		res     any
+		request string
+	)
+	runCtx, span := trace.Start(runCtx, "operation."+op.Type)
+	fnErr := r.DB.QueryRowContext(runCtx, "select request from operation where id = ?", op.ID).Scan(&request)
+	if fnErr == nil {
+		res, fnErr = h(runCtx, json.RawMessage(request), func(metadata any) {
+			if err := r.save(runCtx, op.ID, metadata); err != nil && runCtx.Err() == nil {
+				log.WithError(err).Warn("Save operation progress error")
+			}
+		})
+	}
+	trace.End(span, fnErr)
+
+	// Saved even if ctx is cancelled, e.g. on shutdown
+	saveCtx := detach(ctx, context.Background())
+	if fnErr != nil {
+		switch {
+		case ctx.Err() == context.Canceled:
+			fnErr = interrupted(fmt.Errorf("%w: %s", errInterrupted, fnErr))
+		case ctx.Err() == nil && runCtx.Err() != nil:
+			fnErr = errors.WithCancelled(fmt.Errorf("%w: %s", errCancelled, fnErr))
+		}
+		log.WithError(fnErr).Warn("Operation failed")
+
+		data, err := r.encodeError(saveCtx, fnErr)
+		if err != nil {
+			return op, err
+		}
+		return op, r.finish(saveCtx, &op, nil, data)
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return op, err
+	}
+	return op, r.finish(saveCtx, &op, data, nil)
+}
+
+func (r *Runner) save(ctx context.Context, id int64, metadata any) (err error) {
+	var data []byte
+	if data, err = json.Marshal(metadata); err != nil {
+		return
+	}
+	_, err = r.DB.ExecContext(ctx,
+		"update operation set metadata = ?, update_time = current_timestamp where id = ?", string(data), id)
+	return
+}
+
+// finish saves either the response or the error, requests are dropped as they may be
+// large, e.g. uploaded files. Operations done meanwhile, e.g. aborted once their lease
+// expired, are left as they are.
+func (r *Runner) finish(ctx context.Context, op *Entity, response, opErr json.RawMessage) (err error) {
+	if _, err = r.DB.ExecContext(ctx, "update operation set status = ?, done = true, request = null, "+
+		"response = ?, error = ?, update_time = current_timestamp where id = ? and not done",
+		statusDone, nullJSON(response), nullJSON(opErr), op.ID); err != nil {
+		return
+	}
+	*op, err = r.get(ctx, op.ID)
+	return
+}
+
+func (r *Runner) get(ctx context.Context, id int64) (Entity, error) {
+	row := r.DB.QueryRowContext(ctx, "select "+allFields+" from operation where id = ? limit 1", id)
+	return scanEntity(row)
+}
+
+func (r *Runner) encodeError(ctx context.Context, cause error) (json.RawMessage, error) {
+	if r.EncodeError != nil {
+		return r.EncodeError(ctx, cause)
+	}
+	buf := &bytes.Buffer{}
+	if err := errors.NewEncoder(json.NewEncoder(buf)).Encode(cause); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(buf.Bytes()), nil
+}
+
+// nullJSON saves nil as NULL rather than an empty string.
+func nullJSON(data json.RawMessage) any {
+	if data == nil {
+		return nil
+	}
+	return string(data)
+}
+
+func interrupted(cause error) error {
+	return errors.WithAborted(cause, errors.ErrorInfo{Reason: "INTERRUPTED"})
+}
+
+// context carries the actor and request ID of the operation over to base.
+func (e Entity) context(base context.Context) context.Context {
+	var t trace.Trace
+	t.FromHeaders(e.requestID, "")
+	base = t.WithContext(base)
+	return auth.WithActor(base, e.actor)
+}
+
+// detach carries the trace and user of ctx over to base, without its deadline or cancellation.
+func detach(ctx, base context.Context) context.Context {
+	base = oteltrace.ContextWithSpanContext(base, oteltrace.SpanContextFromContext(ctx))
+
+	var t trace.Trace
+	if t.FromContext(ctx) {
+		base = t.WithContext(base)
+	}
+	var u auth.User
+	if u.FromContext(ctx) == nil {
+		base = u.WithContext(base)
+	}
+	if ip := auth.ClientIP(ctx); ip != "" {
+		base = auth.WithClientIP(base, ip)
+	}
+	return base
+}
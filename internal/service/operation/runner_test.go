@@ -0,0 +1,211 @@
+package operation
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gota33/errors"
+	_ "github.com/mattn/go-sqlite3"
+	"server/internal/service/auth"
+	"server/internal/service/entity"
+)
+
+const schema = `
+create table operation
+(
+    id               integer primary key autoincrement,
+    type             text      not null,
+    request          text      null,
+    actor            text      not null default '',
+    request_id       text      not null default '',
+    status           text      not null default 'pending',
+    done             boolean   not null default false,
+    cancel_requested boolean   not null default false,
+    owner            text      not null default '',
+    expire_time      timestamp null,
+    metadata         text      null,
+    response         text      null,
+    error            text      null,
+    create_time      timestamp not null default current_timestamp,
+    update_time      timestamp not null default current_timestamp
+);`
+
+func newTestRunner(t *testing.T, owner string) *Runner {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err = db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRunner(db)
+	r.Owner = owner
+	Register(r, "test.echo", func(_ context.Context, req string, _ func(any)) (any, error) {
+		if req == "fail" {
+			return nil, errors.New("failed")
+		}
+		return req, nil
+	})
+	return r
+}
+
+func withActor(ctx context.Context, subject string) context.Context {
+	return auth.User{StandardClaims: jwt.StandardClaims{Subject: subject}}.WithContext(ctx)
+}
+
+func TestRunnerAbortsExpiredLeases(t *testing.T) {
+	var (
+		ctx = context.Background()
+		r   = newTestRunner(t, "a")
+		now = time.Now().UTC()
+	)
+	const script = "insert into operation (type, request, status, owner, expire_time) values ('test.echo', '\"\"', 'running', ?, ?)"
+	for _, lease := range []struct {
+		owner  string
+		expire time.Time
+	}{
+		{"a", now.Add(-time.Minute)}, // renewed by r
+		{"b", now.Add(-time.Minute)}, // crashed
+		{"c", now.Add(time.Minute)},  // alive
+	} {
+		if _, err := r.DB.Exec(script, lease.owner, lease.expire); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := r.renew(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.abortExpired(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, wantDone := range map[int64]bool{1: false, 2: true, 3: false} {
+		op, err := r.get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op.Done != wantDone {
+			t.Errorf("operation %d done = %v, want %v", id, op.Done, wantDone)
+		}
+		if op.Done && !strings.Contains(string(op.Error), "ABORTED") {
+			t.Errorf("operation %d error = %s, want ABORTED", id, op.Error)
+		}
+	}
+}
+
+func TestRunnerFinishKeepsOneResult(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRunner(t, "a")
+
+	op, err := r.create(ctx, "test.echo", "fail", statusRunning)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.DB.Exec("update operation set response = '{}' where id = ?", op.ID); err != nil {
+		t.Fatal(err)
+	}
+	if op, err = r.run(ctx, op); err != nil {
+		t.Fatal(err)
+	}
+	if !op.Done || op.Response != nil || op.Error == nil {
+		t.Errorf("got done %v, response %s, error %s, want only an error", op.Done, op.Response, op.Error)
+	}
+
+	// Operations aborted meanwhile stay aborted
+	if _, err = r.DB.Exec("update operation set error = 'aborted'"); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.finish(ctx, &op, []byte(`"late"`), nil); err != nil {
+		t.Fatal(err)
+	}
+	if op.Response != nil || string(op.Error) != "aborted" {
+		t.Errorf("got response %s, error %s, want the abort kept", op.Response, op.Error)
+	}
+}
+
+func TestServiceScopesByActor(t *testing.T) {
+	var (
+		r     = newTestRunner(t, "a")
+		srv   = New(r.DB, r)
+		alice = withActor(context.Background(), "alice")
+		bob   = withActor(context.Background(), "bob")
+	)
+	op, err := r.Start(alice, "test.echo", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := GetRequest{OperationID: op.GetID()}
+
+	if _, err = srv.Get(alice, req); err != nil {
+		t.Errorf("get by alice: %v", err)
+	}
+	if _, err = srv.Get(bob, req); errors.Code(err) != errors.NotFound {
+		t.Errorf("get by bob: %v, want NotFound", err)
+	}
+	if _, err = srv.Cancel(bob, CancelRequest{OperationID: op.GetID()}); errors.Code(err) != errors.NotFound {
+		t.Errorf("cancel by bob: %v, want NotFound", err)
+	}
+
+	for ctx, want := range map[context.Context]int{alice: 1, bob: 0} {
+		res, listErr := srv.List(ctx, ListRequest{ListRequestFragment: entity.ListRequestFragment{
+			PageSize: 10,
+			Filter:   `type = "test.echo"`,
+		}})
+		if listErr != nil {
+			t.Fatal(listErr)
+		}
+		if len(res.Operations) != want {
+			t.Errorf("listed %d operations, want %d", len(res.Operations), want)
+		}
+	}
+
+	if op, err = srv.Cancel(alice, CancelRequest{OperationID: op.GetID()}); err != nil || !op.Done {
+		t.Errorf("cancel by alice: %+v, %v, want done", op, err)
+	}
+}
+
+func TestServiceScopesAnonymousByIP(t *testing.T) {
+	var (
+		r      = newTestRunner(t, "a")
+		srv    = New(r.DB, r)
+		first  = auth.WithClientIP(context.Background(), "10.0.0.1")
+		second = auth.WithClientIP(context.Background(), "10.0.0.2")
+	)
+	op, err := r.Start(first, "test.echo", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := auth.ActorOf(op.context(context.Background())); got != "ip:10.0.0.1" {
+		t.Errorf("operation runs as %q, want ip:10.0.0.1", got)
+	}
+
+	req := GetRequest{OperationID: op.GetID()}
+	if _, err = srv.Get(first, req); err != nil {
+		t.Errorf("get by the first client: %v", err)
+	}
+	if _, err = srv.Get(second, req); errors.Code(err) != errors.NotFound {
+		t.Errorf("get by the second client: %v, want NotFound", err)
+	}
+	if _, err = srv.Cancel(second, CancelRequest{OperationID: op.GetID()}); errors.Code(err) != errors.NotFound {
+		t.Errorf("cancel by the second client: %v, want NotFound", err)
+	}
+	for ctx, want := range map[context.Context]int{first: 1, second: 0} {
+		res, listErr := srv.List(ctx, ListRequest{ListRequestFragment: entity.ListRequestFragment{PageSize: 10}})
+		if listErr != nil {
+			t.Fatal(listErr)
+		}
+		if len(res.Operations) != want {
+			t.Errorf("listed %d operations, want %d", len(res.Operations), want)
+		}
+	}
+}
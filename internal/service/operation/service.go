@@ -0,0 +1,109 @@
+package operation
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gota33/errors"
+	"server/internal/service/auth"
+	"server/internal/service/entity"
+)
+
+type Service struct {
+	dao    entity.Dao[Entity]
+	runner *Runner
+}
+
+func New(db *sql.DB, runner *Runner) Service {
+	return Service{dao: newDao(db), runner: runner}
+}
+
+func (srv Service) Check(ctx context.Context) error {
+	return srv.dao.Check(ctx)
+}
+
+type GetRequest struct {
+	OperationID string `param:"operationID"`
+}
+
+// Get is polled by clients until the operation is done.
+func (srv Service) Get(ctx context.Context, req GetRequest) (res Entity, err error) {
+	return srv.get(ctx, Pattern.Format(req.OperationID))
+}
+
+// get finds operations started by the caller of ctx, see auth.ActorOf, others are not found
+// rather than forbidden, so their names aren't disclosed.
+func (srv Service) get(ctx context.Context, name string) (res Entity, err error) {
+	if res, err = srv.dao.Get(ctx, name); err == nil && res.actor != auth.ActorOf(ctx) {
+		err = errors.WithNotFound(sql.ErrNoRows, errors.ResourceInfo{
+			ResourceType: Pattern.Collection(),
+			ResourceName: name,
+		})
+	}
+	return
+}
+
+type ListRequest struct {
+	entity.ListRequestFragment
+}
+
+type ListResponse struct {
+	entity.ListResponseFragment
+	Operations []Entity `json:"operations"`
+}
+
+// List supports filters of type and done, e.g. `type = "item.import" AND done = false`.
+// Only operations started by the caller of ctx are listed.
+func (srv Service) List(ctx context.Context, req ListRequest) (res ListResponse, err error) {
+	var raw entity.ListResponse[Entity]
+	if raw, err = srv.dao.List(ctx, "", actorRequest{ListRequest: req, actor: auth.ActorOf(ctx)}); err != nil {
+		return
+	}
+
+	res.Operations = raw.Items
+	res.ListResponseFragment = raw.ListResponseFragment
+	return
+}
+
+// actorRequest filters operations by actor, on top of the filter of the request.
+type actorRequest struct {
+	ListRequest
+	actor string
+}
+
+func (r actorRequest) GetFilter() string {
+	filter := "actor = " + strconv.Quote(r.actor)
+	if f := r.ListRequest.GetFilter(); f != "" {
+		filter += " AND " + f
+	}
+	return filter
+}
+
+type CancelRequest struct {
+	OperationID string `param:"operationID"`
+}
+
+// Cancel is best-effort, the operation may still finish, otherwise it fails with CANCELLED.
+// Cancelling a done operation has no effect.
+func (srv Service) Cancel(ctx context.Context, req CancelRequest) (res Entity, err error) {
+	name := Pattern.Format(req.OperationID)
+	if res, err = srv.get(ctx, name); err != nil || res.Done {
+		return
+	}
+	if err = srv.runner.Cancel(ctx, res.ID); err != nil {
+		return
+	}
+	return srv.get(ctx, name)
+}
+
+// retention keeps done operations for clients to poll results, see Purge.
+const retention = 7 * 24 * time.Hour
+
+// Purge deletes operations done for longer than retention, it's run as the job "operation.purge".
+func (srv Service) Purge(ctx context.Context) (err error) {
+	const script = "delete from operation where status = ? and update_time < ?"
+	_, err = srv.dao.DB.ExecContext(ctx, script, statusDone, time.Now().UTC().Add(-retention))
+	return
+}
@@ -0,0 +1,153 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+type ctxKey int
+
+const (
+	unknown ctxKey = iota
+	traceKey
+)
+
+const (
+	HeaderRequestID   = "X-Request-ID"
+	HeaderTraceparent = "traceparent"
+
+	version      = "00"
+	flagSampled  = "01"
+	maxRequestID = 128
+)
+
+var tracer = otel.Tracer("server")
+
+// Trace correlates a request across logs, error responses and outgoing calls,
+// TraceID, ParentID and SpanID follow W3C Trace Context.
+type Trace struct {
+	RequestID string
+	TraceID   string
+	ParentID  string
+	SpanID    string
+	Flags     string
+}
+
+// FromHeaders continues the incoming trace if traceparent is valid, otherwise
+// starts a new one. The request ID defaults to the trace ID.
+func (t *Trace) FromHeaders(requestID, traceparent string) {
+	*t = Trace{Flags: flagSampled}
+	if parts := strings.Split(traceparent, "-"); len(parts) == 4 &&
+		parts[0] == version &&
+		isID(parts[1], 32) &&
+		isID(parts[2], 16) &&
+		isHex(parts[3], 2) {
+		t.TraceID, t.ParentID, t.Flags = parts[1], parts[2], parts[3]
+	} else {
+		t.TraceID = randomHex(16)
+	}
+	t.SpanID = randomHex(8)
+	t.setRequestID(requestID)
+}
+
+// FromSpan follows an OpenTelemetry span, its parent is the span of t if any.
+// A new trace is started like FromHeaders if the span is invalid.
+func (t *Trace) FromSpan(requestID string, sc oteltrace.SpanContext) {
+	if !sc.IsValid() {
+		t.FromHeaders(requestID, "")
+		return
+	}
+	*t = Trace{
+		TraceID:  sc.TraceID().String(),
+		ParentID: t.SpanID,
+		SpanID:   sc.SpanID().String(),
+		Flags:    sc.TraceFlags().String(),
+	}
+	t.setRequestID(requestID)
+}
+
+func (t *Trace) setRequestID(requestID string) {
+	if requestID = strings.TrimSpace(requestID); requestID != "" && len(requestID) <= maxRequestID {
+		t.RequestID = requestID
+	} else {
+		t.RequestID = t.TraceID
+	}
+}
+
+// Traceparent is the header value for calls made on behalf of this span.
+func (t Trace) Traceparent() string {
+	return version + "-" + t.TraceID + "-" + t.SpanID + "-" + t.Flags
+}
+
+func (t Trace) WithContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, traceKey, t)
+}
+
+func (t *Trace) FromContext(ctx context.Context) (ok bool) {
+	*t, ok = ctx.Value(traceKey).(Trace)
+	return
+}
+
+// Start starts a span as child of the one in ctx, the trace in returned context
+// follows the new span, so logs point at it. Spans continued from remote
+// parents, e.g. by traceparent, keep them as ParentID.
+func Start(ctx context.Context, name string, opts ...oteltrace.SpanStartOption) (context.Context, oteltrace.Span) {
+	parent := oteltrace.SpanContextFromContext(ctx)
+	ctx, span := tracer.Start(ctx, name, opts...)
+
+	var t Trace
+	t.FromContext(ctx)
+	if parent.IsRemote() {
+		t.SpanID = parent.SpanID().String()
+	}
+	t.FromSpan(t.RequestID, span.SpanContext())
+	return t.WithContext(ctx), span
+}
+
+// End records err if any and ends span.
+func End(span oteltrace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Logger returns an entry carrying the trace of ctx, or the standard logger's entry.
+func Logger(ctx context.Context) *logrus.Entry {
+	var t Trace
+	if !t.FromContext(ctx) {
+		return logrus.NewEntry(logrus.StandardLogger())
+	}
+	return logrus.WithFields(logrus.Fields{
+		"requestId": t.RequestID,
+		"traceId":   t.TraceID,
+		"spanId":    t.SpanID,
+	})
+}
+
+// isID rejects all zero IDs, which are invalid by the spec.
+func isID(str string, size int) bool {
+	return isHex(str, size) && strings.Trim(str, "0") != ""
+}
+
+func isHex(str string, size int) bool {
+	if len(str) != size || strings.ToLower(str) != str {
+		return false
+	}
+	_, err := hex.DecodeString(str)
+	return err == nil
+}
+
+func randomHex(size int) string {
+	buf := make([]byte, size)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,102 @@
+package trace
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestFromSpan(t *testing.T) {
+	traceID, _ := oteltrace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := oteltrace.SpanIDFromHex("00f067aa0ba902b7")
+	sc := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{TraceID: traceID, SpanID: spanID})
+
+	var tr Trace
+	tr.FromSpan("", sc)
+	if tr.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || tr.SpanID != "00f067aa0ba902b7" || tr.RequestID != tr.TraceID {
+		t.Errorf("FromSpan(%v) = %+v", sc, tr)
+	}
+
+	// IDs are generated without a span, e.g. when tracing is disabled
+	tr.FromSpan(strings.Repeat("x", maxRequestID+1), oteltrace.SpanContext{})
+	if len(tr.TraceID) != 32 || len(tr.SpanID) != 16 || tr.TraceID == "4bf92f3577b34da6a3ce929d0e0e4736" || tr.RequestID != tr.TraceID {
+		t.Errorf("FromSpan of an invalid span = %+v, want a new trace", tr)
+	}
+
+	tr.FromSpan("req-1", sc)
+	if tr.RequestID != "req-1" {
+		t.Errorf("request ID = %q, want req-1", tr.RequestID)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	if fields := Logger(context.Background()).Data; len(fields) != 0 {
+		t.Errorf("fields without a trace = %v", fields)
+	}
+
+	tr := Trace{RequestID: "req-1", TraceID: "t", SpanID: "s"}
+	fields := Logger(tr.WithContext(context.Background())).Data
+	if fields["requestId"] != "req-1" || fields["traceId"] != "t" || fields["spanId"] != "s" {
+		t.Errorf("fields = %v", fields)
+	}
+}
+
+var recorder = tracetest.NewSpanRecorder()
+
+func init() {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+}
+
+func TestFromHeaders(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	var tr Trace
+	tr.FromHeaders("", traceparent)
+	if tr.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || tr.ParentID != "00f067aa0ba902b7" || tr.RequestID != tr.TraceID {
+		t.Errorf("FromHeaders(%q) = %+v", traceparent, tr)
+	}
+
+	tr.FromHeaders("req-1", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	if tr.TraceID == "00000000000000000000000000000000" || tr.ParentID != "" || tr.RequestID != "req-1" {
+		t.Errorf("FromHeaders of zero trace ID = %+v, want a new trace", tr)
+	}
+}
+
+func TestStart(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	ctx := propagation.TraceContext{}.Extract(context.Background(),
+		propagation.MapCarrier{HeaderTraceparent: traceparent})
+	ctx = Trace{RequestID: "req-1"}.WithContext(ctx)
+
+	ctx, server := Start(ctx, "server")
+	var st Trace
+	st.FromContext(ctx)
+	if st.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || st.ParentID != "00f067aa0ba902b7" ||
+		st.SpanID != server.SpanContext().SpanID().String() || st.RequestID != "req-1" {
+		t.Errorf("trace of server span = %+v", st)
+	}
+
+	ctx, child := Start(ctx, "child")
+	var ct Trace
+	ct.FromContext(ctx)
+	if ct.ParentID != st.SpanID || ct.SpanID != child.SpanContext().SpanID().String() {
+		t.Errorf("trace of child span = %+v, want parent %s", ct, st.SpanID)
+	}
+	End(child, nil)
+	End(server, nil)
+
+	ended := recorder.Ended()
+	if len(ended) != 2 || ended[0].Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("recorded %d spans, want child of server", len(ended))
+	}
+	if got := st.Traceparent(); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-"+st.SpanID+"-01" {
+		t.Errorf("Traceparent() = %q", got)
+	}
+}
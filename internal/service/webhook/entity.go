@@ -0,0 +1,154 @@
+package webhook
+
+import (
+	"database/sql"
+	"encoding/json"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/service/entity"
+)
+
+const (
+	Pattern         entity.Pattern = "webhooks/{webhookID}"
+	DeliveryPattern entity.Pattern = "webhooks/{webhookID}/deliveries/{deliveryID}"
+)
+
+// Entity is a partner subscription, Secret is write-only and never rendered.
+// Webhooks are only visible to their owner, the user who created them.
+type Entity struct {
+	ID         int64     `json:"id,string"`
+	Name       string    `json:"name"`
+	Url        string    `json:"url" validate:"required,url"`
+	EventTypes []string  `json:"eventTypes"`
+	Active     bool      `json:"active"`
+	Failures   int64     `json:"failures"`
+	Secret     string    `json:"-"`
+	CreateTime time.Time `json:"createTime"`
+
+	owner string
+}
+
+func (e Entity) GetID() string {
+	return strconv.FormatInt(e.ID, 10)
+}
+
+func (e Entity) GetName() string {
+	return e.Name
+}
+
+func (e Entity) InsertValues() []any {
+	types, _ := json.Marshal(e.eventTypes())
+	return []any{e.Url, string(types), e.Active, e.Secret, e.owner}
+}
+
+func (e Entity) eventTypes() []string {
+	if e.EventTypes == nil {
+		return []string{}
+	}
+	return e.EventTypes
+}
+
+// Match reports whether the event type is subscribed, patterns like "item.*" are supported.
+// An empty list subscribes no events. Events of webhooks themselves are never delivered,
+// since they carry URLs of other partners.
+func (e Entity) Match(eventType string) bool {
+	if strings.HasPrefix(eventType, "webhook.") {
+		return false
+	}
+	for _, pattern := range e.EventTypes {
+		if ok, _ := path.Match(pattern, eventType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+const allFields = "id, url, event_types, active, failure_count, secret, create_time, owner"
+
+func scanEntity(row entity.Scanner) (e Entity, err error) {
+	var types string
+	if err = row.Scan(&e.ID, &e.Url, &types, &e.Active, &e.Failures, &e.Secret, &e.CreateTime, &e.owner); err != nil {
+		return
+	}
+	if err = json.Unmarshal([]byte(types), &e.EventTypes); err != nil {
+		return
+	}
+	e.Name = Pattern.Format(e.GetID())
+	return
+}
+
+func newDao(db *sql.DB) entity.Dao[Entity] {
+	return entity.Dao[Entity]{
+		DB:      db,
+		Pattern: Pattern,
+		Table:   "webhook",
+		Keys:    []string{"id"},
+		Columns: map[string]string{
+			"eventTypes": "event_types",
+			"failures":   "failure_count",
+			"owner":      "owner",
+		},
+		// failures are reset by the service on reactivation only
+		Updatable:     []string{"url", "eventTypes", "active", "failures"},
+		SqlCreate:     "insert into webhook (url, event_types, active, secret, owner) values (?, ?, ?, ?, ?)",
+		SqlGet:        "select " + allFields + " from webhook where id = ? limit 1",
+		SqlList:       "select " + allFields + " from webhook where id > ?",
+		SqlDelete:     "delete from webhook where id = ?",
+		ScanAllFields: scanEntity,
+	}
+}
+
+// Delivery is an attempt to post an event to a webhook.
+type Delivery struct {
+	ID         int64     `json:"id,string"`
+	Name       string    `json:"name"`
+	Event      string    `json:"event"`
+	EventType  string    `json:"eventType"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+	LatencyMs  int64     `json:"latencyMs"`
+	CreateTime time.Time `json:"createTime"`
+
+	webhookID string
+	eventID   int64
+}
+
+func (d Delivery) GetID() string {
+	return strconv.FormatInt(d.ID, 10)
+}
+
+func (d Delivery) GetName() string {
+	return d.Name
+}
+
+func (d Delivery) InsertValues() []any {
+	return []any{d.webhookID, d.eventID, d.EventType, d.StatusCode, d.Error, d.Success, d.LatencyMs}
+}
+
+// newDeliveryDao is read-only, deliveries are inserted by sender directly
+// so that they don't emit events themselves.
+func newDeliveryDao(db *sql.DB) entity.Dao[Delivery] {
+	const deliveryFields = "id, webhook_id, event_id, event_type, status_code, error, success, latency_ms, create_time"
+	return entity.Dao[Delivery]{
+		DB:      db,
+		Pattern: DeliveryPattern,
+		Table:   "webhook_delivery",
+		Keys:    []string{"webhook_id", "id"},
+		Columns: map[string]string{"event": ""},
+		SqlGet:  "select " + deliveryFields + " from webhook_delivery where webhook_id = ? and id = ? limit 1",
+		SqlList: "select " + deliveryFields + " from webhook_delivery where webhook_id = ? and id > ?",
+		ScanAllFields: func(row entity.Scanner) (d Delivery, err error) {
+			if err = row.Scan(&d.ID, &d.webhookID, &d.eventID, &d.EventType, &d.StatusCode,
+				&d.Error, &d.Success, &d.LatencyMs, &d.CreateTime); err != nil {
+				return
+			}
+			d.Name = DeliveryPattern.Format(d.webhookID, d.GetID())
+			d.Event = entity.Event{ID: d.eventID}.GetName()
+			return
+		},
+	}
+}
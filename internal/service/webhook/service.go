@@ -0,0 +1,277 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gota33/errors"
+	"server/internal/service/auth"
+	"server/internal/service/entity"
+)
+
+type Service struct {
+	db         *sql.DB
+	dao        entity.Dao[Entity]
+	deliveries entity.Dao[Delivery]
+	sender     sender
+}
+
+func New(db *sql.DB) Service {
+	return Service{
+		db:         db,
+		dao:        newDao(db),
+		deliveries: newDeliveryDao(db),
+		sender:     newSender(db),
+	}
+}
+
+func (srv Service) Check(ctx context.Context) (err error) {
+	if err = srv.dao.Check(ctx); err != nil {
+		return
+	}
+	return srv.deliveries.Check(ctx)
+}
+
+type GetRequest struct {
+	WebhookID string `param:"webhookID"`
+}
+
+func (srv Service) Get(ctx context.Context, req GetRequest) (res Entity, err error) {
+	return srv.get(ctx, Pattern.Format(req.WebhookID))
+}
+
+// get finds webhooks owned by the user of ctx, others are not found
+// rather than forbidden, so their names aren't disclosed.
+func (srv Service) get(ctx context.Context, name string) (res Entity, err error) {
+	var owner string
+	if owner, err = ownerOf(ctx); err != nil {
+		return
+	}
+	if res, err = srv.dao.Get(ctx, name); err == nil && res.owner != owner {
+		err = errors.WithNotFound(sql.ErrNoRows, errors.ResourceInfo{
+			ResourceType: Pattern.Collection(),
+			ResourceName: name,
+		})
+	}
+	return
+}
+
+// ownerOf is the subject of the user of ctx. Webhooks can't be managed anonymously,
+// since they receive data of every customer signed by a secret of the caller.
+func ownerOf(ctx context.Context) (string, error) {
+	var user auth.User
+	if err := user.FromContext(ctx); err != nil || user.Subject == "" {
+		return "", errors.Unauthenticated
+	}
+	return user.Subject, nil
+}
+
+type CreateRequest struct {
+	Entity
+	// Secret is generated when empty, it's only returned once on create.
+	Secret string `json:"secret"`
+}
+
+type CreateResponse struct {
+	Entity
+	Secret string `json:"secret"`
+}
+
+func (srv Service) Create(ctx context.Context, req CreateRequest) (res CreateResponse, err error) {
+	if req.Entity.owner, err = ownerOf(ctx); err != nil {
+		return
+	}
+	if err = checkURL(req.Url); err != nil {
+		return
+	}
+	if req.Secret == "" {
+		buf := make([]byte, 32)
+		if _, err = rand.Read(buf); err != nil {
+			return
+		}
+		req.Secret = hex.EncodeToString(buf)
+	}
+
+	req.Entity.Secret = req.Secret
+	req.Entity.Active = true
+	if res.Entity, err = srv.dao.Create(ctx, "", req.Entity); err != nil {
+		return
+	}
+	res.Secret = req.Secret
+	return
+}
+
+type ListRequest struct {
+	entity.ListRequestFragment
+}
+
+type ListResponse struct {
+	entity.ListResponseFragment
+	Webhooks []Entity `json:"webhooks"`
+}
+
+// List only lists webhooks owned by the user of ctx.
+func (srv Service) List(ctx context.Context, req ListRequest) (res ListResponse, err error) {
+	var owner string
+	if owner, err = ownerOf(ctx); err != nil {
+		return
+	}
+
+	var raw entity.ListResponse[Entity]
+	if raw, err = srv.dao.List(ctx, "", ownerRequest{ListRequest: req, owner: owner}); err != nil {
+		return
+	}
+
+	res.Webhooks = raw.Items
+	res.ListResponseFragment = raw.ListResponseFragment
+	return
+}
+
+// ownerRequest filters webhooks by owner, on top of the filter of the request.
+type ownerRequest struct {
+	ListRequest
+	owner string
+}
+
+func (r ownerRequest) GetFilter() string {
+	filter := "owner = " + strconv.Quote(r.owner)
+	if f := r.ListRequest.GetFilter(); f != "" {
+		filter += " AND " + f
+	}
+	return filter
+}
+
+var updatable = map[string]bool{"url": true, "eventTypes": true, "active": true}
+
+type UpdateRequest struct {
+	entity.UpdateRequestFragment
+	WebhookID string `param:"webhookID"`
+	Webhook   Entity `json:"webhook"`
+}
+
+func (srv Service) Update(ctx context.Context, req UpdateRequest) (res Entity, err error) {
+	if len(req.UpdateMask.Paths) == 0 {
+		req.UpdateMask.Paths = []string{"url", "eventTypes", "active"}
+	}
+
+	var reactivate bool
+	for _, path := range req.UpdateMask.Paths {
+		if !updatable[path] {
+			cause := fmt.Errorf("field %q is not updatable", path)
+			return res, errors.WithBadRequest(cause, errors.BadRequest{
+				FieldViolations: []errors.FieldViolation{{
+					Field:       "updateMask",
+					Description: cause.Error(),
+				}},
+			})
+		}
+		if path == "url" {
+			if err = checkURL(req.Webhook.Url); err != nil {
+				return
+			}
+		}
+		reactivate = reactivate || path == "active" && req.Webhook.Active
+	}
+	name := Pattern.Format(req.WebhookID)
+	if _, err = srv.get(ctx, name); err != nil {
+		return
+	}
+	if reactivate {
+		req.Webhook.Failures = 0
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "failures")
+	}
+
+	uReq := entity.UpdateRequest[Entity]{
+		UpdateRequestFragment: req.UpdateRequestFragment,
+		Name:                  name,
+		Entity:                req.Webhook,
+	}
+	return srv.dao.Update(ctx, uReq)
+}
+
+type DeleteRequest struct {
+	WebhookID string `param:"webhookID"`
+}
+
+func (srv Service) Delete(ctx context.Context, req DeleteRequest) (code int, err error) {
+	name := Pattern.Format(req.WebhookID)
+	if _, err = srv.get(ctx, name); err != nil {
+		return
+	}
+	if err = srv.dao.Delete(ctx, name); err == nil {
+		code = http.StatusNoContent
+	}
+	return
+}
+
+type ListDeliveriesRequest struct {
+	entity.ListRequestFragment
+	WebhookID string `param:"webhookID"`
+}
+
+type ListDeliveriesResponse struct {
+	entity.ListResponseFragment
+	Deliveries []Delivery `json:"deliveries"`
+}
+
+func (srv Service) ListDeliveries(ctx context.Context, req ListDeliveriesRequest) (res ListDeliveriesResponse, err error) {
+	parent := Pattern.Format(req.WebhookID)
+	if _, err = srv.get(ctx, parent); err != nil {
+		return
+	}
+
+	var raw entity.ListResponse[Delivery]
+	if raw, err = srv.deliveries.List(ctx, parent, req); err != nil {
+		return
+	}
+
+	res.Deliveries = raw.Items
+	res.ListResponseFragment = raw.ListResponseFragment
+	return
+}
+
+type GetDeliveryRequest struct {
+	WebhookID  string `param:"webhookID"`
+	DeliveryID string `param:"deliveryID"`
+}
+
+func (srv Service) GetDelivery(ctx context.Context, req GetDeliveryRequest) (res Delivery, err error) {
+	if _, err = srv.get(ctx, Pattern.Format(req.WebhookID)); err != nil {
+		return
+	}
+	return srv.deliveries.Get(ctx, DeliveryPattern.Format(req.WebhookID, req.DeliveryID))
+}
+
+type RedeliverRequest struct {
+	WebhookID  string `param:"webhookID"`
+	DeliveryID string `param:"deliveryID"`
+}
+
+// Redeliver posts the event of a previous delivery again, even to inactive webhooks.
+func (srv Service) Redeliver(ctx context.Context, req RedeliverRequest) (res Delivery, err error) {
+	var (
+		prev Delivery
+		hook Entity
+		e    entity.Event
+	)
+	if hook, err = srv.get(ctx, Pattern.Format(req.WebhookID)); err != nil {
+		return
+	}
+	if prev, err = srv.deliveries.Get(ctx, DeliveryPattern.Format(req.WebhookID, req.DeliveryID)); err != nil {
+		return
+	}
+
+	const script = "select id, type, resource, actor, update_mask, data, create_time from outbox where id = ? limit 1"
+	if e, err = entity.ScanEvent(srv.db.QueryRowContext(ctx, script, prev.eventID)); err != nil {
+		return res, errors.WithNotFound(err, errors.ResourceInfo{
+			ResourceType: "events",
+			ResourceName: prev.Event,
+		})
+	}
+	return srv.sender.send(ctx, hook, e)
+}
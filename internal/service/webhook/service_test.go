@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gota33/errors"
+	"server/internal/service/auth"
+)
+
+func newTestService(t *testing.T) Service {
+	t.Helper()
+
+	db := openDB(t)
+	if _, err := db.Exec(`
+create table revision
+(
+    id          integer primary key autoincrement,
+    resource    text not null,
+    operation   text not null,
+    actor       text not null default '',
+    update_mask text not null default '',
+    before_json text null,
+    after_json  text null,
+    create_time timestamp not null default current_timestamp
+);
+create table outbox
+(
+    id          integer primary key autoincrement,
+    type        text not null,
+    resource    text not null,
+    actor       text not null default '',
+    update_mask text not null default '',
+    data        text not null,
+    create_time timestamp not null default current_timestamp
+);`); err != nil {
+		t.Fatal(err)
+	}
+	return New(db)
+}
+
+func userContext(subject string) context.Context {
+	return auth.User{StandardClaims: jwt.StandardClaims{Subject: subject}}.WithContext(context.Background())
+}
+
+func TestServiceRequiresUser(t *testing.T) {
+	srv := newTestService(t)
+	ctx := context.Background()
+
+	_, err := srv.Create(ctx, CreateRequest{Entity: Entity{Url: "https://partner.example.com/hooks"}})
+	if errors.Code(err) != errors.Unauthenticated {
+		t.Errorf("anonymous create: got %v, want UNAUTHENTICATED", err)
+	}
+	if _, err = srv.List(ctx, ListRequest{}); errors.Code(err) != errors.Unauthenticated {
+		t.Errorf("anonymous list: got %v, want UNAUTHENTICATED", err)
+	}
+}
+
+func TestServiceScopesByOwner(t *testing.T) {
+	var (
+		srv   = newTestService(t)
+		alice = userContext("alice")
+		bob   = userContext("bob")
+	)
+	created, err := srv.Create(alice, CreateRequest{Entity: Entity{
+		Url:        "https://partner.example.com/hooks",
+		EventTypes: []string{"item.*"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = srv.sender.db.Exec("insert into webhook_delivery (webhook_id, event_id, event_type, success) "+
+		"values (?, 1, 'item.created', true)", created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	id := created.GetID()
+	if res, getErr := srv.Get(alice, GetRequest{WebhookID: id}); getErr != nil || res.Url != created.Url {
+		t.Errorf("owner get = %+v, %v", res, getErr)
+	}
+	if res, listErr := srv.List(alice, ListRequest{}); listErr != nil || len(res.Webhooks) != 1 {
+		t.Errorf("owner list = %+v, %v", res, listErr)
+	}
+	if res, listErr := srv.ListDeliveries(alice, ListDeliveriesRequest{WebhookID: id}); listErr != nil || len(res.Deliveries) != 1 {
+		t.Errorf("owner list deliveries = %+v, %v", res, listErr)
+	}
+
+	if res, listErr := srv.List(bob, ListRequest{}); listErr != nil || len(res.Webhooks) != 0 {
+		t.Errorf("other list = %+v, %v, want none", res, listErr)
+	}
+	calls := map[string]func() error{
+		"get": func() (callErr error) {
+			_, callErr = srv.Get(bob, GetRequest{WebhookID: id})
+			return
+		},
+		"update": func() (callErr error) {
+			_, callErr = srv.Update(bob, UpdateRequest{WebhookID: id, Webhook: Entity{Url: "https://bob.example.com/hooks"}})
+			return
+		},
+		"delete": func() (callErr error) {
+			_, callErr = srv.Delete(bob, DeleteRequest{WebhookID: id})
+			return
+		},
+		"list deliveries": func() (callErr error) {
+			_, callErr = srv.ListDeliveries(bob, ListDeliveriesRequest{WebhookID: id})
+			return
+		},
+		"get delivery": func() (callErr error) {
+			_, callErr = srv.GetDelivery(bob, GetDeliveryRequest{WebhookID: id, DeliveryID: "1"})
+			return
+		},
+		"redeliver": func() (callErr error) {
+			_, callErr = srv.Redeliver(bob, RedeliverRequest{WebhookID: id, DeliveryID: "1"})
+			return
+		},
+	}
+	for name, call := range calls {
+		if callErr := call(); errors.Code(callErr) != errors.NotFound {
+			t.Errorf("other %s: got %v, want NOT_FOUND", name, callErr)
+		}
+	}
+
+	if res, getErr := srv.Get(alice, GetRequest{WebhookID: id}); getErr != nil || res.Url != created.Url {
+		t.Errorf("owner get after others = %+v, %v, want unchanged", res, getErr)
+	}
+}
@@ -0,0 +1,208 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"server/internal/service/entity"
+	"server/internal/service/trace"
+)
+
+const (
+	HeaderSignature = "X-Webhook-Signature-256"
+	HeaderEventID   = "X-Webhook-Event-ID"
+	HeaderEventType = "X-Webhook-Event-Type"
+
+	// maxFailures disables a webhook after consecutive failed deliveries.
+	maxFailures = 5
+	timeout     = 10 * time.Second
+)
+
+// Sign returns the value of HeaderSignature, receivers should compute
+// HMAC-SHA256 of the raw body with their secret and compare in constant time.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type sender struct {
+	db     *sql.DB
+	client *http.Client
+}
+
+func newSender(db *sql.DB) sender {
+	return sender{db: db, client: newClient()}
+}
+
+// send posts the event and records the attempt, failures are recorded rather than returned.
+func (s sender) send(ctx context.Context, hook Entity, e entity.Event) (d Delivery, err error) {
+	d = Delivery{
+		EventType: e.Type,
+		webhookID: hook.GetID(),
+		eventID:   e.ID,
+	}
+
+	var body []byte
+	if body, err = json.Marshal(e); err != nil {
+		return
+	}
+
+	postCtx, span := trace.Start(ctx, "webhook.post", oteltrace.WithSpanKind(oteltrace.SpanKindClient))
+	start := time.Now()
+	d.StatusCode, d.Error = s.post(postCtx, hook, e, body)
+	d.LatencyMs = time.Since(start).Milliseconds()
+	d.Success = d.Error == ""
+	if !d.Success {
+		span.SetStatus(codes.Error, d.Error)
+	}
+	span.End()
+
+	return s.record(ctx, hook, d)
+}
+
+func (s sender) post(ctx context.Context, hook Entity, e entity.Event, body []byte) (code int, msg string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, body))
+	req.Header.Set(HeaderEventID, e.GetID())
+	req.Header.Set(HeaderEventType, e.Type)
+
+	var t trace.Trace
+	if t.FromContext(ctx) {
+		req.Header.Set(trace.HeaderRequestID, t.RequestID)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	if closeErr := resp.Body.Close(); closeErr != nil {
+		trace.Logger(ctx).WithError(closeErr).Warn("Close webhook response error")
+	}
+
+	if code = resp.StatusCode; code < 200 || code > 299 {
+		msg = fmt.Sprintf("unexpected status: %s", resp.Status)
+	}
+	return
+}
+
+func (s sender) record(ctx context.Context, hook Entity, d Delivery) (_ Delivery, err error) {
+	var (
+		tx     entity.SQLCmd
+		finish func(error) error
+		sr     sql.Result
+	)
+	if tx, finish, err = entity.BeginTx(ctx, s.db, nil); err != nil {
+		return
+	}
+	defer func() { err = finish(err) }()
+
+	const script = "insert into webhook_delivery (webhook_id, event_id, event_type, status_code, error, success, latency_ms) values (?, ?, ?, ?, ?, ?, ?)"
+	if sr, err = tx.ExecContext(ctx, script, d.InsertValues()...); err != nil {
+		return
+	}
+	if d.ID, err = sr.LastInsertId(); err != nil {
+		return
+	}
+	d.Name = DeliveryPattern.Format(d.webhookID, d.GetID())
+	d.Event = entity.Event{ID: d.eventID}.GetName()
+	d.CreateTime = time.Now().UTC()
+
+	if d.Success {
+		_, err = tx.ExecContext(ctx, "update webhook set failure_count = 0 where id = ?", hook.ID)
+		return d, err
+	}
+
+	// Counted by SQL, as deliveries of other events to the webhook may fail concurrently.
+	// active is set first, since MySQL assigns columns in order.
+	const count = "update webhook set active = active and failure_count + 1 < ?, " +
+		"failure_count = failure_count + 1 where id = ?"
+	if _, err = tx.ExecContext(ctx, count, maxFailures, hook.ID); err != nil {
+		return
+	}
+	var active bool
+	if err = tx.QueryRowContext(ctx, "select active from webhook where id = ?", hook.ID).Scan(&active); err != nil {
+		return
+	}
+	if hook.Active && !active {
+		trace.Logger(ctx).WithField("webhook", hook.Name).Warn("Webhook disabled after repeated failures")
+	}
+	return d, err
+}
+
+// Sink delivers outbox events to subscribed webhooks. Webhooks that already
+// succeeded are skipped on retry, so only failed endpoints are posted again.
+type Sink struct {
+	sender
+}
+
+func NewSink(db *sql.DB) Sink {
+	return Sink{sender: newSender(db)}
+}
+
+func (s Sink) Name() string {
+	return "webhooks"
+}
+
+func (s Sink) Deliver(ctx context.Context, e entity.Event) (err error) {
+	var hooks []Entity
+	if hooks, err = s.pending(ctx, e); err != nil {
+		return
+	}
+
+	var failed int
+	for _, hook := range hooks {
+		var d Delivery
+		if d, err = s.send(ctx, hook, e); err != nil {
+			return
+		}
+		if !d.Success {
+			failed++
+		}
+	}
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d webhook deliveries failed", failed, len(hooks))
+	}
+	return
+}
+
+func (s Sink) pending(ctx context.Context, e entity.Event) (hooks []Entity, err error) {
+	const script = "select " + allFields + " from webhook w where active and not exists " +
+		"(select 1 from webhook_delivery d where d.webhook_id = w.id and d.event_id = ? and d.success)"
+
+	var rows *sql.Rows
+	if rows, err = s.db.QueryContext(ctx, script, e.ID); err != nil {
+		return
+	}
+
+	defer entity.CloseRows(rows)
+
+	for rows.Next() {
+		var hook Entity
+		if hook, err = scanEntity(rows); err != nil {
+			return
+		}
+		if hook.Match(e.Type) {
+			hooks = append(hooks, hook)
+		}
+	}
+	err = rows.Err()
+	return
+}
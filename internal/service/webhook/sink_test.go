@@ -0,0 +1,205 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gota33/errors"
+	_ "github.com/mattn/go-sqlite3"
+	"server/internal/service/entity"
+)
+
+const schema = `
+create table webhook
+(
+    id            integer primary key autoincrement,
+    url           text      not null,
+    event_types   text      not null default '[]',
+    active        boolean   not null default true,
+    failure_count integer   not null default 0,
+    secret        text      not null,
+    owner         text      not null default '',
+    create_time   timestamp not null default current_timestamp
+);
+create table webhook_delivery
+(
+    id          integer primary key autoincrement,
+    webhook_id  integer   not null,
+    event_id    integer   not null,
+    event_type  text      not null,
+    status_code integer   not null default 0,
+    error       text      not null default '',
+    success     boolean   not null,
+    latency_ms  integer   not null default 0,
+    create_time timestamp not null default current_timestamp
+);`
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err = db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestSink posts with the client of srv, since httptest servers listen on loopback.
+func newTestSink(t *testing.T, srv *httptest.Server, eventTypes string) (Sink, *sql.DB) {
+	t.Helper()
+
+	db := openDB(t)
+	if _, err := db.Exec("insert into webhook (url, event_types, secret) values (?, ?, 'secret')",
+		srv.URL, eventTypes); err != nil {
+		t.Fatal(err)
+	}
+	return Sink{sender: sender{db: db, client: srv.Client()}}, db
+}
+
+func TestSinkSignsDeliveries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		if got, want := r.Header.Get(HeaderSignature), Sign("secret", body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		if got := r.Header.Get(HeaderEventType); got != "item.created" {
+			t.Errorf("event type = %q, want item.created", got)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sink, _ := newTestSink(t, srv, `["item.*"]`)
+	e := entity.Event{ID: 1, Type: "item.created", Resource: "items/1"}
+	if err := sink.Deliver(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	// Succeeded webhooks are skipped on retry
+	if err := sink.Deliver(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("webhook called %d times, want 1", calls)
+	}
+}
+
+func TestSinkSkipsUnsubscribedEvents(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		eventTypes string
+		eventType  string
+	}{
+		{`[]`, "item.created"},
+		{`["customer.*"]`, "item.created"},
+		{`["*"]`, "webhook.created"},
+		{`["webhook.*"]`, "webhook.updated"},
+	}
+	for _, tt := range tests {
+		sink, _ := newTestSink(t, srv, tt.eventTypes)
+		e := entity.Event{ID: 1, Type: tt.eventType, Resource: "items/1"}
+		if err := sink.Deliver(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("webhook called %d times, want 0", calls)
+	}
+}
+
+func TestSinkDisablesFailingWebhook(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	sink, db := newTestSink(t, srv, `["item.*"]`)
+	for i := 1; i <= maxFailures; i++ {
+		e := entity.Event{ID: int64(i), Type: "item.updated", Resource: "items/1"}
+		if err := sink.Deliver(context.Background(), e); err == nil {
+			t.Fatalf("deliver #%d succeeded, want failure", i)
+		}
+	}
+
+	var (
+		failures int
+		active   bool
+	)
+	if err := db.QueryRow("select failure_count, active from webhook").Scan(&failures, &active); err != nil {
+		t.Fatal(err)
+	}
+	if failures != maxFailures || active {
+		t.Errorf("got %d failures, active %v, want %d failures and inactive", failures, active, maxFailures)
+	}
+}
+
+func TestSenderRefusesInternalAddresses(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer srv.Close()
+
+	db := openDB(t)
+	if _, err := db.Exec("insert into webhook (url, secret) values (?, 'secret')", srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	s := newSender(db)
+	hook := Entity{ID: 1, Url: srv.URL, Active: true, Secret: "secret"}
+	d, err := s.send(context.Background(), hook, entity.Event{ID: 1, Type: "item.created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Success || !strings.Contains(d.Error, errAddress.Error()) {
+		t.Errorf("got delivery %+v, want refused", d)
+	}
+	if calls != 0 {
+		t.Errorf("webhook called %d times, want 0", calls)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://partner.example.com/hooks", true},
+		{"http://203.0.113.10:8080/hooks", true},
+		{"ftp://partner.example.com/hooks", false},
+		{"http://localhost:8080/hooks", false},
+		{"http://api.localhost/hooks", false},
+		{"http://127.0.0.1/hooks", false},
+		{"http://[::1]/hooks", false},
+		{"http://10.0.0.8/hooks", false},
+		{"http://192.168.1.1/hooks", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://0.0.0.0/hooks", false},
+	}
+	for _, tt := range tests {
+		err := checkURL(tt.url)
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("checkURL(%q) = %v, want ok %v", tt.url, err, tt.ok)
+		}
+		if err != nil && errors.Code(err) != errors.InvalidArgument {
+			t.Errorf("checkURL(%q) code = %v, want InvalidArgument", tt.url, errors.Code(err))
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+
+	"github.com/gota33/errors"
+)
+
+var errAddress = errors.New("webhook address is not public")
+
+// deniedIP reports whether ip is internal to the deployment, posting to such
+// addresses would let partners reach services behind the firewall.
+func deniedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// checkURL rejects URLs not using HTTP or addressing internal hosts by IP or localhost.
+// Host names are resolved on every delivery and checked by dialControl instead.
+func checkURL(raw string) (err error) {
+	var u *url.URL
+	if u, err = url.Parse(raw); err != nil {
+		return urlViolation(err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return urlViolation(fmt.Errorf("unsupported scheme %q", u.Scheme))
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return urlViolation(errAddress)
+	}
+	if ip := net.ParseIP(host); ip != nil && deniedIP(ip) {
+		return urlViolation(errAddress)
+	}
+	return
+}
+
+func urlViolation(cause error) error {
+	return errors.WithBadRequest(cause, errors.BadRequest{
+		FieldViolations: []errors.FieldViolation{{Field: "url", Description: cause.Error()}},
+	})
+}
+
+// dialControl refuses connections to internal addresses after host names are
+// resolved, which covers redirects and DNS records changed after create.
+func dialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || deniedIP(ip) {
+		return fmt.Errorf("dial %s: %w", address, errAddress)
+	}
+	return nil
+}
+
+// newClient posts directly to webhooks, proxies from the environment are
+// ignored since they would bypass dialControl.
+func newClient() *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialControl}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 2,
+		},
+	}
+}